@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+)
+
+// maxHistory is how many entries a history file keeps
+const maxHistory = 1000
+
+// history is the list of lines entered in a workspace, oldest first, saved
+// to a file one JSON string per line so entries may span lines
+type history struct {
+	path    string
+	entries []string
+}
+
+// historyPath returns the history file of a workspace, kept in the user's
+// config directory so it stays out of the project
+func historyPath(workspaceRoot string) (string, error) {
+	dir, err := config.UserDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(workspaceRoot))
+	return filepath.Join(dir, "history", hex.EncodeToString(sum[:8])+".jsonl"), nil
+}
+
+// openHistory loads the workspace's history, warning when it cannot be read
+func openHistory(workspaceRoot string) *history {
+	path, err := historyPath(workspaceRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: input history is not saved: %s\n", err.Error())
+	}
+	h, err := loadHistory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read input history: %s\n", err.Error())
+	}
+	return h
+}
+
+// loadHistory reads the history file at path. A missing file is an empty
+// history; with no path the history is not saved.
+func loadHistory(path string) (*history, error) {
+	h := &history{path: path}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		var entry string
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry != "" {
+			h.entries = append(h.entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return h, err
+	}
+
+	// Compact the file once it has grown well past the limit
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+		return h, h.rewrite()
+	}
+	return h, nil
+}
+
+// Add appends entry to the history and its file, skipping blank lines and
+// repeats of the previous entry
+func (h *history) Add(entry string) error {
+	if strings.TrimSpace(entry) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if h.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line, _ := json.Marshal(entry)
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Entries returns the entries, oldest first
+func (h *history) Entries() []string {
+	return h.entries
+}
+
+// rewrite replaces the history file with the entries in memory
+func (h *history) rewrite() error {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		line, _ := json.Marshal(entry)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(h.path, []byte(b.String()), 0600)
+}
+
+// search returns the newest entry before index from holding query and the
+// entry's index, or -1 when there is none
+func (h *history) search(query string, from int) (string, int) {
+	for i := min(from, len(h.entries)) - 1; i >= 0; i-- {
+		if strings.Contains(h.entries[i], query) {
+			return h.entries[i], i
+		}
+	}
+	return "", -1
+}
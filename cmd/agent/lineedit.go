@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"golang.org/x/term"
+)
+
+// Control keys the line editor handles
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlJ     = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Bracketed paste wraps pasted text in escape sequences, so that newlines
+// in it are not taken as enter
+const (
+	pasteOn  = "\033[?2004h"
+	pasteOff = "\033[?2004l"
+	pasteEnd = "\033[201~"
+)
+
+// ansiEscape matches the escape sequences that color prompts
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// lineReader reads messages and answers to questions from the user
+type lineReader interface {
+	agent.InputSource
+	agent.AnswerReader
+}
+
+// lineEditor reads input from a terminal in raw mode. It has the usual
+// emacs-style editing keys, history with reverse search, tab completion and
+// multi-line input, entered with shift-enter, alt-enter, ctrl-j or a
+// trailing backslash.
+type lineEditor struct {
+	fd       int
+	in       *bufio.Reader
+	out      io.Writer
+	complete func(line string) []string
+	history  *history
+
+	prompt    string
+	buf       []rune
+	pos       int
+	cursorRow int
+	lastRow   int
+	histIndex int
+	draft     []rune
+	lastCtrlC time.Time
+}
+
+// newInput returns a line editor when stdin is a terminal, or a plain line
+// reader otherwise. complete offers completions of the line typed so far
+// and hist holds the lines entered before.
+func newInput(complete func(line string) []string, hist *history) lineReader {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return &terminalInput{reader: bufio.NewReader(os.Stdin)}
+	}
+	if hist == nil {
+		hist = &history{}
+	}
+	return &lineEditor{fd: fd, in: bufio.NewReader(os.Stdin), out: os.Stdout, complete: complete, history: hist}
+}
+
+// ReadLine implements agent.InputSource, adding the line to the history.
+// It returns false when the input ends, on ctrl-d at an empty line or on a
+// double ctrl-c.
+func (e *lineEditor) ReadLine(prompt string) (string, bool) {
+	line, ok := e.read(prompt)
+	if ok {
+		// The history is a convenience; failing to save it should not interrupt input
+		e.history.Add(line)
+	}
+	return line, ok
+}
+
+// ReadAnswer implements agent.AnswerReader, leaving the answer out of the history
+func (e *lineEditor) ReadAnswer(prompt string) (string, bool) {
+	return e.read(prompt)
+}
+
+// read edits a line in raw mode until it is entered
+func (e *lineEditor) read(prompt string) (string, bool) {
+	state, err := term.MakeRaw(e.fd)
+	if err != nil {
+		// Without raw mode, read the line as the terminal delivers it
+		return (&terminalInput{reader: e.in}).ReadLine(prompt)
+	}
+	fmt.Fprint(e.out, pasteOn)
+	defer func() {
+		fmt.Fprint(e.out, pasteOff)
+		term.Restore(e.fd, state)
+	}()
+
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	e.cursorRow, e.lastRow = 0, 0
+	e.histIndex, e.draft = len(e.history.entries), nil
+	e.redraw()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			e.below()
+			return "", false
+		}
+		if r == keyCtrlR {
+			if r = e.reverseSearch(); r == 0 {
+				e.redraw()
+				continue
+			}
+		}
+
+		switch r {
+		case keyEnter:
+			// A trailing backslash continues the input on a new line
+			if n := len(e.buf); n > 0 && e.buf[n-1] == '\\' {
+				e.buf[n-1] = '\n'
+				e.pos = n
+				break
+			}
+			e.pos = len(e.buf)
+			e.redraw()
+			e.below()
+			return string(e.buf), true
+		case keyCtrlJ:
+			e.insert('\n')
+		case keyCtrlC:
+			if len(e.buf) > 0 {
+				e.pos = len(e.buf)
+				e.redraw()
+				fmt.Fprint(e.out, "^C")
+				e.below()
+				e.buf, e.pos = nil, 0
+				break
+			}
+			if time.Since(e.lastCtrlC) < exitWindow {
+				e.below()
+				return "", false
+			}
+			e.lastCtrlC = time.Now()
+			e.below()
+			fmt.Fprint(e.out, "(press ctrl-c again to exit)\r\n")
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				e.below()
+				return "", false
+			}
+			e.deleteAt(e.pos)
+		case keyDelete, keyBackspace:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyCtrlA:
+			e.pos = e.lineStart()
+		case keyCtrlE:
+			e.pos = e.lineEnd()
+		case keyCtrlB:
+			e.move(-1)
+		case keyCtrlF:
+			e.move(1)
+		case keyCtrlP:
+			e.up()
+		case keyCtrlN:
+			e.down()
+		case keyCtrlK:
+			end := e.lineEnd()
+			if end == e.pos && end < len(e.buf) {
+				// At the end of a line, join the next one
+				end++
+			}
+			e.buf = append(e.buf[:e.pos], e.buf[end:]...)
+		case keyCtrlU:
+			start := e.lineStart()
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlW:
+			start := e.wordStart()
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\033[H\033[2J")
+			e.cursorRow, e.lastRow = 0, 0
+		case keyTab:
+			e.completeLine()
+		case keyEscape:
+			e.escape()
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+		e.redraw()
+	}
+}
+
+// escape handles the escape sequences of alt-enter, shift-enter, the arrow,
+// home, end and delete keys and pasted text
+func (e *lineEditor) escape() {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	if r == keyEnter || r == keyCtrlJ {
+		e.insert('\n')
+		return
+	}
+	if r != '[' && r != 'O' {
+		return
+	}
+	var b strings.Builder
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		b.WriteRune(r)
+	}
+	params := b.String()
+
+	// Arrows with ctrl or alt held, like "1;5C", move by words
+	_, modifier, modified := strings.Cut(params, ";")
+	switch {
+	case r == 'A':
+		e.up()
+	case r == 'B':
+		e.down()
+	case r == 'C' && modified && modifier != "2":
+		e.pos = e.wordEnd()
+	case r == 'D' && modified && modifier != "2":
+		e.pos = e.wordStart()
+	case r == 'C':
+		e.move(1)
+	case r == 'D':
+		e.move(-1)
+	case r == 'H', r == '~' && (params == "1" || params == "7"):
+		e.pos = e.lineStart()
+	case r == 'F', r == '~' && (params == "4" || params == "8"):
+		e.pos = e.lineEnd()
+	case r == '~' && params == "3":
+		e.deleteAt(e.pos)
+	case r == '~' && params == "200":
+		e.paste()
+	// Shift-enter, as sent by terminals reporting modified keys
+	case r == 'u' && params == "13;2", r == '~' && params == "27;2;13":
+		e.insert('\n')
+	}
+}
+
+// paste inserts bracketed pasted text at the cursor as it is, newlines included
+func (e *lineEditor) paste() {
+	var text []rune
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			break
+		}
+		text = append(text, r)
+		if n := len(text) - len(pasteEnd); n >= 0 && string(text[n:]) == pasteEnd {
+			text = text[:n]
+			break
+		}
+	}
+
+	pasted := strings.ReplaceAll(string(text), "\r\n", "\n")
+	pasted = strings.ReplaceAll(pasted, "\r", "\n")
+	for _, r := range pasted {
+		if r == '\n' || r == '\t' || unicode.IsPrint(r) {
+			e.insert(r)
+		}
+	}
+}
+
+// reverseSearch searches the history for entries holding what is typed,
+// newest first, with ctrl-r moving to older matches. It returns the key that
+// ended the search, with the match taken as the input, or 0 when the search
+// was cancelled with ctrl-g or ctrl-c and the input is as before.
+func (e *lineEditor) reverseSearch() rune {
+	original, originalPos, prompt := append([]rune(nil), e.buf...), e.pos, e.prompt
+	defer func() { e.prompt = prompt }()
+
+	var query []rune
+	index := len(e.history.entries)
+	failed := false
+	find := func(before int) {
+		match, i := e.history.search(string(query), before)
+		if failed = i < 0; failed {
+			return
+		}
+		index = i
+		e.buf = []rune(match)
+		e.pos = len([]rune(match[:strings.Index(match, string(query))]))
+	}
+
+	for {
+		label := "reverse-i-search"
+		if failed {
+			label = "failed reverse-i-search"
+		}
+		e.prompt = fmt.Sprintf("(%s)`%s': ", label, string(query))
+		e.redraw()
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0
+		}
+		switch {
+		case r == keyCtrlR:
+			find(index)
+		case r == keyDelete || r == keyBackspace:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history.entries))
+			}
+		case r == keyCtrlG || r == keyCtrlC:
+			e.buf, e.pos = original, originalPos
+			return 0
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			find(index + 1)
+		default:
+			return r
+		}
+	}
+}
+
+// up moves the cursor to the line above, or shows the previous history entry
+// when it is on the first line
+func (e *lineEditor) up() {
+	start := e.lineStart()
+	if start > 0 {
+		prevStart := e.lineStartAt(start - 1)
+		e.pos = min(prevStart+e.pos-start, start-1)
+		return
+	}
+	if e.histIndex == 0 {
+		return
+	}
+	if e.histIndex == len(e.history.entries) {
+		e.draft = append([]rune(nil), e.buf...)
+	}
+	e.histIndex--
+	e.buf = []rune(e.history.entries[e.histIndex])
+	e.pos = len(e.buf)
+}
+
+// down moves the cursor to the line below, or shows the next history entry,
+// and after the last one the input being written, when it is on the last line
+func (e *lineEditor) down() {
+	end := e.lineEnd()
+	if end < len(e.buf) {
+		column := e.pos - e.lineStart()
+		e.pos = end + 1
+		e.pos = min(e.pos+column, e.lineEnd())
+		return
+	}
+	if e.histIndex >= len(e.history.entries) {
+		return
+	}
+	e.histIndex++
+	if e.histIndex == len(e.history.entries) {
+		e.buf = e.draft
+	} else {
+		e.buf = []rune(e.history.entries[e.histIndex])
+	}
+	e.pos = len(e.buf)
+}
+
+// completeLine completes the text before the cursor, listing the choices
+// when there is more than one
+func (e *lineEditor) completeLine() {
+	if e.complete == nil {
+		return
+	}
+	typed := string(e.buf[:e.pos])
+	choices := e.complete(typed)
+	if len(choices) == 0 {
+		fmt.Fprint(e.out, "\a")
+		return
+	}
+
+	completed := commonPrefix(choices)
+	if len(completed) > len(typed) {
+		tail := e.buf[e.pos:]
+		e.buf = append([]rune(completed), tail...)
+		e.pos = len([]rune(completed))
+		return
+	}
+	if len(choices) == 1 {
+		return
+	}
+
+	// Show only the word being completed of each choice
+	start := strings.LastIndexByte(typed, ' ') + 1
+	words := make([]string, len(choices))
+	for i, c := range choices {
+		words[i] = strings.TrimSpace(c[start:])
+	}
+	e.below()
+	fmt.Fprintf(e.out, "%s\r\n", strings.Join(words, "  "))
+}
+
+// commonPrefix returns the longest prefix shared by every string
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// insert adds r at the cursor
+func (e *lineEditor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+// deleteAt removes the character at i, if there is one
+func (e *lineEditor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+// move moves the cursor by n characters within the input
+func (e *lineEditor) move(n int) {
+	e.pos = max(0, min(len(e.buf), e.pos+n))
+}
+
+// lineStart returns where the line holding the cursor starts
+func (e *lineEditor) lineStart() int {
+	return e.lineStartAt(e.pos)
+}
+
+// lineStartAt returns where the line holding position i starts
+func (e *lineEditor) lineStartAt(i int) int {
+	for i > 0 && e.buf[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+// lineEnd returns where the line holding the cursor ends
+func (e *lineEditor) lineEnd() int {
+	i := e.pos
+	for i < len(e.buf) && e.buf[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// wordStart returns the start of the word before the cursor
+func (e *lineEditor) wordStart() int {
+	i := e.pos
+	for i > 0 && unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor
+func (e *lineEditor) wordEnd() int {
+	i := e.pos
+	for i < len(e.buf) && unicode.IsSpace(e.buf[i]) {
+		i++
+	}
+	for i < len(e.buf) && !unicode.IsSpace(e.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// redraw rewrites the prompt and input over the last drawing and puts the
+// cursor back in place. Lines after the first follow a continuation prompt,
+// and long lines wrap at the terminal's width.
+func (e *lineEditor) redraw() {
+	cols, _, err := term.GetSize(e.fd)
+	if err != nil || cols <= 0 {
+		cols = 80
+	}
+	if e.cursorRow > 0 {
+		fmt.Fprintf(e.out, "\033[%dA", e.cursorRow)
+	}
+
+	continuation := "... "
+	if width := displayWidth(e.prompt); width > len(continuation) {
+		continuation = strings.Repeat(" ", width-len(continuation)) + continuation
+	}
+
+	var b strings.Builder
+	b.WriteString("\r\033[J")
+	row, cursorRow, cursorCol, start := 0, 0, 0, 0
+	for i, line := range strings.Split(string(e.buf), "\n") {
+		prompt := e.prompt
+		if i > 0 {
+			b.WriteString("\r\n")
+			prompt = continuation
+		}
+		runes := []rune(line)
+		width := displayWidth(prompt) + displayWidth(line)
+		b.WriteString(prompt)
+		b.WriteString(strings.ReplaceAll(line, "\t", "    "))
+
+		if e.pos >= start && e.pos <= start+len(runes) {
+			offset := displayWidth(prompt) + displayWidth(string(runes[:e.pos-start]))
+			cursorRow, cursorCol = row+offset/cols, offset%cols
+		}
+		// A line filling the last column leaves the cursor there until the
+		// next character, so move to the next row to keep rows countable
+		if width > 0 && width%cols == 0 {
+			b.WriteString("\r\n")
+		}
+		row += width/cols + 1
+		start += len(runes) + 1
+	}
+
+	e.lastRow = row - 1
+	if up := e.lastRow - cursorRow; up > 0 {
+		fmt.Fprintf(&b, "\033[%dA", up)
+	}
+	b.WriteString("\r")
+	if cursorCol > 0 {
+		fmt.Fprintf(&b, "\033[%dC", cursorCol)
+	}
+	e.cursorRow = cursorRow
+	fmt.Fprint(e.out, b.String())
+}
+
+// below moves to a new line after the drawn input, so that what is printed
+// next does not overwrite it
+func (e *lineEditor) below() {
+	if down := e.lastRow - e.cursorRow; down > 0 {
+		fmt.Fprintf(e.out, "\033[%dB", down)
+	}
+	fmt.Fprint(e.out, "\r\n")
+	e.cursorRow, e.lastRow = 0, 0
+}
+
+// displayWidth returns how many columns s takes on the terminal, leaving out
+// color codes and counting tabs as four spaces
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range ansiEscape.ReplaceAllString(s, "") {
+		if r == '\t' {
+			width += 4
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// terminalInput reads the user's lines from stdin when it is not a terminal,
+// showing prompts on stdout. A line ending in a backslash continues on the next.
+type terminalInput struct {
+	reader *bufio.Reader
+}
+
+// ReadLine implements agent.InputSource
+func (t *terminalInput) ReadLine(prompt string) (string, bool) {
+	fmt.Print(prompt)
+	var lines []string
+	for {
+		line, err := t.reader.ReadString('\n')
+		if err != nil && line == "" {
+			if len(lines) == 0 {
+				return "", false
+			}
+			return strings.Join(lines, "\n"), true
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if continued, ok := strings.CutSuffix(line, "\\"); ok && err == nil {
+			lines = append(lines, continued)
+			continue
+		}
+		return strings.Join(append(lines, line), "\n"), true
+	}
+}
+
+// ReadAnswer implements agent.AnswerReader
+func (t *terminalInput) ReadAnswer(prompt string) (string, bool) {
+	return t.ReadLine(prompt)
+}
@@ -1,49 +1,419 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"flag"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/joho/godotenv"
 	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/hooks"
+	"github.com/ttli3/terminal-coding-agent/pkg/instructions"
+	"github.com/ttli3/terminal-coding-agent/pkg/mcp"
+	"github.com/ttli3/terminal-coding-agent/pkg/memory"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/plugin"
+	"github.com/ttli3/terminal-coding-agent/pkg/review"
+	"github.com/ttli3/terminal-coding-agent/pkg/session"
 	"github.com/ttli3/terminal-coding-agent/pkg/tools"
 )
 
+// Exit codes
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitBudget      = 3
+	exitInterrupted = 130
+)
+
 func main() {
+	// Subcommands that don't start a chat session
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "usage":
+			if err := runUsage(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+				os.Exit(exitError)
+			}
+			return
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "mcp-serve":
+			os.Exit(runMCPServe(os.Args[2:]))
+		case "tools":
+			os.Exit(runTools(os.Args[2:]))
+		case "trust":
+			os.Exit(runTrust(os.Args[2:]))
+		}
+	}
+
+	var opts options
+	flag.BoolVar(&opts.print, "p", false, "print mode: run the prompt given as arguments or on stdin, print the answer and exit")
+	flag.BoolVar(&opts.print, "print", false, "same as -p")
+	flag.StringVar(&opts.outputFormat, "output-format", "text", "print mode output: text, json or stream-json")
+	flag.StringVar(&opts.permissionMode, "permission-mode", "", "permission mode: ask, accept-edits, allow-all or read-only")
+	flag.StringVar(&opts.model, "model", "", "Claude model to use")
+	flag.BoolVar(&opts.reviewEdits, "review-edits", false, "show each file edit for review before it is written")
+	flag.BoolVar(&opts.plan, "plan", false, "start in plan mode: investigate read-only and propose a plan to approve before changing anything")
+	flag.BoolVar(&opts.tui, "tui", false, "full-screen mode: chat in a scrollable transcript with tool panels and a status bar")
+	opts.args = parseInterspersed(flag.CommandLine, os.Args[1:])
+
+	if opts.print {
+		os.Exit(runPrint(opts))
+	}
+	if opts.tui {
+		os.Exit(runTUI(opts))
+	}
+	os.Exit(runREPL(opts))
+}
+
+// options are the command-line flags for a chat session
+type options struct {
+	print          bool
+	outputFormat   string
+	permissionMode string
+	model          string
+	reviewEdits    bool
+	plan           bool
+	tui            bool
+	args           []string
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments, so `-p "fix the test" --output-format json` works, and returns
+// the positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// setup holds what both the REPL and print mode need to build an agent
+type setup struct {
+	client anthropic.Client
+	cfg    *config.Config
+	env    *tools.Env
+	policy *permission.Policy
+	// review is whether file edits are reviewed, where the interface supports it
+	review  bool
+	plugins []tools.ToolDefinition
+	hooks   *hooks.Runner
+	mcp     *mcp.Manager
+	// instructions are the AGENTS.md files that apply to the workspace
+	instructions *instructions.Set
+}
+
+// newSetup loads the API key and config and prepares the tool environment in
+// the current directory. A non-empty defaultMode replaces the configured
+// permission mode unless the --permission-mode flag is given.
+func newSetup(opts options, defaultMode permission.Mode) (*setup, error) {
+	client, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	// Interactive sessions ask about a project config that is not trusted yet
+	if !opts.print && stdinIsTerminal() {
+		workspaceRoot, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if err := askTrust(workspaceRoot); err != nil {
+			return nil, err
+		}
+	}
+	return newSessionSetup(client, opts, "", defaultMode)
+}
+
+// newClient creates an API client with the key from the environment or .env file
+func newClient() (anthropic.Client, error) {
 	// Load anthropic key from env
-	if err := godotenv.Load(); err != nil {
-		fmt.Printf("Warning: .env file not found: %s\n", err.Error())
-		fmt.Println("Looking for ANTHROPIC_API_KEY in environment variables...")
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: could not load .env file: %s\n", err.Error())
 	}
-	
+
 	apiKey := os.Getenv("ANTHROPIC_API_KEY")
 	if apiKey == "" {
-		fmt.Println("Error: ANTHROPIC_API_KEY not found in environment variables or .env file")
-		fmt.Println("Please set your ANTHROPIC_API_KEY environment variable or create a .env file with ANTHROPIC_API_KEY=your_key")
-		return
+		return anthropic.Client{}, fmt.Errorf("ANTHROPIC_API_KEY not found in environment variables or .env file\n" +
+			"Please set your ANTHROPIC_API_KEY environment variable or create a .env file with ANTHROPIC_API_KEY=your_key")
+	}
+
+	// The agent retries failed calls itself, with backoff and user-facing status
+	return anthropic.NewClient(option.WithAPIKey(apiKey), option.WithMaxRetries(0)), nil
+}
+
+// newSessionSetup loads the config of the workspace at root, or the current
+// directory if root is empty, and prepares the tool environment there
+func newSessionSetup(client anthropic.Client, opts options, root string, defaultMode permission.Mode) (*setup, error) {
+	// Set up the environment tools execute in
+	workspaceRoot, err := workspaceDir(root)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Load(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	warnUntrusted(cfg, workspaceRoot)
+	if opts.model != "" {
+		cfg.Model = opts.model
+	}
+	policy, err := newPolicy(cfg, opts, defaultMode)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &tools.Env{
+		WorkspaceRoot: workspaceRoot,
+		SessionID:     session.NewID(),
+		Permissions:   policy,
+		Logger:        newLogger(),
+		Journal:       &tools.Journal{},
+	}
+
+	// Broken plugins are left out rather than stopping the session
+	plugins, errs := plugin.Load(cfg.Tools, workspaceRoot, tools.GetAllTools())
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
+	}
+
+	// Instruction files that cannot be read are left out too
+	instructionFiles, errs := instructions.Load(workspaceRoot)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
+	}
+
+	runner := hooks.New(cfg.Hooks, workspaceRoot, env.Logger)
+	servers := mcp.NewManager(cfg.MCPServers, workspaceRoot, env.Logger)
+	review := cfg.Permissions.ReviewEdits || opts.reviewEdits
+	return &setup{client: client, cfg: cfg, env: env, policy: policy, review: review, plugins: plugins, hooks: runner, mcp: servers, instructions: instructionFiles}, nil
+}
+
+// newPolicy creates the permission policy from config. The --permission-mode
+// flag wins over defaultMode, which wins over the configured mode.
+func newPolicy(cfg *config.Config, opts options, defaultMode permission.Mode) (*permission.Policy, error) {
+	modeName := cfg.Permissions.Mode
+	if defaultMode != "" {
+		modeName = string(defaultMode)
+	}
+	if opts.permissionMode != "" {
+		modeName = opts.permissionMode
+	}
+	mode, err := permission.ParseMode(modeName)
+	if err != nil {
+		return nil, err
+	}
+	return permission.NewPolicy(mode, cfg.Permissions.Allow, cfg.Permissions.Deny, nil)
+}
+
+// workspaceDir returns root as an absolute path to an existing directory,
+// or the current directory if root is empty
+func workspaceDir(root string) (string, error) {
+	if root == "" {
+		return os.Getwd()
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid workspace root: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid workspace root: %s is not a directory", abs)
+	}
+	return abs, nil
+}
+
+// startMCP connects to the configured MCP servers, warning about any that fail.
+// Their tools are given to agents created afterwards.
+func (s *setup) startMCP(ctx context.Context) {
+	for _, err := range s.mcp.Start(ctx) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
+	}
+}
+
+// mcpCommand is the /mcp command listing MCP servers and reconnecting them
+func (s *setup) mcpCommand(ctx context.Context, args string) (string, error) {
+	action, name, _ := strings.Cut(args, " ")
+	switch action {
+	case "":
+		return s.mcp.Status(), nil
+	case "reconnect":
+		if err := s.mcp.Reconnect(ctx, strings.TrimSpace(name)); err != nil {
+			return "", err
+		}
+		return s.mcp.Status(), nil
+	}
+	return "", fmt.Errorf("unknown action %q; use /mcp or /mcp reconnect [server]", action)
+}
+
+// permissionsCommand is the /permissions command showing and changing the
+// permission policy for the rest of the session
+func (s *setup) permissionsCommand(ctx context.Context, args string) (string, error) {
+	words, err := agent.SplitArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if len(words) == 0 {
+		allow, deny, always := s.policy.Rules()
+		var b strings.Builder
+		fmt.Fprintf(&b, "Mode: %s", s.policy.Mode())
+		if s.env.Reviewer != nil {
+			b.WriteString("\nFile edits are shown for review before they are written")
+		}
+		for _, rule := range allow {
+			fmt.Fprintf(&b, "\n  allow %s", rule)
+		}
+		for _, rule := range deny {
+			fmt.Fprintf(&b, "\n  deny  %s", rule)
+		}
+		for _, tool := range always {
+			fmt.Fprintf(&b, "\n  allow %s (for this session)", tool)
+		}
+		return b.String(), nil
+	}
+	if len(words) != 2 {
+		return "", fmt.Errorf("usage: /permissions [mode MODE | allow RULE | deny RULE]")
+	}
+
+	switch words[0] {
+	case "mode":
+		mode, err := permission.ParseMode(words[1])
+		if err != nil {
+			return "", err
+		}
+		s.policy.SetMode(mode)
+		return fmt.Sprintf("Permission mode is now %s.", mode), nil
+	case "allow", "deny":
+		rule, err := permission.ParseRule(words[1])
+		if err != nil {
+			return "", err
+		}
+		if words[0] == "allow" {
+			s.policy.AddAllow(rule)
+		} else {
+			s.policy.AddDeny(rule)
+		}
+		return fmt.Sprintf("Added %s rule %s for this session.", words[0], rule), nil
 	}
-	
-	client := anthropic.NewClient(option.WithAPIKey(apiKey))
+	return "", fmt.Errorf("unknown action %q; use mode, allow or deny", words[0])
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	getUserMessage := func() (string, bool) {
-		if !scanner.Scan() {
-			return "", false
+// completePermissions completes the /permissions actions and modes
+func completePermissions(args string) []string {
+	if mode, ok := strings.CutPrefix(args, "mode "); ok {
+		names := make([]string, len(permission.Modes))
+		for i, m := range permission.Modes {
+			names[i] = string(m)
+		}
+		return agent.CompleteFrom("mode "+mode, names)
+	}
+	if strings.Contains(args, " ") {
+		return nil
+	}
+	return agent.CompleteFrom(args, []string{"mode ", "allow ", "deny "})
+}
+
+// customCommandDirs are where custom slash commands are read from, user
+// commands first so project commands replace them
+func customCommandDirs(workspaceRoot string) []string {
+	var dirs []string
+	if dir, err := config.UserDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "commands"))
+	}
+	return append(dirs, filepath.Join(config.ProjectDir(workspaceRoot), "commands"))
+}
+
+// addCommands registers the commands that need the setup, and the user's
+// custom commands, warning about any that cannot be loaded
+func (s *setup) addCommands(codingAgent *agent.Agent) {
+	codingAgent.AddCommand(agent.Command{
+		Name:        "mcp",
+		Usage:       "[reconnect [server]]",
+		Description: "List MCP servers and their tools, or restart them",
+		Run:         s.mcpCommand,
+		Complete:    func(args string) []string { return agent.CompleteFrom(args, []string{"reconnect"}) },
+	})
+	codingAgent.AddCommand(agent.Command{
+		Name:        "permissions",
+		Usage:       "[mode MODE | allow RULE | deny RULE]",
+		Description: "Show the permission policy, or change it for this session",
+		Run:         s.permissionsCommand,
+		Complete:    completePermissions,
+	})
+
+	for _, dir := range customCommandDirs(s.env.WorkspaceRoot) {
+		cmds, err := agent.LoadCustomCommands(dir)
+		if err == nil {
+			err = codingAgent.AddCustomCommands(cmds)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
 		}
-		return scanner.Text(), true
 	}
+}
 
-	// Get all tools
-	toolDefinitions := tools.GetAllTools()
-	
-	// Create and run the agent
-	codingAgent := agent.NewAgent(&client, getUserMessage, toolDefinitions)
-	err := codingAgent.Run(context.TODO())
+// setReviewer has file edits reviewed in ui before they are written, when
+// the config or the --review-edits flag asks for it. Reviewed edits need no
+// approval beforehand.
+func (s *setup) setReviewer(ui review.UI) {
+	if !s.review {
+		return
+	}
+	s.env.Reviewer = &review.Reviewer{UI: ui, WorkspaceRoot: s.env.WorkspaceRoot}
+	s.policy.SetReviewEdits(true)
+}
+
+// newAgent creates an agent with every built-in, plugin and MCP tool and the
+// configured hooks, saving its session to the default store
+func (s *setup) newAgent(input agent.InputSource) *agent.Agent {
+	allTools := append(tools.GetAllTools(), s.plugins...)
+	allTools = append(allTools, s.mcp.Tools()...)
+	codingAgent := agent.NewAgent(&s.client, input, allTools, s.env, s.cfg)
+	codingAgent.SetHooks(s.hooks)
+	codingAgent.SetInstructions(s.instructions)
+	codingAgent.SetMemory(memory.Open(s.env.WorkspaceRoot))
+	if dir, err := session.DefaultDir(); err == nil {
+		codingAgent.SetSessionStore(session.NewStore(dir))
+	}
+	return codingAgent
+}
+
+// stdinIsTerminal reports whether stdin is an interactive terminal rather than a pipe or file
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return true
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// newLogger returns a logger writing to CODING_AGENT_LOG, or nil if it is unset
+func newLogger() *log.Logger {
+	path := os.Getenv("CODING_AGENT_LOG")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
+		fmt.Fprintf(os.Stderr, "Warning: could not open log file: %s\n", err.Error())
+		return nil
 	}
+	return log.New(f, "", log.LstdFlags)
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/mcp"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// runMCPServe serves the built-in tools to other MCP clients on stdin and
+// stdout. No API key is needed since Claude is not called.
+func runMCPServe(args []string) int {
+	flags := flag.NewFlagSet("mcp-serve", flag.ContinueOnError)
+	root := flags.String("root", "", "workspace the tools are confined to (default the current directory)")
+	permissionMode := flags.String("permission-mode", "", "permission mode: ask, accept-edits, allow-all or read-only (default from config)")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	workspaceRoot, err := workspaceDir(*root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	cfg, err := config.Load(workspaceRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	warnUntrusted(cfg, workspaceRoot)
+
+	// There is nobody to ask, so calls needing approval are denied unless
+	// an allow rule or the mode permits them
+	policy, err := newPolicy(cfg, options{permissionMode: *permissionMode}, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	env := &tools.Env{
+		WorkspaceRoot: workspaceRoot,
+		Permissions:   policy,
+		Logger:        newLogger(),
+		Confined:      true,
+		Todos:         tools.NewTodoList(),
+	}
+
+	if err := mcp.Serve(context.Background(), tools.GetAllTools(), env, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	return exitOK
+}
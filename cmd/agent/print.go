@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/markdown"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+	"golang.org/x/term"
+)
+
+// Print mode output formats
+const (
+	formatText       = "text"
+	formatJSON       = "json"
+	formatStreamJSON = "stream-json"
+)
+
+// printResult is the final JSON object written in the json and stream-json formats
+type printResult struct {
+	Type       string       `json:"type"`
+	SessionID  string       `json:"session_id"`
+	Result     string       `json:"result"`
+	StopReason string       `json:"stop_reason"`
+	IsError    bool         `json:"is_error"`
+	Error      string       `json:"error,omitempty"`
+	DurationMS int64        `json:"duration_ms"`
+	Usage      usage.Report `json:"usage"`
+}
+
+// runPrint runs a single prompt through the full tool loop without a terminal
+// UI and prints the final answer. Unless --permission-mode says otherwise, only
+// read-only tools may run, since nobody is there to approve anything else.
+func runPrint(opts options) int {
+	format := opts.outputFormat
+	if format != formatText && format != formatJSON && format != formatStreamJSON {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q (want text, json or stream-json)\n", format)
+		return exitUsage
+	}
+
+	prompt, err := readPrompt(opts.args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitUsage
+	}
+
+	s, err := newSetup(opts, permission.ModeReadOnly)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s.startMCP(ctx)
+	defer s.mcp.Close()
+
+	// Nobody can answer questions, so soft budget limits stop the run
+	codingAgent := s.newAgent(nil)
+	codingAgent.SetConfirm(func(string) bool { return false })
+	codingAgent.Subscribe(printEventHandler(format))
+	defer codingAgent.Close()
+
+	start := time.Now()
+	result, err := codingAgent.Prompt(ctx, prompt)
+
+	code := exitCode(ctx.Err() != nil, err)
+
+	if format == formatText {
+		if result.Text == "" {
+			return code
+		}
+		// Render the answer for a person reading it, but not for a pipe
+		if fd := int(os.Stdout.Fd()); term.IsTerminal(fd) {
+			fmt.Println(markdown.Render(result.Text, markdown.TerminalWidth(fd)))
+		} else {
+			fmt.Println(result.Text)
+		}
+		return code
+	}
+
+	out := printResult{
+		Type:       "result",
+		SessionID:  codingAgent.SessionID(),
+		Result:     result.Text,
+		StopReason: result.StopReason,
+		IsError:    err != nil,
+		DurationMS: time.Since(start).Milliseconds(),
+		Usage:      result.Usage,
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	if encErr := json.NewEncoder(os.Stdout).Encode(out); encErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", encErr.Error())
+		return exitError
+	}
+	return code
+}
+
+// exitCode returns the print mode exit status for a run that was interrupted
+// or ended with err
+func exitCode(interrupted bool, err error) int {
+	switch {
+	case interrupted:
+		return exitInterrupted
+	case errors.Is(err, agent.ErrBudgetExceeded):
+		return exitBudget
+	case err != nil:
+		return exitError
+	}
+	return exitOK
+}
+
+// readPrompt joins the prompt arguments with anything piped on stdin
+func readPrompt(args []string) (string, error) {
+	prompt := strings.TrimSpace(strings.Join(args, " "))
+	if !stdinIsTerminal() {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read stdin: %w", err)
+		}
+		if piped := strings.TrimSpace(string(data)); piped != "" {
+			if prompt == "" {
+				prompt = piped
+			} else {
+				prompt += "\n\n" + piped
+			}
+		}
+	}
+	if prompt == "" {
+		return "", fmt.Errorf("print mode needs a prompt, as arguments or on stdin")
+	}
+	return prompt, nil
+}
+
+// printEventHandler reports errors on stderr and, for stream-json, writes every
+// event to stdout as a line of JSON
+func printEventHandler(format string) agent.EventHandler {
+	var mu sync.Mutex
+	enc := json.NewEncoder(os.Stdout)
+	return func(e agent.Event) {
+		if e.Type == agent.EventError {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", e.Text)
+		}
+		if format != formatStreamJSON {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	}
+}
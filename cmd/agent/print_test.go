@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		interrupted bool
+		err         error
+		want        int
+	}{
+		{name: "success", want: exitOK},
+		{name: "error", err: errors.New("boom"), want: exitError},
+		{name: "budget", err: agent.ErrBudgetExceeded, want: exitBudget},
+		{name: "wrapped budget", err: fmt.Errorf("turn stopped: %w", agent.ErrBudgetExceeded), want: exitBudget},
+		{name: "interrupted", interrupted: true, err: context.Canceled, want: exitInterrupted},
+		{name: "interrupted over budget", interrupted: true, err: agent.ErrBudgetExceeded, want: exitInterrupted},
+	}
+	for _, test := range tests {
+		if got := exitCode(test.interrupted, test.err); got != test.want {
+			t.Errorf("%s: exitCode = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
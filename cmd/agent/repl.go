@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/plan"
+	"github.com/ttli3/terminal-coding-agent/pkg/review"
+)
+
+// runREPL chats with the agent interactively on the terminal
+func runREPL(opts options) int {
+	s, err := newSetup(opts, "")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return exitError
+	}
+
+	s.startMCP(context.Background())
+	defer s.mcp.Close()
+
+	// Tab completes slash commands once the agent has registered them
+	var codingAgent *agent.Agent
+	input := newInput(func(line string) []string { return codingAgent.Complete(line) }, openHistory(s.env.WorkspaceRoot))
+	s.policy.SetAsker(terminalAsker{input: input})
+	s.setReviewer(terminalReviewUI{input: input})
+
+	// Create and run the agent, showing its events on the terminal
+	codingAgent = s.newAgent(input)
+	codingAgent.SetPlanApprover(&plan.Approver{UI: terminalReviewUI{input: input}})
+	codingAgent.SetPlanning(opts.plan)
+	codingAgent.Subscribe(agent.NewTerminalPrinter(os.Stdout).Handle)
+	s.addCommands(codingAgent)
+
+	// Ctrl-C interrupts the current turn; a second one in quick succession
+	// ends the session, which then shuts down as it does on /exit
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	go handleInterrupts(signals, codingAgent, cancel)
+
+	err = codingAgent.Run(ctx)
+	if ctx.Err() != nil {
+		return exitInterrupted
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return exitError
+	}
+	return exitOK
+}
+
+// exitWindow is how soon a second ctrl-c must follow the first to exit
+const exitWindow = 2 * time.Second
+
+// handleInterrupts cancels the running turn on ctrl-c and ends the session
+// with exit on a double ctrl-c. After that it stops listening, so a further
+// ctrl-c kills the process if shutting down hangs.
+func handleInterrupts(signals chan os.Signal, codingAgent *agent.Agent, exit context.CancelFunc) {
+	var last time.Time
+	for range signals {
+		if time.Since(last) < exitWindow {
+			fmt.Println()
+			signal.Stop(signals)
+			exit()
+			return
+		}
+		last = time.Now()
+
+		if codingAgent.Interrupt() {
+			fmt.Print("\r\033[K")
+			continue
+		}
+		fmt.Print("\n(press ctrl-c again to exit)\nYou: ")
+	}
+}
+
+// terminalAsker asks for tool call approval on the terminal
+type terminalAsker struct {
+	input lineReader
+}
+
+// AskPermission implements permission.Asker
+func (t terminalAsker) AskPermission(ctx context.Context, req permission.Request) (permission.Decision, error) {
+	subject := req.Subject
+	if subject == "" {
+		subject = string(req.Input)
+	}
+	answer, ok := t.input.ReadAnswer(fmt.Sprintf("\u001b[93mAllow\u001b[0m %s(%s)? [y]es / [n]o / [a] %s: ", req.Tool, subject, req.AlwaysLabel()))
+	if !ok {
+		return permission.Deny, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return permission.Allow, nil
+	case "a", "always":
+		return permission.AllowAlways, nil
+	default:
+		return permission.Deny, nil
+	}
+}
+
+// terminalReviewUI reviews file edits and plans on the terminal
+type terminalReviewUI struct {
+	input lineReader
+}
+
+// Choose implements review.UI, asking again until one of the choices is given
+func (t terminalReviewUI) Choose(ctx context.Context, title string, body []string, choices []review.Choice) (rune, error) {
+	fmt.Printf("\u001b[1m%s\u001b[0m\n%s\n", title, strings.Join(body, "\n"))
+	labels := make([]string, len(choices))
+	for i, c := range choices {
+		labels[i] = fmt.Sprintf("[%c]%s", c.Key, c.Label[1:])
+	}
+	prompt := strings.Join(labels, " / ") + ": "
+	for {
+		answer, ok := t.input.ReadAnswer(prompt)
+		if !ok {
+			return 0, errors.New("input ended during the review")
+		}
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		for _, c := range choices {
+			if answer == string(c.Key) || answer == c.Label {
+				return c.Key, nil
+			}
+		}
+	}
+}
+
+// Ask implements review.UI
+func (t terminalReviewUI) Ask(ctx context.Context, prompt string) (string, error) {
+	answer, ok := t.input.ReadAnswer(prompt + ": ")
+	if !ok {
+		return "", nil
+	}
+	return answer, ctx.Err()
+}
+
+// RunEditor implements review.UI
+func (t terminalReviewUI) RunEditor(cmd *exec.Cmd) error {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
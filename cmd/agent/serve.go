@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/server"
+	"github.com/ttli3/terminal-coding-agent/pkg/session"
+)
+
+// runServe runs the agent headless for editors and other programs to drive
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	stdio := flags.Bool("stdio", false, "speak JSON-RPC 2.0 on stdin and stdout, one message per line")
+	httpAddr := flags.String("http", "", "serve a REST API with Server-Sent Events on this address, e.g. :8080")
+	token := flags.String("token", os.Getenv("CODING_AGENT_TOKEN"), "bearer token HTTP clients must send (default $CODING_AGENT_TOKEN, or a random one)")
+	permissionMode := flags.String("permission-mode", "", "default permission mode for sessions (default ask)")
+	model := flags.String("model", "", "default Claude model for sessions")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *stdio == (*httpAddr != "") {
+		fmt.Fprintln(os.Stderr, "Error: serve needs either --stdio or --http ADDRESS")
+		return exitUsage
+	}
+
+	client, err := newClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+
+	// Every session gets its own workspace, config, permission policy and MCP
+	// servers, which are stopped when it is closed; tool calls that need
+	// approval are sent to the client
+	factory := func(id string, so server.SessionOptions, asker permission.Asker) (*agent.Agent, error) {
+		opts := options{model: *model, permissionMode: *permissionMode}
+		if so.Model != "" {
+			opts.model = so.Model
+		}
+		if so.PermissionMode != "" {
+			opts.permissionMode = so.PermissionMode
+		}
+		s, err := newSessionSetup(client, opts, so.WorkspaceRoot, permission.ModeAsk)
+		if err != nil {
+			return nil, err
+		}
+		s.env.SessionID = id
+		s.policy.SetAsker(asker)
+		s.startMCP(context.Background())
+
+		codingAgent := s.newAgent(nil)
+		codingAgent.SetConfirm(func(string) bool { return false })
+		codingAgent.OnClose(s.mcp.Close)
+		return codingAgent, nil
+	}
+
+	var store *session.Store
+	if dir, err := session.DefaultDir(); err == nil {
+		store = session.NewStore(dir)
+	}
+	manager := server.NewManager(factory, store)
+
+	if *httpAddr != "" {
+		return serveHTTP(manager, *httpAddr, *token)
+	}
+	if err := server.ServeStdio(context.Background(), manager, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	return exitOK
+}
+
+// shutdownTimeout is how long the HTTP server waits for requests when stopping
+const shutdownTimeout = 10 * time.Second
+
+// serveHTTP serves the REST API until interrupted, then interrupts running
+// turns and waits for them to save their sessions
+func serveHTTP(manager *server.Manager, addr, token string) int {
+	if token == "" {
+		token = session.NewID() + session.NewID()
+		fmt.Fprintf(os.Stderr, "Bearer token: %s\n", token)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	httpServer := server.NewHTTPServer(ctx, manager, token)
+	srv := &http.Server{Addr: addr, Handler: httpServer.Handler()}
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", addr)
+
+	select {
+	case err := <-errs:
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	case <-ctx.Done():
+	}
+
+	manager.InterruptAll()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+	}
+	httpServer.Wait()
+	manager.CloseAll()
+	return exitOK
+}
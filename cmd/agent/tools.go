@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/plugin"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// toolsUsage describes the tools subcommand
+const toolsUsage = `usage: coding-agent tools [list]
+       coding-agent tools validate
+       coding-agent tools dry-run NAME [JSON]    (input from stdin if JSON is omitted)`
+
+// runTools implements the tools subcommand, which lists the built-in and
+// plugin tools, validates plugin declarations and runs a plugin by hand
+func runTools(args []string) int {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	workspaceRoot, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	cfg, err := config.Load(workspaceRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	warnUntrusted(cfg, workspaceRoot)
+
+	switch action {
+	case "list":
+		return listTools(cfg)
+	case "validate":
+		return validateTools(cfg, workspaceRoot)
+	case "dry-run":
+		if len(args) == 0 || len(args) > 2 {
+			fmt.Fprintln(os.Stderr, toolsUsage)
+			return exitUsage
+		}
+		return dryRunTool(cfg, workspaceRoot, args[0], args[1:])
+	}
+	fmt.Fprintln(os.Stderr, toolsUsage)
+	return exitUsage
+}
+
+// listTools prints every built-in and plugin tool
+func listTools(cfg *config.Config) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tREAD-ONLY\tDESCRIPTION")
+	for _, def := range tools.GetAllTools() {
+		fmt.Fprintf(w, "%s\tbuilt-in\t%t\t%s\n", def.Name, def.ReadOnly, firstLine(def.Description))
+	}
+	for _, name := range plugin.Names(cfg.Tools) {
+		spec := cfg.Tools[name]
+		source := "plugin: " + spec.Command
+		if spec.Disabled {
+			source += " (disabled)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", name, source, spec.ReadOnly, firstLine(spec.Description))
+	}
+	w.Flush()
+	return exitOK
+}
+
+// validateTools checks every plugin declaration, exiting with an error if any is invalid
+func validateTools(cfg *config.Config, workspaceRoot string) int {
+	if len(cfg.Tools) == 0 {
+		fmt.Println("No plugin tools configured.")
+		return exitOK
+	}
+	code := exitOK
+	for _, name := range plugin.Names(cfg.Tools) {
+		spec := cfg.Tools[name]
+		if spec.Disabled {
+			fmt.Printf("%s: disabled\n", name)
+			continue
+		}
+		_, errs := plugin.Load(map[string]config.PluginTool{name: spec}, workspaceRoot, tools.GetAllTools())
+		if len(errs) > 0 {
+			fmt.Printf("%s: %s\n", name, errs[0].Error())
+			code = exitError
+			continue
+		}
+		fmt.Printf("%s: ok\n", name)
+	}
+	return code
+}
+
+// dryRunTool runs one plugin with the given input, outside any agent session
+// and without permission checks, and prints what Claude would see
+func dryRunTool(cfg *config.Config, workspaceRoot, name string, args []string) int {
+	spec, ok := cfg.Tools[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: no plugin tool named %s\n", name)
+		return exitError
+	}
+	def, err := plugin.New(name, spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+
+	input := "{}"
+	if len(args) > 0 {
+		input = args[0]
+	} else if !stdinIsTerminal() {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			return exitError
+		}
+		input = strings.TrimSpace(string(data))
+	}
+	if !json.Valid([]byte(input)) {
+		fmt.Fprintf(os.Stderr, "Error: input is not valid JSON: %s\n", input)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	env := &tools.Env{WorkspaceRoot: workspaceRoot, Logger: newLogger()}
+	start := time.Now()
+	output, err := def.Function(ctx, env, json.RawMessage(input))
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error after %s: %s\n", elapsed, err.Error())
+		return exitError
+	}
+	fmt.Println(output)
+	fmt.Fprintf(os.Stderr, "(%s in %s)\n", name, elapsed)
+	return exitOK
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
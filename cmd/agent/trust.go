@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+)
+
+// runTrust implements the trust subcommand, which trusts the project config
+// of the current directory so its hooks, tools, MCP servers and permissions
+// are used
+func runTrust(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: coding-agent trust")
+		return exitUsage
+	}
+	workspaceRoot, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	cfg, err := config.Load(workspaceRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	if len(cfg.Untrusted()) == 0 {
+		fmt.Println("Nothing to trust: the project config sets no hooks, tools, MCP servers or permissions, or they are trusted already.")
+		return exitOK
+	}
+	if err := config.Trust(workspaceRoot); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		return exitError
+	}
+	fmt.Printf("Trusted these settings of %s:\n%s\n", projectConfigPath(workspaceRoot), cfg.UntrustedSettings())
+	return exitOK
+}
+
+// askTrust shows the privileged settings of the workspace's project config
+// that are not trusted yet and asks on the terminal whether to trust them
+func askTrust(workspaceRoot string) error {
+	cfg, err := config.Load(workspaceRoot)
+	if err != nil || len(cfg.Untrusted()) == 0 {
+		return err
+	}
+	fmt.Printf("\u001b[93m%s sets %s, which run commands or change permissions:\u001b[0m\n%s\n",
+		projectConfigPath(workspaceRoot), strings.Join(cfg.Untrusted(), ", "), cfg.UntrustedSettings())
+	fmt.Print("Trust this workspace and use them? [y/N] ")
+	answer := strings.ToLower(strings.TrimSpace(readLine()))
+	if answer != "y" && answer != "yes" {
+		return nil
+	}
+	return config.Trust(workspaceRoot)
+}
+
+// warnUntrusted says which project settings are ignored until the workspace is trusted
+func warnUntrusted(cfg *config.Config, workspaceRoot string) {
+	if untrusted := cfg.Untrusted(); len(untrusted) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring %s in %s until you trust this workspace with `coding-agent trust`\n",
+			strings.Join(untrusted, ", "), projectConfigPath(workspaceRoot))
+	}
+}
+
+// projectConfigPath returns the path of the workspace's project config
+func projectConfigPath(workspaceRoot string) string {
+	return filepath.Join(config.ProjectDir(workspaceRoot), config.FileName)
+}
+
+// readLine reads a line from stdin a byte at a time, so nothing typed after
+// it is buffered away from the line editor
+func readLine() string {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 0 || err != nil || b[0] == '\n' {
+			return string(line)
+		}
+		line = append(line, b[0])
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/plan"
+	"github.com/ttli3/terminal-coding-agent/pkg/tui"
+)
+
+// runTUI chats with the agent in the full-screen interface
+func runTUI(opts options) int {
+	if !stdinIsTerminal() {
+		fmt.Fprintln(os.Stderr, "Error: --tui needs an interactive terminal")
+		return exitUsage
+	}
+	s, err := newSetup(opts, "")
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return exitError
+	}
+
+	s.startMCP(context.Background())
+	defer s.mcp.Close()
+
+	// The interface reads the agent's state once the agent is created
+	var codingAgent *agent.Agent
+	app := tui.New(os.Stdin, os.Stdout, tui.Options{
+		Status: func() tui.Status {
+			mode := string(s.policy.Mode())
+			if codingAgent.Planning() {
+				mode = "plan"
+			}
+			return tui.Status{
+				Usage:          codingAgent.Usage(),
+				PermissionMode: mode,
+				WorkspaceRoot:  s.env.WorkspaceRoot,
+			}
+		},
+		Interrupt: func() bool { return codingAgent.Interrupt() },
+		Complete:  func(line string) []string { return codingAgent.Complete(line) },
+		History:   openHistory(s.env.WorkspaceRoot),
+		Env:       s.env,
+	})
+	s.policy.SetAsker(app)
+	s.setReviewer(app)
+
+	codingAgent = s.newAgent(app)
+	codingAgent.SetPlanApprover(&plan.Approver{UI: app})
+	codingAgent.SetPlanning(opts.plan)
+	codingAgent.Subscribe(app.Handle)
+	s.addCommands(codingAgent)
+
+	if err := app.Run(context.Background(), codingAgent.Run); err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return exitError
+	}
+	return exitOK
+}
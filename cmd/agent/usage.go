@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/session"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+// runUsage implements the usage subcommand, aggregating token usage across saved sessions
+func runUsage(args []string) error {
+	flags := flag.NewFlagSet("usage", flag.ExitOnError)
+	days := flags.Int("days", 0, "only include sessions updated in the last N days")
+	here := flags.Bool("here", false, "only include sessions started in the current directory")
+	flags.Parse(args)
+
+	dir, err := session.DefaultDir()
+	if err != nil {
+		return err
+	}
+	sessions, err := session.NewStore(dir).List()
+	if err != nil {
+		return err
+	}
+
+	cwd, _ := os.Getwd()
+	var since time.Time
+	if *days > 0 {
+		since = time.Now().AddDate(0, 0, -*days)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tUPDATED\tMODEL\tREQUESTS\tINPUT\tOUTPUT\tCACHE READ\tCACHE WRITE\tCOST")
+
+	var total usage.Usage
+	var totalCost float64
+	for _, sess := range sessions {
+		if sess.UpdatedAt.Before(since) || (*here && sess.WorkspaceRoot != cwd) {
+			continue
+		}
+		total = total.Add(sess.Usage)
+		totalCost += sess.Cost
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			sess.ID, sess.UpdatedAt.Format("2006-01-02 15:04"), sess.Model, sess.Usage.Requests,
+			usage.FormatTokens(sess.Usage.InputTokens), usage.FormatTokens(sess.Usage.OutputTokens),
+			usage.FormatTokens(sess.Usage.CacheReadTokens), usage.FormatTokens(sess.Usage.CacheWriteTokens),
+			usage.FormatCost(sess.Cost))
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t%d\t%s\t%s\t%s\t%s\t%s\n", total.Requests,
+		usage.FormatTokens(total.InputTokens), usage.FormatTokens(total.OutputTokens),
+		usage.FormatTokens(total.CacheReadTokens), usage.FormatTokens(total.CacheWriteTokens),
+		usage.FormatCost(totalCost))
+	return w.Flush()
+}
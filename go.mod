@@ -3,14 +3,17 @@ module github.com/ttli3/terminal-coding-agent
 go 1.24.2
 
 require (
+	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/anthropics/anthropic-sdk-go v0.2.0-beta.3
 	github.com/invopop/jsonschema v0.13.0
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/term v0.30.0
 )
 
 require (
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/sergi/go-diff v1.3.1 // indirect
 	github.com/tidwall/gjson v1.14.4 // indirect
@@ -18,5 +21,6 @@ require (
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
 	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
+	golang.org/x/sys v0.31.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -3,194 +3,485 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/hooks"
+	"github.com/ttli3/terminal-coding-agent/pkg/instructions"
+	"github.com/ttli3/terminal-coding-agent/pkg/memory"
+	"github.com/ttli3/terminal-coding-agent/pkg/plan"
+	"github.com/ttli3/terminal-coding-agent/pkg/session"
 	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
 )
 
+// ErrInterrupted is returned when the user interrupts a turn
+var ErrInterrupted = errors.New("turn interrupted")
+
+// interruptedMessage is recorded in the conversation when a turn is cut short
+const interruptedMessage = "[Request interrupted by user]"
+
 // Agent represents the coding agent
 type Agent struct {
-	client         *anthropic.Client
-	getUserMessage func() (string, bool)
-	tools          []tools.ToolDefinition
+	client       *anthropic.Client
+	input        InputSource
+	tools        []tools.ToolDefinition
+	env          *tools.Env
+	config       *config.Config
+	model        anthropic.Model
+	store        *session.Store
+	retryPolicy  RetryPolicy
+	tracker      *usage.Tracker
+	budget       *budget
+	confirmFunc  func(question string) bool
+	planApprover PlanApprover
+	subAgent     bool // started by delegate, so it may not delegate in turn
+	instructions *instructions.Set
+	memory       *memory.Memory
+	hooks        *hooks.Runner
+	createdAt    time.Time
+
+	mu             sync.Mutex
+	conversation   []anthropic.MessageParam
+	cancelTurn     context.CancelFunc
+	subscribers    []subscriber
+	nextSubscriber int
+	commands       map[string]Command
+	pendingNotes   []string
+	planning       bool
+	plan           *plan.Plan
+	memoryLoaded   bool
+	memoryText     string
+	started        bool
+	closed         bool
+	onClose        []func()
 }
 
-// NewAgent creates a new agent
-func NewAgent(client *anthropic.Client, getUserMessage func() (string, bool), tools []tools.ToolDefinition) *Agent {
-	return &Agent{
-		client:         client,
-		getUserMessage: getUserMessage,
-		tools:          tools,
+// Result is the outcome of a single prompt
+type Result struct {
+	Text       string       `json:"result"`
+	StopReason string       `json:"stop_reason"`
+	Usage      usage.Report `json:"usage"`
+}
+
+// NewAgent creates a new agent. input may be nil for agents that are only
+// driven through Prompt; nothing is shown to the user until a UI subscribes
+// to the agent's events.
+func NewAgent(client *anthropic.Client, input InputSource, tools []tools.ToolDefinition, env *tools.Env, cfg *config.Config) *Agent {
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	a := &Agent{
+		client:      client,
+		input:       input,
+		tools:       tools,
+		env:         env,
+		config:      cfg,
+		model:       anthropic.Model(cfg.Model),
+		retryPolicy: DefaultRetryPolicy,
+		tracker:     usage.NewTracker(cfg.Model, cfg.PriceTable()),
+		budget:      newBudget(cfg.Limits),
+		createdAt:   time.Now(),
 	}
+	a.addBuiltinCommands()
+	a.trackTodos()
+	return a
 }
 
-// Run starts the agent
-func (a *Agent) Run(ctx context.Context) error {
-	fmt.Println("doChat with Claude (use 'ctrl-c' to quit)")
+// SetSessionStore makes the agent persist its conversation to store
+func (a *Agent) SetSessionStore(store *session.Store) {
+	a.store = store
+}
+
+// SetConfirm replaces how the agent asks the user yes/no questions
+func (a *Agent) SetConfirm(confirm func(question string) bool) {
+	a.confirmFunc = confirm
+}
+
+// Resume continues a saved session, replacing the agent's conversation and
+// session totals with the saved ones
+func (a *Agent) Resume(sess *session.Session) {
+	a.mu.Lock()
+	a.conversation = session.ToParams(sess.Messages)
+	a.plan = sess.Plan
+	a.mu.Unlock()
+	a.env.Todos.Restore(sess.Todos)
 
-	// Initialize the conversation
-	conversation := []anthropic.MessageParam{
-		{
-			Role: "user",
-			Content: []anthropic.ContentBlockParam{
-				{
-					Type: "text",
-					Text: "You are a coding assistant. You can help me with programming tasks. I'll give you tasks, and you can use tools to help me complete them.",
-				},
-			},
-		},
+	a.env.SessionID = sess.ID
+	a.createdAt = sess.CreatedAt
+	a.tracker.Restore(sess.Usage, sess.Cost)
+}
+
+// Run chats with the user, reading messages from the agent's input until it
+// ends or ctx is cancelled
+func (a *Agent) Run(ctx context.Context) error {
+	if a.input == nil {
+		return errors.New("agent has no input source")
 	}
+	a.notice("Chat with Claude (use 'ctrl-c' to interrupt a reply, twice to quit)")
+	if a.instructions != nil && len(a.instructions.Files()) > 0 {
+		a.noticeInstructions("Using instructions from")
+	}
+	a.startSession(ctx)
+
+	defer a.Close()
+	defer a.SaveSession()
+	defer a.printSessionSummary()
 
 	// Main conversation loop
-	for {
+	for ctx.Err() == nil {
 		// Get user message
-		fmt.Print("You: ")
-		userMsg, ok := a.getUserMessage()
-		if !ok {
+		prompt := "You: "
+		if a.Planning() {
+			prompt = "You (plan): "
+		}
+		userMsg, ok := a.input.ReadLine(prompt)
+		if !ok || ctx.Err() != nil {
 			break
 		}
 
-		// Add user message to conversation
-		conversation = append(conversation, anthropic.MessageParam{
-			Role: "user",
-			Content: []anthropic.ContentBlockParam{
-				{
-					Type: "text",
-					Text: userMsg,
-				},
-			},
-		})
+		handled, err := a.runCommand(ctx, userMsg)
+		if errors.Is(err, ErrExit) {
+			break
+		}
+		if handled {
+			continue
+		}
 
-		// Get response from Claude
-		msg, err := a.runInference(ctx, conversation)
-		if err != nil {
+		if _, err := a.Prompt(ctx, userMsg); err != nil && ctx.Err() != nil {
 			return err
 		}
+	}
 
-		// Add Claude's response to conversation
-		conversation = append(conversation, anthropic.MessageParam{
-			Role: "assistant",
-			Content: msg.Content,
-		})
+	return ctx.Err()
+}
+
+// Prompt sends a user message and runs the tool loop until Claude is done.
+// Failed turns are reported as events and leave the conversation consistent,
+// so the session can carry on with another prompt.
+func (a *Agent) Prompt(ctx context.Context, text string) (*Result, error) {
+	a.startSession(ctx)
+
+	// Hooks may block the prompt or add context to it
+	hookResult := a.runHooks(ctx, hooks.Payload{Event: hooks.UserPromptSubmitted, Prompt: text})
+	if hookResult.Blocked {
+		a.emit(Event{Type: EventError, Text: fmt.Sprintf("Prompt blocked: %s", hookResult.Reason)})
+		return &Result{StopReason: StopBlocked, Usage: a.tracker.Report()}, fmt.Errorf("%w: %s", ErrPromptBlocked, hookResult.Reason)
+	}
+	message := text
+	if hookResult.Output != "" {
+		message += "\n\n" + hookResult.Output
+	}
+	for _, note := range a.takeNotes() {
+		message = fmt.Sprintf("[%s]\n\n%s", note, message)
+	}
+
+	// Add user message to conversation
+	turnStart := len(a.messages())
+	a.appendMessage(anthropic.NewUserMessage(anthropic.NewTextBlock(message)))
+
+	a.emit(Event{Type: EventTurnStarted, Text: text})
+	final, err := a.runTurn(ctx)
+
+	stopReason := StopEndTurn
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		stopReason = StopInterrupted
+		a.notice("Interrupted.")
+	case errors.Is(err, ErrBudgetExceeded):
+		stopReason = StopBudget
+		a.rollbackFailedTurn(turnStart)
+	case err != nil:
+		// Report the failure and keep the session going
+		stopReason = StopError
+		if ctx.Err() == nil {
+			a.emit(Event{Type: EventError, Text: classifyError(err).UserMessage()})
+		}
+		a.rollbackFailedTurn(turnStart)
+	}
 
-		// Print Claude's response
-		fmt.Println("Claude:", a.formatResponse(msg))
+	if saveErr := a.SaveSession(); saveErr != nil {
+		a.notice(fmt.Sprintf("Warning: failed to save session: %s", saveErr.Error()))
 	}
 
-	return nil
+	result := &Result{Text: final, StopReason: stopReason, Usage: a.tracker.Report()}
+	a.emit(Event{Type: EventTurnEnded, Text: final, StopReason: stopReason, Usage: &result.Usage})
+	a.runHooks(context.WithoutCancel(ctx), hooks.Payload{Event: hooks.TurnEnd, Prompt: text, Response: final, StopReason: stopReason})
+	return result, err
 }
 
-// executeTool executes a tool and returns the result
-func (a *Agent) executeTool(id, name string, input json.RawMessage) anthropic.ContentBlockParam {
-	// Find the tool
-	var tool *tools.ToolDefinition
-	for _, t := range a.tools {
-		if t.Name == name {
-			tool = &t
-			break
+// runTurn calls Claude until it stops asking for tools or the turn is
+// interrupted, returning the text of Claude's last response
+func (a *Agent) runTurn(ctx context.Context) (string, error) {
+	turnCtx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.cancelTurn = cancel
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.cancelTurn = nil
+		a.mu.Unlock()
+		cancel()
+	}()
+
+	var final string
+	a.tracker.StartTurn()
+	a.budget.startTurn()
+	for {
+		if err := a.enforceBudget(nil); err != nil {
+			return final, err
+		}
+
+		msg, err := a.runInference(turnCtx, a.messages())
+		if err != nil {
+			if turnCtx.Err() != nil && ctx.Err() == nil {
+				a.appendMessage(anthropic.NewUserMessage(anthropic.NewTextBlock(interruptedMessage)))
+				return final, ErrInterrupted
+			}
+			return final, err
+		}
+		a.tracker.Add(string(msg.Model), usage.FromAPI(msg.Usage))
+		a.emitUsage()
+
+		// Add Claude's response to conversation
+		a.appendMessage(msg.ToParam())
+
+		// Report Claude's response
+		if text := a.formatResponse(msg); text != "" {
+			final = text
+			a.emit(Event{Type: EventText, Text: text})
+		}
+
+		// Execute any requested tools; every tool_use gets a result even when interrupted
+		calls := toolCalls(msg)
+		if len(calls) == 0 {
+			return final, nil
+		}
+		for _, call := range calls {
+			a.emit(Event{Type: EventToolRequested, ToolID: call.ID, ToolName: call.Name, Input: call.Input})
+		}
+		if err := a.enforceBudget(calls); err != nil {
+			a.appendMessage(anthropic.NewUserMessage(a.skipToolCalls(calls, err)...))
+			return final, err
+		}
+		toolResults := a.executeTools(turnCtx, calls)
+		a.appendMessage(anthropic.NewUserMessage(toolResults...))
+
+		if turnCtx.Err() != nil && ctx.Err() == nil {
+			return final, ErrInterrupted
 		}
 	}
+}
 
+// Interrupt cancels the turn in progress, reporting whether there was one
+func (a *Agent) Interrupt() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cancelTurn == nil {
+		return false
+	}
+	a.cancelTurn()
+	a.cancelTurn = nil
+	return true
+}
+
+// SessionID returns the identifier of the agent's session
+func (a *Agent) SessionID() string {
+	return a.env.SessionID
+}
+
+// WorkspaceRoot returns the directory the agent's tools work in
+func (a *Agent) WorkspaceRoot() string {
+	return a.env.WorkspaceRoot
+}
+
+// SaveSession flushes the conversation to the session store, if one is set
+func (a *Agent) SaveSession() error {
+	messages := a.messages()
+	if a.store == nil || len(messages) == 0 {
+		return nil
+	}
+
+	report := a.tracker.Report()
+	sess := &session.Session{
+		ID:            a.env.SessionID,
+		WorkspaceRoot: a.env.WorkspaceRoot,
+		CreatedAt:     a.createdAt,
+		UpdatedAt:     time.Now(),
+		Model:         string(a.currentModel()),
+		Usage:         report.Session,
+		Cost:          report.SessionCost,
+		Messages:      session.FromParams(messages),
+		Plan:          a.Plan(),
+		Todos:         a.env.Todos.Items(),
+	}
+	return a.store.Save(sess)
+}
+
+// History returns the conversation so far in its stored form
+func (a *Agent) History() []session.Message {
+	return session.FromParams(a.messages())
+}
+
+// Usage returns a snapshot of the tokens used and their estimated cost
+func (a *Agent) Usage() usage.Report {
+	return a.tracker.Report()
+}
+
+// costCommand shows the usage of the last turn and of the whole session
+func (a *Agent) costCommand(ctx context.Context, args string) (string, error) {
+	report := a.tracker.Report()
+	var s strings.Builder
+	fmt.Fprintf(&s, "Last turn:  %s · %s\n", report.Turn, usage.FormatCost(report.TurnCost))
+	fmt.Fprintf(&s, "Session:    %s · %s\n", report.Session, usage.FormatCost(report.SessionCost))
+	fmt.Fprintf(&s, "Requests:   %d (model %s)", report.Session.Requests, report.Model)
+	if a.config.PromptCaching {
+		fmt.Fprintf(&s, "\nCache hits: %.0f%% of input tokens read from cache", report.Session.CacheHitRate()*100)
+	}
+	return s.String(), nil
+}
+
+// printSessionSummary shows the session's usage when the agent exits
+func (a *Agent) printSessionSummary() {
+	report := a.tracker.Report()
+	if report.Session.Requests == 0 {
+		return
+	}
+	a.notice(fmt.Sprintf("\nSession %s: %d requests, %s · %s",
+		a.env.SessionID, report.Session.Requests, report.Session, usage.FormatCost(report.SessionCost)))
+}
+
+// rollbackFailedTurn drops the user message of a turn that failed before Claude
+// replied, so it is not sent again alongside the next message
+func (a *Agent) rollbackFailedTurn(turnStart int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.conversation) == turnStart+1 {
+		a.conversation = a.conversation[:turnStart]
+	}
+}
+
+// appendMessage adds a message to the conversation
+func (a *Agent) appendMessage(msg anthropic.MessageParam) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.conversation = append(a.conversation, msg)
+}
+
+// messages returns a snapshot of the conversation
+func (a *Agent) messages() []anthropic.MessageParam {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]anthropic.MessageParam(nil), a.conversation...)
+}
+
+// executeTool executes a tool and returns its output, whether it failed and
+// the error that stopped it, if any
+func (a *Agent) executeTool(ctx context.Context, id, name string, input json.RawMessage) (string, bool, error) {
+	// Find the tool
+	tool := a.findTool(name)
 	if tool == nil {
-		return anthropic.ContentBlockParam{
-			Type: "tool_result",
-			ToolResult: &anthropic.ToolResultBlockParam{
-				ToolUseID: id,
-				Content:   fmt.Sprintf("Error: Tool %s not found", name),
-			},
-		}
+		return fmt.Sprintf("Error: Tool %s not found", name), true, nil
 	}
 
-	// Execute the tool
-	result, err := tool.Function(input)
-	if err != nil {
-		return anthropic.ContentBlockParam{
-			Type: "tool_result",
-			ToolResult: &anthropic.ToolResultBlockParam{
-				ToolUseID: id,
-				Content:   fmt.Sprintf("Error: %s", err.Error()),
-			},
-		}
+	// Hooks may block the call or rewrite its input before permission is checked
+	pre := a.runHooks(ctx, hooks.Payload{Event: hooks.PreToolUse, ToolName: name, ToolInput: input})
+	if pre.Blocked {
+		a.emit(Event{Type: EventToolDenied, ToolID: id, ToolName: name, Text: pre.Reason})
+		return fmt.Sprintf("Error: blocked by hook: %s", pre.Reason), true, nil
+	}
+	if pre.Input != nil {
+		input = pre.Input
 	}
 
-	return anthropic.ContentBlockParam{
-		Type: "tool_result",
-		ToolResult: &anthropic.ToolResultBlockParam{
-			ToolUseID: id,
-			Content:   result,
-		},
+	// Check the call is allowed before running it
+	if err := a.env.CheckPermission(ctx, tool, input); err != nil {
+		a.emit(Event{Type: EventToolDenied, ToolID: id, ToolName: name, Text: err.Error()})
+		return fmt.Sprintf("Error: %s", err.Error()), true, err
 	}
+	a.emit(Event{Type: EventToolApproved, ToolID: id, ToolName: name})
+
+	// Execute the tool, reporting its output as progress while it runs
+	a.emit(Event{Type: EventToolStarted, ToolID: id, ToolName: name, Input: input})
+	progress := newProgressWriter(func(line string) {
+		a.emit(Event{Type: EventToolProgress, ToolID: id, ToolName: name, Text: line})
+	})
+	result, err := tool.Function(ctx, a.env.WithOutput(progress), input)
+	progress.Flush()
+	isError := err != nil
+	if isError {
+		result = fmt.Sprintf("Error: %s", err.Error())
+	}
+
+	// What post hooks say, such as formatter or linter output, goes back to Claude
+	post := a.runHooks(ctx, hooks.Payload{Event: hooks.PostToolUse, ToolName: name, ToolInput: input, ToolOutput: result, ToolError: isError})
+	if post.Output != "" {
+		result += "\n\nHook output:\n" + post.Output
+	}
+	if post.Blocked {
+		result += "\n\nHook feedback:\n" + post.Reason
+	}
+	return result, isError, err
 }
 
 // runInference runs the inference with Claude
 func (a *Agent) runInference(ctx context.Context, conversation []anthropic.MessageParam) (*anthropic.Message, error) {
-	// Convert tools to the format expected by Claude
-	var anthropicTools []anthropic.ToolUnionParam
-	for _, tool := range a.tools {
-		anthropicTools = append(anthropicTools, anthropic.ToolUnionParam{
-			OfTool: &anthropic.ToolParam{
-				Name:        tool.Name,
-				Description: anthropic.String(tool.Description),
-				InputSchema: tool.InputSchema,
-			},
-		})
-	}
-
-	// Create a channel to receive the API response
-	resultCh := make(chan struct {
-		message *anthropic.Message
-		err     error
-	})
+	params := a.buildParams(conversation)
 
-	// Start the API call in a goroutine
-	go func() {
-		message, err := a.client.Messages.New(ctx, anthropic.MessageNewParams{
-			Model:     anthropic.ModelClaude3Opus20240229,
-			MaxTokens: int64(4096),
-			Messages:  conversation,
-			Tools:     anthropicTools,
-		})
-		resultCh <- struct {
-			message *anthropic.Message
-			err     error
-		}{message, err}
-	}()
+	// Describe retries while we wait for them
+	onRetry := func(attempt int, delay time.Duration, apiErr *APIError) {
+		a.emit(Event{Type: EventRetry, Text: fmt.Sprintf("%s, retrying in %.0fs (attempt %d/%d)...", apiErr.Kind, delay.Seconds(), attempt+1, a.retryPolicy.MaxAttempts)})
+	}
 
-	// Display loading message with elapsed time
-	startTime := time.Now()
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	a.emit(Event{Type: EventRequestStarted})
+	defer a.emit(Event{Type: EventRequestFinished})
 
-	// Clear the loading message when we're done
-	defer func() {
-		fmt.Print("\r\033[K") // Clear the current line
-	}()
+	var message *anthropic.Message
+	err := a.retryPolicy.retry(ctx, func() error {
+		var streamed bool
+		var err error
+		message, streamed, err = a.streamMessage(ctx, params)
+		if err != nil && streamed {
+			// The partial text is discarded; a retry streams the response from the start
+			a.emit(Event{Type: EventTextReset})
+		}
+		return err
+	}, onRetry)
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
 
-	// Wait for either the API response or a tick to update the loading message
-	for {
-		select {
-		case result := <-resultCh:
-			// Process tool calls
-			for i, block := range result.message.Content {
-				if block.Type == "tool_use" && block.ToolUse != nil {
-					// Execute the tool
-					toolResult := a.executeTool(block.ToolUse.ID, block.ToolUse.Name, block.ToolUse.Input)
-					
-					// Print tool execution
-					fmt.Printf("tool: %s(%s)\n", block.ToolUse.Name, string(block.ToolUse.Input))
-					
-					// Replace the tool call with the result
-					result.message.Content[i] = toolResult
-				}
-			}
-			return result.message, result.err
-		case <-ticker.C:
-			elapsed := time.Since(startTime).Seconds()
-			fmt.Printf("\rThinking... %.1fs elapsed", elapsed)
+// streamMessage streams a response from Claude, emitting its text as it
+// arrives, and returns the complete message. It also reports whether any
+// text was emitted, which a failed stream leaves incomplete.
+func (a *Agent) streamMessage(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, bool, error) {
+	stream := a.client.Messages.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	message := &anthropic.Message{}
+	streamed := false
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return nil, streamed, err
+		}
+		if event.Type == "content_block_delta" && event.Delta.Type == "text_delta" {
+			a.emit(Event{Type: EventTextDelta, Text: event.Delta.Text})
+			streamed = true
 		}
 	}
+	if err := stream.Err(); err != nil {
+		return nil, streamed, err
+	}
+	return message, streamed, nil
 }
 
 // formatResponse formats Claude's response for display
@@ -199,8 +490,6 @@ func (a *Agent) formatResponse(msg *anthropic.Message) string {
 	for _, block := range msg.Content {
 		if block.Type == "text" {
 			result += block.Text
-		} else if block.Type == "tool_result" && block.ToolResult != nil {
-			result += fmt.Sprintf("result: %s\n", block.ToolResult.Content)
 		}
 	}
 	return result
@@ -0,0 +1,272 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+// ErrBudgetExceeded is returned when a budget limit stops a turn
+var ErrBudgetExceeded = errors.New("budget limit reached")
+
+// maxRecentActivity is how many tool calls the stop summary lists
+const maxRecentActivity = 5
+
+// budgetCounters counts what a turn or the session has done so far
+type budgetCounters struct {
+	started   time.Time
+	toolCalls int
+	commands  int
+}
+
+// limitBreach describes a limit that has been crossed
+type limitBreach struct {
+	scope string
+	name  string
+	value string
+	limit string
+	hard  bool
+}
+
+// String describes the breach for the user
+func (b *limitBreach) String() string {
+	kind := "soft"
+	if b.hard {
+		kind = "hard"
+	}
+	return fmt.Sprintf("%s %s %s exceeds the %s limit of %s", b.scope, b.name, b.value, kind, b.limit)
+}
+
+// key identifies the limit so an acknowledged soft limit is not asked about
+// again until it is crossed another time over
+func (b *limitBreach) key() string {
+	return b.scope + "/" + b.name
+}
+
+// budget enforces the configured turn and session limits
+type budget struct {
+	mu      sync.Mutex
+	limits  config.Budget
+	turn    budgetCounters
+	session budgetCounters
+	// accepted counts how often the user continued past each soft limit
+	accepted map[string]int
+	recent   []string
+}
+
+// newBudget creates a budget enforcing limits, starting the session clock now
+func newBudget(limits config.Budget) *budget {
+	return &budget{
+		limits:   limits,
+		session:  budgetCounters{started: time.Now()},
+		accepted: map[string]int{},
+	}
+}
+
+// reset starts the budget over for a new session
+func (b *budget) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.turn = budgetCounters{}
+	b.session = budgetCounters{started: time.Now()}
+	b.accepted = map[string]int{}
+	b.recent = nil
+}
+
+// startTurn resets the per-turn counters and acknowledged turn limits
+func (b *budget) startTurn() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.turn = budgetCounters{started: time.Now()}
+	b.recent = nil
+	for key := range b.accepted {
+		if strings.HasPrefix(key, "turn/") {
+			delete(b.accepted, key)
+		}
+	}
+}
+
+// recordCalls counts tool calls that are about to run
+func (b *budget) recordCalls(calls []toolCall) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, call := range calls {
+		b.turn.toolCalls++
+		b.session.toolCalls++
+		if call.Name == "run_command" {
+			b.turn.commands++
+			b.session.commands++
+		}
+		b.recent = append(b.recent, fmt.Sprintf("%s(%s)", call.Name, truncate(string(call.Input), 60)))
+	}
+	if len(b.recent) > maxRecentActivity {
+		b.recent = b.recent[len(b.recent)-maxRecentActivity:]
+	}
+}
+
+// accept records that the user chose to continue past a soft limit, which
+// is asked about again at its next multiple
+func (b *budget) accept(breach *limitBreach) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.accepted[breach.key()]++
+}
+
+// check returns the first limit crossed, hard limits first, counting the
+// pending tool calls as if they had already run. It returns nil if none is.
+func (b *budget) check(report usage.Report, pending []toolCall) *limitBreach {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pendingCommands := 0
+	for _, call := range pending {
+		if call.Name == "run_command" {
+			pendingCommands++
+		}
+	}
+
+	type scope struct {
+		name     string
+		limits   config.LimitSet
+		counters budgetCounters
+		usage    usage.Usage
+		cost     float64
+	}
+	scopes := []scope{
+		{"turn", b.limits.Turn, b.turn, report.Turn, report.TurnCost},
+		{"session", b.limits.Session, b.session, report.Session, report.SessionCost},
+	}
+
+	for _, hard := range []bool{true, false} {
+		for _, s := range scopes {
+			limits := rearm(s.limits.Soft, s.name, b.accepted)
+			if hard {
+				limits = s.limits.Hard
+			}
+			breach := exceeded(limits, s.counters, s.usage, s.cost, len(pending), pendingCommands)
+			if breach == nil {
+				continue
+			}
+			breach.scope = s.name
+			breach.hard = hard
+			return breach
+		}
+	}
+	return nil
+}
+
+// rearm raises each soft limit of a scope the user continued past to its next
+// multiple, so they are asked again after another limit's worth
+func rearm(limits config.Limits, scope string, accepted map[string]int) config.Limits {
+	next := func(name string) int { return accepted[scope+"/"+name] + 1 }
+	limits.Tokens *= int64(next("tokens"))
+	limits.Cost *= float64(next("cost"))
+	limits.Time *= config.Duration(next("time"))
+	limits.ToolCalls *= next("tool calls")
+	limits.Commands *= next("commands")
+	limits.Requests *= next("requests")
+	return limits
+}
+
+// exceeded compares one set of limits against the counters
+func exceeded(limits config.Limits, counters budgetCounters, u usage.Usage, cost float64, pendingCalls, pendingCommands int) *limitBreach {
+	elapsed := time.Since(counters.started)
+	switch {
+	case limits.Tokens > 0 && u.TotalTokens() >= limits.Tokens:
+		return &limitBreach{name: "tokens", value: usage.FormatTokens(u.TotalTokens()), limit: usage.FormatTokens(limits.Tokens)}
+	case limits.Cost > 0 && cost >= limits.Cost:
+		return &limitBreach{name: "cost", value: usage.FormatCost(cost), limit: usage.FormatCost(limits.Cost)}
+	case limits.Time > 0 && elapsed >= time.Duration(limits.Time):
+		return &limitBreach{name: "time", value: elapsed.Round(time.Second).String(), limit: time.Duration(limits.Time).String()}
+	case limits.ToolCalls > 0 && counters.toolCalls+pendingCalls > limits.ToolCalls:
+		return &limitBreach{name: "tool calls", value: fmt.Sprint(counters.toolCalls + pendingCalls), limit: fmt.Sprint(limits.ToolCalls)}
+	case limits.Commands > 0 && counters.commands+pendingCommands > limits.Commands:
+		return &limitBreach{name: "commands", value: fmt.Sprint(counters.commands + pendingCommands), limit: fmt.Sprint(limits.Commands)}
+	case limits.Requests > 0 && u.Requests >= limits.Requests:
+		return &limitBreach{name: "requests", value: fmt.Sprint(u.Requests), limit: fmt.Sprint(limits.Requests)}
+	}
+	return nil
+}
+
+// summary describes what the turn had been doing when it was stopped
+func (b *budget) summary(report usage.Report) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "Stopped after %d requests and %d tool calls this turn (%s, %s).",
+		report.Turn.Requests, b.turn.toolCalls, time.Since(b.turn.started).Round(time.Second), usage.FormatCost(report.TurnCost))
+	if len(b.recent) > 0 {
+		fmt.Fprintf(&s, "\nRecent activity: %s", strings.Join(b.recent, ", "))
+	}
+	return s.String()
+}
+
+// enforceBudget checks the limits before the pending tool calls run. A soft
+// limit pauses and asks whether to continue; a hard limit, or declining to
+// continue, stops the turn with a summary.
+func (a *Agent) enforceBudget(pending []toolCall) error {
+	for {
+		breach := a.budget.check(a.tracker.Report(), pending)
+		if breach == nil {
+			a.budget.recordCalls(pending)
+			return nil
+		}
+
+		if !breach.hard {
+			a.notice(fmt.Sprintf("Budget: %s.", breach))
+			if a.confirm("Continue anyway?") {
+				a.budget.accept(breach)
+				continue
+			}
+		}
+
+		a.emit(Event{Type: EventError, Text: fmt.Sprintf("Budget: %s.\n%s", breach, a.budget.summary(a.tracker.Report()))})
+		return fmt.Errorf("%w: %s", ErrBudgetExceeded, breach)
+	}
+}
+
+// skipToolCalls reports pending tool calls that were not run because the turn stopped
+func (a *Agent) skipToolCalls(calls []toolCall, reason error) []anthropic.ContentBlockParamUnion {
+	results := make([]anthropic.ContentBlockParamUnion, len(calls))
+	for i, call := range calls {
+		output := fmt.Sprintf("Error: not run, %s", reason)
+		a.emit(Event{Type: EventToolFinished, ToolID: call.ID, ToolName: call.Name, Output: output, IsError: true})
+		results[i] = anthropic.NewToolResultBlock(call.ID, output, true)
+	}
+	return results
+}
+
+// confirm asks the user a yes/no question, defaulting to no
+func (a *Agent) confirm(question string) bool {
+	if a.confirmFunc != nil {
+		return a.confirmFunc(question)
+	}
+	if a.input == nil {
+		return false
+	}
+
+	answer, ok := readAnswer(a.input, fmt.Sprintf("%s [y/N] ", question))
+	if !ok {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
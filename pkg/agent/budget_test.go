@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+func TestExceeded(t *testing.T) {
+	now := budgetCounters{started: time.Now()}
+	tests := []struct {
+		name            string
+		limits          config.Limits
+		counters        budgetCounters
+		usage           usage.Usage
+		cost            float64
+		pendingCalls    int
+		pendingCommands int
+		want            string
+	}{
+		{name: "no limits", counters: now, usage: usage.Usage{InputTokens: 1e9}, cost: 100, want: ""},
+		{name: "under every limit", limits: config.Limits{Tokens: 100, Cost: 1, ToolCalls: 5, Commands: 5, Requests: 5},
+			counters: budgetCounters{started: time.Now(), toolCalls: 2, commands: 1}, usage: usage.Usage{InputTokens: 50, Requests: 2}, cost: 0.5, want: ""},
+		{name: "tokens counted cached or not", limits: config.Limits{Tokens: 100}, counters: now,
+			usage: usage.Usage{InputTokens: 40, OutputTokens: 20, CacheReadTokens: 40}, want: "tokens"},
+		{name: "cost", limits: config.Limits{Cost: 1}, counters: now, cost: 1, want: "cost"},
+		{name: "time", limits: config.Limits{Time: config.Duration(time.Minute)},
+			counters: budgetCounters{started: time.Now().Add(-2 * time.Minute)}, want: "time"},
+		{name: "tool calls at the limit", limits: config.Limits{ToolCalls: 3}, counters: budgetCounters{started: time.Now(), toolCalls: 3}, want: ""},
+		{name: "pending tool calls past the limit", limits: config.Limits{ToolCalls: 3},
+			counters: budgetCounters{started: time.Now(), toolCalls: 2}, pendingCalls: 2, want: "tool calls"},
+		{name: "pending commands past the limit", limits: config.Limits{Commands: 1}, counters: now, pendingCalls: 2, pendingCommands: 2, want: "commands"},
+		{name: "requests", limits: config.Limits{Requests: 2}, counters: now, usage: usage.Usage{Requests: 2}, want: "requests"},
+	}
+	for _, test := range tests {
+		breach := exceeded(test.limits, test.counters, test.usage, test.cost, test.pendingCalls, test.pendingCommands)
+		got := ""
+		if breach != nil {
+			got = breach.name
+		}
+		if got != test.want {
+			t.Errorf("%s: exceeded = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBudgetCheck(t *testing.T) {
+	b := newBudget(config.Budget{
+		Turn:    config.LimitSet{Soft: config.Limits{ToolCalls: 2}},
+		Session: config.LimitSet{Hard: config.Limits{Cost: 5}},
+	})
+	calls := []toolCall{{Name: "read_file"}, {Name: "run_command"}, {Name: "list_files"}}
+
+	if breach := b.check(usage.Report{}, calls[:2]); breach != nil {
+		t.Fatalf("two calls breached %s", breach)
+	}
+	b.recordCalls(calls[:2])
+
+	breach := b.check(usage.Report{}, calls[2:])
+	if breach == nil || breach.key() != "turn/tool calls" || breach.hard {
+		t.Fatalf("third call: got %v, want the soft turn tool call limit", breach)
+	}
+
+	// An accepted soft limit is not asked about again this turn
+	b.accept(breach)
+	if breach := b.check(usage.Report{}, calls[2:]); breach != nil {
+		t.Errorf("accepted soft limit reported again: %s", breach)
+	}
+
+	// Hard limits come first and cannot be accepted away
+	hard := b.check(usage.Report{SessionCost: 6}, nil)
+	if hard == nil || hard.key() != "session/cost" || !hard.hard {
+		t.Errorf("got %v, want the hard session cost limit", hard)
+	}
+
+	// A new turn resets the turn counters and asks about soft limits again
+	b.recordCalls(calls[2:])
+	b.startTurn()
+	if breach := b.check(usage.Report{}, calls[:2]); breach != nil {
+		t.Errorf("new turn: two calls breached %s", breach)
+	}
+	if breach := b.check(usage.Report{}, calls); breach == nil || breach.key() != "turn/tool calls" {
+		t.Errorf("new turn: got %v, want the soft turn tool call limit asked about again", breach)
+	}
+
+	// reset starts the session over
+	b.recordCalls(calls)
+	b.reset()
+	if b.session.toolCalls != 0 || b.turn.toolCalls != 0 || len(b.accepted) != 0 {
+		t.Errorf("after reset: session %+v, turn %+v, accepted %v", b.session, b.turn, b.accepted)
+	}
+}
+
+func TestAcceptedSessionLimitRearms(t *testing.T) {
+	b := newBudget(config.Budget{Session: config.LimitSet{Soft: config.Limits{Cost: 1}}})
+
+	breach := b.check(usage.Report{SessionCost: 1.2}, nil)
+	if breach == nil || breach.key() != "session/cost" {
+		t.Fatalf("got %v, want the soft session cost limit", breach)
+	}
+	b.accept(breach)
+
+	// Accepted limits last across turns until another limit's worth is spent
+	b.startTurn()
+	if breach := b.check(usage.Report{SessionCost: 1.9}, nil); breach != nil {
+		t.Errorf("under twice the limit: asked again about %s", breach)
+	}
+	breach = b.check(usage.Report{SessionCost: 2}, nil)
+	if breach == nil || breach.limit != usage.FormatCost(2) {
+		t.Fatalf("at twice the limit: got %v, want the limit asked about again at %s", breach, usage.FormatCost(2))
+	}
+	b.accept(breach)
+	if breach := b.check(usage.Report{SessionCost: 2.5}, nil); breach != nil {
+		t.Errorf("accepted twice: asked again about %s before three times the limit", breach)
+	}
+	if breach := b.check(usage.Report{SessionCost: 3}, nil); breach == nil {
+		t.Error("at three times the limit: not asked again")
+	}
+}
@@ -0,0 +1,331 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/session"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// KnownModels are offered when completing /model
+var KnownModels = []string{
+	string(anthropic.ModelClaude3_7SonnetLatest),
+	string(anthropic.ModelClaude3_5SonnetLatest),
+	string(anthropic.ModelClaude3_5HaikuLatest),
+	string(anthropic.ModelClaude3OpusLatest),
+	string(anthropic.ModelClaude_3_Opus_20240229),
+	string(anthropic.ModelClaude_3_Haiku_20240307),
+}
+
+// maxListedSessions is how many saved sessions /resume lists
+const maxListedSessions = 10
+
+// addBuiltinCommands registers the commands every agent has
+func (a *Agent) addBuiltinCommands() {
+	for _, cmd := range []Command{
+		{Name: "help", Description: "List commands", Run: a.helpCommand},
+		{Name: "clear", Description: "Save the conversation and start a new one", Run: a.clearCommand},
+		{Name: "model", Usage: "[model]", Description: "Show or switch the Claude model", Run: a.modelCommand,
+			Complete: func(args string) []string { return CompleteFrom(args, KnownModels) }},
+		{Name: "tools", Description: "List the tools Claude can use", Run: a.toolsCommand},
+		{Name: "cost", Description: "Show tokens used and estimated cost", Run: a.costCommand},
+		{Name: "save", Description: "Save the conversation now", Run: a.saveCommand},
+		{Name: "resume", Usage: "[session-id]", Description: "List saved sessions of this workspace, or continue one", Run: a.resumeCommand,
+			Complete: func(args string) []string { return CompleteFrom(args, a.sessionIDs()) }},
+		{Name: "plan", Usage: "[task|off|show|clear]", Description: "Investigate read-only and propose a plan to approve, or show the plan", Run: a.planCommand,
+			Complete: func(args string) []string { return CompleteFrom(args, []string{"off", "show", "clear"}) }},
+		{Name: "diff", Description: "Show the changes made to files in this session", Run: a.diffCommand},
+		{Name: "undo", Description: "Revert the last file change made in this session", Run: a.undoCommand},
+		{Name: "exit", Description: "Save the conversation and quit", Run: func(context.Context, string) (string, error) { return "", ErrExit }},
+	} {
+		a.AddCommand(cmd)
+	}
+}
+
+// helpCommand lists the registered commands
+func (a *Agent) helpCommand(ctx context.Context, args string) (string, error) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, cmd := range a.Commands() {
+		fmt.Fprintf(w, "/%s %s\t%s\n", cmd.Name, cmd.Usage, cmd.Description)
+	}
+	w.Flush()
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// clearCommand saves the session and starts a new, empty one
+func (a *Agent) clearCommand(ctx context.Context, args string) (string, error) {
+	if err := a.SaveSession(); err != nil {
+		return "", fmt.Errorf("failed to save the session: %w", err)
+	}
+	old := a.env.SessionID
+
+	a.mu.Lock()
+	a.conversation = nil
+	a.pendingNotes = nil
+	a.plan = nil
+	a.mu.Unlock()
+	a.env.Todos.Restore(nil)
+	a.resetMemoryPrompt()
+	a.env.SessionID = session.NewID()
+	a.createdAt = time.Now()
+	a.tracker.Reset()
+	a.budget.reset()
+	if a.env.Journal != nil {
+		a.env.Journal.Clear()
+	}
+
+	if a.store == nil {
+		return "Started a new conversation.", nil
+	}
+	return fmt.Sprintf("Started a new conversation; /resume %s returns to the last one.", old), nil
+}
+
+// modelCommand shows or switches the model
+func (a *Agent) modelCommand(ctx context.Context, args string) (string, error) {
+	if args == "" {
+		return fmt.Sprintf("Model: %s", a.currentModel()), nil
+	}
+	words, err := SplitArgs(args)
+	if err != nil {
+		return "", err
+	}
+	if len(words) != 1 {
+		return "", errors.New("usage: /model [model]")
+	}
+	a.SetModel(words[0])
+	return fmt.Sprintf("Switched to %s.", words[0]), nil
+}
+
+// SetModel switches the model used from the next request on
+func (a *Agent) SetModel(model string) {
+	a.mu.Lock()
+	a.model = anthropic.Model(model)
+	a.mu.Unlock()
+	a.tracker.SetModel(model)
+}
+
+// currentModel returns the model used for the next request
+func (a *Agent) currentModel() anthropic.Model {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.model
+}
+
+// toolsCommand lists the agent's tools
+func (a *Agent) toolsCommand(ctx context.Context, args string) (string, error) {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, tool := range a.activeTools() {
+		kind := ""
+		if tool.ReadOnly {
+			kind = "read-only"
+		}
+		line, _, _ := strings.Cut(tool.Description, "\n")
+		fmt.Fprintf(w, "%s\t%s\t%s\n", tool.Name, kind, line)
+	}
+	w.Flush()
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// saveCommand saves the session immediately
+func (a *Agent) saveCommand(ctx context.Context, args string) (string, error) {
+	if a.store == nil {
+		return "", errors.New("sessions are not being saved")
+	}
+	if len(a.messages()) == 0 {
+		return "Nothing to save yet.", nil
+	}
+	if err := a.SaveSession(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Saved session %s.", a.env.SessionID), nil
+}
+
+// resumeCommand lists the workspace's saved sessions or continues one
+func (a *Agent) resumeCommand(ctx context.Context, args string) (string, error) {
+	if a.store == nil {
+		return "", errors.New("sessions are not being saved")
+	}
+	if args == "" {
+		return a.listSessions()
+	}
+
+	sess, err := a.store.Load(args)
+	if err != nil {
+		return "", err
+	}
+	if err := a.SaveSession(); err != nil {
+		return "", fmt.Errorf("failed to save the current session: %w", err)
+	}
+	a.Resume(sess)
+	a.mu.Lock()
+	a.pendingNotes = nil
+	a.mu.Unlock()
+	a.resetMemoryPrompt()
+	if a.env.Journal != nil {
+		a.env.Journal.Clear()
+	}
+	return fmt.Sprintf("Resumed session %s (%d messages, last active %s).",
+		sess.ID, len(sess.Messages), sess.UpdatedAt.Format("2006-01-02 15:04")), nil
+}
+
+// listSessions describes the most recent saved sessions of the workspace
+func (a *Agent) listSessions() (string, error) {
+	sessions, err := a.workspaceSessions()
+	if err != nil {
+		return "", err
+	}
+	if len(sessions) == 0 {
+		return "No saved sessions for this workspace.", nil
+	}
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for i, sess := range sessions {
+		if i == maxListedSessions {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", sess.ID, sess.UpdatedAt.Format("2006-01-02 15:04"), firstPrompt(sess))
+	}
+	w.Flush()
+	b.WriteString("Use /resume <session-id> to continue one.")
+	return b.String(), nil
+}
+
+// workspaceSessions returns the saved sessions started in the agent's
+// workspace, most recent first, leaving out the current one
+func (a *Agent) workspaceSessions() ([]*session.Session, error) {
+	all, err := a.store.List()
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*session.Session
+	for _, sess := range all {
+		if sess.WorkspaceRoot == a.env.WorkspaceRoot && sess.ID != a.env.SessionID {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions, nil
+}
+
+// sessionIDs returns the ids /resume can complete
+func (a *Agent) sessionIDs() []string {
+	if a.store == nil {
+		return nil
+	}
+	sessions, err := a.workspaceSessions()
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, sess := range sessions {
+		ids = append(ids, sess.ID)
+	}
+	return ids
+}
+
+// firstPrompt returns the start of a session's first user message
+func firstPrompt(sess *session.Session) string {
+	for _, msg := range sess.Messages {
+		if msg.Role != "user" {
+			continue
+		}
+		for _, block := range msg.Content {
+			if block.Type == "text" && block.Text != "" {
+				line, _, _ := strings.Cut(block.Text, "\n")
+				return truncate(line, 60)
+			}
+		}
+	}
+	return ""
+}
+
+// diffCommand shows how each file changed in this session differs from
+// its state before the first change
+func (a *Agent) diffCommand(ctx context.Context, args string) (string, error) {
+	journal := a.env.Journal
+	if journal == nil {
+		return "", errors.New("file changes are not being recorded")
+	}
+
+	var b strings.Builder
+	for _, change := range journal.Originals() {
+		current, err := os.ReadFile(change.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if string(current) == string(change.Content) {
+			continue
+		}
+		status := "modified"
+		switch {
+		case !change.Existed:
+			status = "created"
+		case os.IsNotExist(err):
+			status = "deleted"
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "\u001b[1m%s\u001b[0m (%s)\n", a.relativePath(change.Path), status)
+		b.WriteString(tools.Diff(string(change.Content), string(current)))
+	}
+	if b.Len() == 0 {
+		return "No files changed in this session.", nil
+	}
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// undoCommand reverts the most recent file change and tells Claude on the next prompt
+func (a *Agent) undoCommand(ctx context.Context, args string) (string, error) {
+	journal := a.env.Journal
+	if journal == nil {
+		return "", errors.New("file changes are not being recorded")
+	}
+	change, err := journal.Undo()
+	if err != nil {
+		return "", err
+	}
+
+	path := a.relativePath(change.Path)
+	message := fmt.Sprintf("Restored %s.", path)
+	note := fmt.Sprintf("The user undid your last change to %s; it is back to its previous content.", path)
+	if !change.Existed {
+		message = fmt.Sprintf("Removed %s, which was created in this session.", path)
+		note = fmt.Sprintf("The user undid the creation of %s; the file no longer exists.", path)
+	}
+	a.addNote(note)
+	return message, nil
+}
+
+// relativePath shows path relative to the workspace when it is inside it
+func (a *Agent) relativePath(path string) string {
+	if rel, err := filepath.Rel(a.env.WorkspaceRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// addNote queues a note for Claude to read with the next prompt
+func (a *Agent) addNote(note string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pendingNotes = append(a.pendingNotes, note)
+}
+
+// takeNotes returns and clears the queued notes
+func (a *Agent) takeNotes() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	notes := a.pendingNotes
+	a.pendingNotes = nil
+	return notes
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrExit is returned by a command to end Run, as /exit does
+var ErrExit = errors.New("exit requested")
+
+// Command is a slash command the user can type in Run instead of a message
+type Command struct {
+	Name string
+	// Usage shows the command's arguments in /help, e.g. "[session-id]"
+	Usage       string
+	Description string
+	// Run carries out the command, returning text to show the user
+	Run func(ctx context.Context, args string) (string, error)
+	// Complete suggests values for the argument being typed; nil offers none
+	Complete func(args string) []string
+
+	// custom marks commands loaded from prompt templates, which may replace each other
+	custom bool
+}
+
+// commandName matches what a command name may look like. A line starting
+// with anything else, such as the path /usr/bin/go, is a message.
+var commandName = regexp.MustCompile(`^/[a-zA-Z][a-zA-Z0-9_:-]*$`)
+
+// AddCommand registers a slash command, replacing any command with the same name
+func (a *Agent) AddCommand(cmd Command) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.commands == nil {
+		a.commands = map[string]Command{}
+	}
+	a.commands[cmd.Name] = cmd
+}
+
+// Commands returns the registered commands in name order
+func (a *Agent) Commands() []Command {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cmds := make([]Command, 0, len(a.commands))
+	for _, cmd := range a.commands {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// command looks up a registered command by name
+func (a *Agent) command(name string) (Command, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cmd, ok := a.commands[name]
+	return cmd, ok
+}
+
+// runCommand runs line if it is a slash command, reporting whether it was
+// one. It returns ErrExit when the command ends the session.
+func (a *Agent) runCommand(ctx context.Context, line string) (bool, error) {
+	name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if !commandName.MatchString(name) {
+		return false, nil
+	}
+	cmd, ok := a.command(strings.TrimPrefix(name, "/"))
+	if !ok {
+		a.emit(Event{Type: EventError, Text: fmt.Sprintf("Unknown command %s; type /help to list commands", name)})
+		return true, nil
+	}
+
+	output, err := cmd.Run(ctx, strings.TrimSpace(args))
+	if errors.Is(err, ErrExit) {
+		return true, err
+	}
+	if err != nil {
+		a.emit(Event{Type: EventError, Text: fmt.Sprintf("/%s: %s", cmd.Name, err.Error())})
+		return true, nil
+	}
+	if output != "" {
+		a.notice(output)
+	}
+	return true, nil
+}
+
+// Complete returns completions of a partly typed slash command line: command
+// names while the name is typed, then the command's own suggestions for its
+// argument. Each completion is the whole line.
+func (a *Agent) Complete(line string) []string {
+	if !strings.HasPrefix(line, "/") {
+		return nil
+	}
+	name, args, hasArgs := strings.Cut(line, " ")
+	if !hasArgs {
+		var matches []string
+		for _, cmd := range a.Commands() {
+			if strings.HasPrefix("/"+cmd.Name, name) {
+				matches = append(matches, "/"+cmd.Name+" ")
+			}
+		}
+		return matches
+	}
+
+	cmd, ok := a.command(strings.TrimPrefix(name, "/"))
+	if !ok || cmd.Complete == nil {
+		return nil
+	}
+	var matches []string
+	for _, value := range cmd.Complete(args) {
+		matches = append(matches, name+" "+value)
+	}
+	return matches
+}
+
+// CompleteFrom returns the values that start with the last word of args,
+// with the words before it, for use in Command.Complete
+func CompleteFrom(args string, values []string) []string {
+	prefix, last := "", args
+	if i := strings.LastIndexByte(args, ' '); i >= 0 {
+		prefix, last = args[:i+1], args[i+1:]
+	}
+	var matches []string
+	for _, v := range values {
+		if strings.HasPrefix(v, last) {
+			matches = append(matches, prefix+v)
+		}
+	}
+	return matches
+}
+
+// SplitArgs splits a command's arguments into words. Single or double quotes
+// group words and a backslash escapes the next character.
+func SplitArgs(args string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range args {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CustomCommand is a prompt template the user invokes as a slash command.
+// $ARGUMENTS in the template is replaced with everything typed after the
+// command, and $1 to $9 with the individual words.
+type CustomCommand struct {
+	Name         string
+	Description  string
+	ArgumentHint string
+	Template     string
+}
+
+// Expand fills in the template with the command's arguments. Arguments
+// given to a template that does not use them are appended to it.
+func (c CustomCommand) Expand(args string) (string, error) {
+	words, err := SplitArgs(args)
+	if err != nil {
+		return "", err
+	}
+	text := c.Template
+	usesArgs := strings.Contains(text, "$ARGUMENTS")
+	text = strings.ReplaceAll(text, "$ARGUMENTS", args)
+	for i := 9; i >= 1; i-- {
+		placeholder := "$" + strconv.Itoa(i)
+		if !strings.Contains(text, placeholder) {
+			continue
+		}
+		usesArgs = true
+		value := ""
+		if i <= len(words) {
+			value = words[i-1]
+		}
+		text = strings.ReplaceAll(text, placeholder, value)
+	}
+	if !usesArgs && args != "" {
+		text += "\n\n" + args
+	}
+	return text, nil
+}
+
+// LoadCustomCommands reads the markdown files in dir as custom commands. A
+// file at review/security.md becomes /review:security. A missing directory
+// holds no commands.
+func LoadCustomCommands(dir string) ([]CustomCommand, error) {
+	var cmds []CustomCommand
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := strings.ReplaceAll(strings.TrimSuffix(rel, ".md"), string(filepath.Separator), ":")
+		if !commandName.MatchString("/" + name) {
+			return fmt.Errorf("invalid command name %q from %s", name, path)
+		}
+		cmds = append(cmds, parseCustomCommand(name, string(data)))
+		return nil
+	})
+	return cmds, err
+}
+
+// parseCustomCommand reads a template with optional front matter setting
+// its description and argument-hint
+func parseCustomCommand(name, text string) CustomCommand {
+	cmd := CustomCommand{Name: name, Template: text}
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		if header, body, ok := strings.Cut(rest, "\n---\n"); ok {
+			cmd.Template = body
+			for _, line := range strings.Split(header, "\n") {
+				key, value, _ := strings.Cut(line, ":")
+				value = strings.Trim(strings.TrimSpace(value), `"'`)
+				switch strings.TrimSpace(key) {
+				case "description":
+					cmd.Description = value
+				case "argument-hint":
+					cmd.ArgumentHint = value
+				}
+			}
+		}
+	}
+	cmd.Template = strings.TrimSpace(cmd.Template)
+	if cmd.Description == "" {
+		line, _, _ := strings.Cut(cmd.Template, "\n")
+		cmd.Description = truncate(strings.TrimLeft(line, "# "), 60)
+	}
+	return cmd
+}
+
+// AddCustomCommands registers custom commands that send their expanded
+// template to Claude. Commands named like a built-in one are skipped and
+// returned in the error.
+func (a *Agent) AddCustomCommands(cmds []CustomCommand) error {
+	var errs []error
+	for _, custom := range cmds {
+		if existing, ok := a.command(custom.Name); ok && !existing.custom {
+			errs = append(errs, fmt.Errorf("custom command /%s is skipped: a built-in command has that name", custom.Name))
+			continue
+		}
+		custom := custom
+		a.AddCommand(Command{
+			Name:        custom.Name,
+			Usage:       custom.ArgumentHint,
+			Description: custom.Description + " (custom)",
+			custom:      true,
+			Run: func(ctx context.Context, args string) (string, error) {
+				text, err := custom.Expand(args)
+				if err != nil {
+					return "", err
+				}
+				// Prompt reports its own failures as events
+				a.Prompt(ctx, text)
+				return "", nil
+			},
+		})
+	}
+	return errors.Join(errs...)
+}
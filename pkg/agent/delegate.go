@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+// Each sub-agent stops at these budgets unless the config sets others
+const (
+	defaultSubAgentTokens   = 200_000
+	defaultSubAgentRequests = 20
+)
+
+// subAgentPrompt introduces the task a sub-agent is given
+const subAgentPrompt = `You are a sub-agent doing research for another agent, which gave you the task below and cannot see your work, only your final reply. Investigate with your read-only tools; you cannot change anything. Your requests and tokens are limited, so work efficiently. When you are done, reply with a concise report the other agent can act on without redoing your work: name the files, functions and line numbers involved, quote only what matters, and say what you could not determine.`
+
+// subAgentWrapUp asks a sub-agent that ran out of budget for what it has
+const subAgentWrapUp = `Your budget is used up. Do not use any more tools: reply now with your report of what you found so far, and list what you did not get to check.`
+
+// DelegateInput is the input of delegate
+type DelegateInput struct {
+	Description string `json:"description" jsonschema_description:"A few words describing the task, shown to the user."`
+	Task        string `json:"task" jsonschema_description:"The complete task for the sub-agent, with the context it needs; it cannot see this conversation."`
+}
+
+var delegateInputSchema = tools.GenerateSchema[DelegateInput]()
+
+// delegateTool is the tool with which Claude hands research to a sub-agent
+func (a *Agent) delegateTool() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name: "delegate",
+		Description: `Hand a self-contained research task to a sub-agent and get back its report.
+
+Use this for broad questions that need many files read, such as finding every place that parses the config or
+working out how a feature is wired together. The sub-agent has its own conversation and read-only tools, and only its
+final report is returned, which keeps this conversation small. It cannot see this conversation, so describe the task
+and the context it needs completely. Several delegate calls in one response run in parallel.
+`,
+		InputSchema: delegateInputSchema,
+		Function:    a.delegate,
+		ReadOnly:    true,
+	}
+}
+
+// delegate runs a task in a sub-agent, reporting its tool calls as progress,
+// and returns the sub-agent's final reply
+func (a *Agent) delegate(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+	delegateInput := DelegateInput{}
+	if err := json.Unmarshal(input, &delegateInput); err != nil {
+		return "", err
+	}
+	task := strings.TrimSpace(delegateInput.Task)
+	if task == "" {
+		return "", errors.New("the task is empty")
+	}
+	output := env.Output
+	if output == nil {
+		output = io.Discard
+	}
+	label := strings.TrimSpace(delegateInput.Description)
+	if label == "" {
+		label = truncate(task, 40)
+	}
+
+	child := a.newSubAgent()
+	child.Subscribe(func(e Event) {
+		switch e.Type {
+		case EventToolStarted:
+			fmt.Fprintf(output, "[%s] %s(%s)\n", label, e.ToolName, truncate(compactInput(e.Input), 80))
+		case EventToolFinished:
+			if e.IsError {
+				line, _, _ := strings.Cut(e.Output, "\n")
+				fmt.Fprintf(output, "[%s] %s failed: %s\n", label, e.ToolName, truncate(line, 80))
+			}
+		case EventRetry, EventError:
+			line, _, _ := strings.Cut(e.Text, "\n")
+			fmt.Fprintf(output, "[%s] %s\n", label, line)
+		case EventUsage:
+			// What sub-agents use counts toward the session
+			a.tracker.Add(e.Usage.Model, e.Usage.Request)
+			a.emitUsage()
+		}
+	})
+
+	result, err := child.Prompt(ctx, fmt.Sprintf("%s\n\nTask: %s", subAgentPrompt, task))
+	if errors.Is(err, ErrBudgetExceeded) {
+		// Allow one more request for the report; tools it asks for are not run
+		fmt.Fprintf(output, "[%s] budget used up, asking for its findings so far\n", label)
+		child.budget = newBudget(config.Budget{Turn: config.LimitSet{Hard: config.Limits{Requests: 1}}})
+		result, err = child.Prompt(ctx, subAgentWrapUp)
+		if errors.Is(err, ErrBudgetExceeded) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("the sub-agent failed: %w", err)
+	}
+	if strings.TrimSpace(result.Text) == "" {
+		return "", errors.New("the sub-agent finished without a report")
+	}
+
+	total := result.Usage.Session
+	fmt.Fprintf(output, "[%s] done after %d requests, %s tokens\n", label, total.Requests, usage.FormatTokens(total.TotalTokens()))
+	return result.Text, nil
+}
+
+// newSubAgent creates an agent for delegated research: it shares the
+// workspace, permission policy, hooks and model, but has its own
+// conversation, read-only tools and budget, and saves no session. Session
+// hooks are left to the parent, whose session the sub-agent works within.
+func (a *Agent) newSubAgent() *Agent {
+	cfg := *a.config
+	cfg.Model = string(a.currentModel())
+	limits := config.Limits{Tokens: cfg.SubAgents.MaxTokens, Requests: cfg.SubAgents.MaxRequests}
+	if limits.Tokens == 0 {
+		limits.Tokens = defaultSubAgentTokens
+	}
+	if limits.Requests == 0 {
+		limits.Requests = defaultSubAgentRequests
+	}
+	cfg.Limits = config.Budget{Turn: config.LimitSet{Hard: limits}}
+
+	env := *a.env
+	env.Output, env.Journal, env.Reviewer, env.Todos = nil, nil, nil, nil
+	child := NewAgent(a.client, nil, a.readOnlyTools(), &env, &cfg)
+	child.subAgent = true
+	child.SetHooks(a.hooks.WithoutSession())
+	child.instructions = a.instructions
+	child.SetConfirm(func(string) bool { return false })
+	return child
+}
+
+// compactInput shows a tool's JSON input on one line
+func compactInput(input json.RawMessage) string {
+	var b bytes.Buffer
+	if json.Compact(&b, input) != nil {
+		return string(input)
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/hooks"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+func TestSubAgentRunsToolHooks(t *testing.T) {
+	dir := t.TempDir()
+	ran := false
+	readTool := tools.ToolDefinition{Name: "read_file", ReadOnly: true, Function: func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+		ran = true
+		return "secret", nil
+	}}
+	a := NewAgent(nil, nil, []tools.ToolDefinition{readTool}, &tools.Env{WorkspaceRoot: dir}, nil)
+	a.SetHooks(hooks.New(config.Hooks{
+		PreToolUse: []config.Hook{{Matcher: "read_file", Command: "echo reading secrets is not allowed >&2; exit 2"}},
+		SessionEnd: []config.Hook{{Command: "touch session-ended"}},
+	}, dir, nil))
+
+	child := a.newSubAgent()
+	output, isError, _ := child.executeTool(context.Background(), "toolu_1", "read_file", json.RawMessage(`{"path": ".env"}`))
+	if !isError || !strings.Contains(output, "reading secrets is not allowed") || ran {
+		t.Errorf("sub-agent read_file: got %q (error %t, ran %t), want it blocked by the pre-tool hook", output, isError, ran)
+	}
+
+	// The sub-agent works within the parent's session and does not end it
+	child.startSession(context.Background())
+	child.Close()
+	if _, err := os.Stat(filepath.Join(dir, "session-ended")); !os.IsNotExist(err) {
+		t.Errorf("the sub-agent ran the session_end hook (stat: %v)", err)
+	}
+}
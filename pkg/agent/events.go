@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+// EventType identifies what an event reports
+type EventType string
+
+// Events are emitted in this order within a turn. Every tool call Claude
+// requests is eventually reported as finished, whether it ran, was denied,
+// was skipped or was interrupted. When a response fails after some of its
+// text was streamed, text_reset tells clients to discard the text_delta
+// events of that response; a retry then streams it again from the start.
+const (
+	EventTurnStarted     EventType = "turn_started"
+	EventRequestStarted  EventType = "request_started"
+	EventRetry           EventType = "retry"
+	EventTextDelta       EventType = "text_delta"
+	EventTextReset       EventType = "text_reset"
+	EventRequestFinished EventType = "request_finished"
+	EventUsage           EventType = "usage"
+	EventText            EventType = "text"
+	EventToolRequested   EventType = "tool_requested"
+	EventToolApproved    EventType = "tool_approved"
+	EventToolDenied      EventType = "tool_denied"
+	EventToolStarted     EventType = "tool_started"
+	EventToolProgress    EventType = "tool_progress"
+	EventToolFinished    EventType = "tool_finished"
+	EventPlanUpdated     EventType = "plan_updated"
+	EventTodosUpdated    EventType = "todos_updated"
+	EventNotice          EventType = "notice"
+	EventError           EventType = "error"
+	EventTurnEnded       EventType = "turn_ended"
+)
+
+// Stop reasons reported when a turn ends
+const (
+	StopEndTurn     = "end_turn"
+	StopInterrupted = "interrupted"
+	StopBudget      = "budget_exceeded"
+	StopError       = "error"
+	StopBlocked     = "blocked"
+)
+
+// Event is something the agent did that a UI may want to show
+type Event struct {
+	Type       EventType       `json:"type"`
+	SessionID  string          `json:"session_id,omitempty"`
+	Time       time.Time       `json:"time"`
+	Text       string          `json:"text,omitempty"`
+	ToolID     string          `json:"tool_id,omitempty"`
+	ToolName   string          `json:"tool_name,omitempty"`
+	Input      json.RawMessage `json:"input,omitempty"`
+	Output     string          `json:"output,omitempty"`
+	IsError    bool            `json:"is_error,omitempty"`
+	Usage      *usage.Report   `json:"usage,omitempty"`
+	StopReason string          `json:"stop_reason,omitempty"`
+}
+
+// EventHandler receives the agent's events; it may be called from several goroutines
+type EventHandler func(Event)
+
+// subscriber is a registered event handler
+type subscriber struct {
+	id      int
+	handler EventHandler
+}
+
+// Subscribe adds a handler for the agent's events and returns a function
+// that removes it. Handlers are called in the order they subscribed.
+func (a *Agent) Subscribe(handler EventHandler) (unsubscribe func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nextSubscriber++
+	id := a.nextSubscriber
+	a.subscribers = append(a.subscribers, subscriber{id: id, handler: handler})
+
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for i, sub := range a.subscribers {
+			if sub.id == id {
+				a.subscribers = append(a.subscribers[:i:i], a.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// emit stamps an event and passes it to every subscriber
+func (a *Agent) emit(e Event) {
+	a.mu.Lock()
+	subscribers := a.subscribers
+	a.mu.Unlock()
+	if len(subscribers) == 0 {
+		return
+	}
+
+	e.SessionID = a.env.SessionID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, sub := range subscribers {
+		sub.handler(e)
+	}
+}
+
+// notice emits an informational message
+func (a *Agent) notice(text string) {
+	a.emit(Event{Type: EventNotice, Text: text})
+}
+
+// emitUsage reports the latest usage snapshot
+func (a *Agent) emitUsage() {
+	report := a.tracker.Report()
+	a.emit(Event{Type: EventUsage, Usage: &report})
+}
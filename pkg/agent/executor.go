@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// maxParallelTools bounds how many read-only tools run at once
+const maxParallelTools = 4
+
+// interruptedToolResult is reported for tool calls cut short by an interrupt
+const interruptedToolResult = "Error: tool execution interrupted by user"
+
+// interruptedAfterNote follows the output of a tool call that finished while
+// the turn was being interrupted
+const interruptedAfterNote = "\n\nNote: the user interrupted the turn after this tool call finished; its result above is what actually happened."
+
+// toolCall is a single tool_use block requested by the model
+type toolCall struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+// toolCalls extracts the tool_use blocks from a message in order
+func toolCalls(msg *anthropic.Message) []toolCall {
+	var calls []toolCall
+	for _, block := range msg.Content {
+		if block.Type == "tool_use" {
+			calls = append(calls, toolCall{ID: block.ID, Name: block.Name, Input: block.Input})
+		}
+	}
+	return calls
+}
+
+// executeTools runs the calls and returns their results in the original order.
+// Consecutive read-only tools run concurrently on a bounded pool; any other
+// tool waits for in-flight calls to finish and then runs on its own, so
+// mutations are serialized and observe everything requested before them.
+func (a *Agent) executeTools(ctx context.Context, calls []toolCall) []anthropic.ContentBlockParamUnion {
+	results := make([]anthropic.ContentBlockParamUnion, len(calls))
+	sem := make(chan struct{}, maxParallelTools)
+	var wg sync.WaitGroup
+
+	for i, call := range calls {
+		if !a.isReadOnly(call.Name) {
+			wg.Wait()
+			results[i] = a.runToolCall(ctx, call)
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, call toolCall) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = a.runToolCall(ctx, call)
+		}(i, call)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runToolCall executes one call under its own cancellable context
+func (a *Agent) runToolCall(ctx context.Context, call toolCall) anthropic.ContentBlockParamUnion {
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Calls still queued when the turn is interrupted are never started
+	output, isError := interruptedToolResult, true
+	if ctx.Err() == nil {
+		var err error
+		output, isError, err = a.executeTool(callCtx, call.ID, call.Name, call.Input)
+		// A call that ran to completion keeps its output, so Claude knows what changed
+		switch {
+		case ctx.Err() == nil:
+		case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+			output, isError = interruptedToolResult, true
+		default:
+			output += interruptedAfterNote
+		}
+	}
+	a.emit(Event{Type: EventToolFinished, ToolID: call.ID, ToolName: call.Name, Output: output, IsError: isError})
+
+	return anthropic.NewToolResultBlock(call.ID, output, isError)
+}
+
+// isReadOnly reports whether the named tool is safe to run concurrently
+func (a *Agent) isReadOnly(name string) bool {
+	tool := a.findTool(name)
+	return tool != nil && tool.ReadOnly
+}
+
+// findTool looks up a tool definition by name
+func (a *Agent) findTool(name string) *tools.ToolDefinition {
+	active := a.activeTools()
+	for i := range active {
+		if active[i].Name == name {
+			return &active[i]
+		}
+	}
+	return nil
+}
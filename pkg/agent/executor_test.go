@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// toolResult returns the text and error flag of a tool result block
+func toolResult(t *testing.T, a *Agent, ctx context.Context, call toolCall) (string, bool) {
+	t.Helper()
+	block := a.runToolCall(ctx, call).OfRequestToolResultBlock
+	if block == nil || len(block.Content) != 1 || block.Content[0].OfRequestTextBlock == nil {
+		t.Fatalf("unexpected tool result %+v", block)
+	}
+	return block.Content[0].OfRequestTextBlock.Text, block.IsError.Value
+}
+
+func TestRunToolCallInterrupted(t *testing.T) {
+	tests := []struct {
+		name string
+		// run is the tool; interrupt cancels the turn while it runs
+		run       func(ctx context.Context, interrupt func()) (string, error)
+		cancelled bool
+		want      string
+		wantError bool
+	}{
+		{name: "finished", run: func(ctx context.Context, interrupt func()) (string, error) {
+			return "wrote main.go", nil
+		}, want: "wrote main.go"},
+		{name: "finished as the turn was interrupted", run: func(ctx context.Context, interrupt func()) (string, error) {
+			interrupt()
+			return "wrote main.go", nil
+		}, want: "wrote main.go" + interruptedAfterNote},
+		{name: "failed as the turn was interrupted", run: func(ctx context.Context, interrupt func()) (string, error) {
+			interrupt()
+			return "", fmt.Errorf("exit status 1")
+		}, want: "Error: exit status 1" + interruptedAfterNote, wantError: true},
+		{name: "stopped by the interrupt", run: func(ctx context.Context, interrupt func()) (string, error) {
+			interrupt()
+			<-ctx.Done()
+			return "", fmt.Errorf("command cancelled: %w", ctx.Err())
+		}, want: interruptedToolResult, wantError: true},
+		{name: "interrupted before it started", cancelled: true, run: func(ctx context.Context, interrupt func()) (string, error) {
+			t.Error("a call queued after the interrupt ran")
+			return "", nil
+		}, want: interruptedToolResult, wantError: true},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.cancelled {
+			cancel()
+		}
+		tool := tools.ToolDefinition{Name: "edit_file", Function: func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+			return test.run(ctx, cancel)
+		}}
+		a := NewAgent(nil, nil, []tools.ToolDefinition{tool}, &tools.Env{WorkspaceRoot: t.TempDir()}, nil)
+
+		got, isError := toolResult(t, a, ctx, toolCall{ID: "toolu_1", Name: "edit_file", Input: json.RawMessage(`{}`)})
+		if got != test.want || isError != test.wantError {
+			t.Errorf("%s: got %q (error %t), want %q (error %t)", test.name, got, isError, test.want, test.wantError)
+		}
+		if strings.Contains(test.want, interruptedAfterNote) && !strings.HasPrefix(got, strings.TrimSuffix(test.want, interruptedAfterNote)) {
+			t.Errorf("%s: the real output was lost", test.name)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/hooks"
+)
+
+// ErrPromptBlocked is returned when a user_prompt_submitted hook blocks a prompt
+var ErrPromptBlocked = errors.New("prompt blocked by hook")
+
+// SetHooks makes the agent run hooks around tool calls, turns and the session
+func (a *Agent) SetHooks(runner *hooks.Runner) {
+	a.hooks = runner
+}
+
+// runHooks runs the hooks for an event, warning about any that failed
+func (a *Agent) runHooks(ctx context.Context, p hooks.Payload) hooks.Result {
+	p.SessionID = a.env.SessionID
+	p.WorkspaceRoot = a.env.WorkspaceRoot
+	result := a.hooks.Run(ctx, p)
+	for _, err := range result.Errors {
+		a.notice(fmt.Sprintf("Warning: %s", err.Error()))
+	}
+	return result
+}
+
+// startSession runs the session_start hooks before the first turn
+func (a *Agent) startSession(ctx context.Context) {
+	a.mu.Lock()
+	started := a.started
+	a.started = true
+	a.mu.Unlock()
+	if !started {
+		a.runHooks(ctx, hooks.Payload{Event: hooks.SessionStart})
+	}
+}
+
+// Close ends the session, running the session_end hooks if it started and
+// then the functions registered with OnClose. It is safe to call more than once.
+func (a *Agent) Close() {
+	a.mu.Lock()
+	started, closed, onClose := a.started, a.closed, a.onClose
+	a.closed = true
+	a.mu.Unlock()
+	if closed {
+		return
+	}
+	if started {
+		a.runHooks(context.Background(), hooks.Payload{Event: hooks.SessionEnd})
+	}
+	for _, fn := range onClose {
+		fn()
+	}
+}
+
+// OnClose registers fn to run when the agent is closed, e.g. to stop what
+// its tools depend on
+func (a *Agent) OnClose(fn func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onClose = append(a.onClose, fn)
+}
@@ -0,0 +1,30 @@
+package agent
+
+// InputSource supplies what the user types
+type InputSource interface {
+	// ReadLine shows prompt and returns the next line of input, or false once input has ended
+	ReadLine(prompt string) (string, bool)
+}
+
+// InputFunc adapts a function to an InputSource
+type InputFunc func(prompt string) (string, bool)
+
+// ReadLine implements InputSource
+func (f InputFunc) ReadLine(prompt string) (string, bool) {
+	return f(prompt)
+}
+
+// AnswerReader is implemented by input sources that read answers to questions
+// differently from messages, such as a line editor keeping them out of its history
+type AnswerReader interface {
+	// ReadAnswer shows prompt and returns the answer, or false once input has ended
+	ReadAnswer(prompt string) (string, bool)
+}
+
+// readAnswer reads the answer to a question from input
+func readAnswer(input InputSource, prompt string) (string, bool) {
+	if r, ok := input.(AnswerReader); ok {
+		return r.ReadAnswer(prompt)
+	}
+	return input.ReadLine(prompt)
+}
@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/instructions"
+)
+
+// SetInstructions adds the instruction files to the system prompt of every
+// request, reloading them when they change
+func (a *Agent) SetInstructions(set *instructions.Set) {
+	a.instructions = set
+}
+
+// instructionsPrompt returns the system prompt block of the instruction
+// files, first reloading them if they changed, or "" when there are none
+func (a *Agent) instructionsPrompt() string {
+	if a.instructions == nil {
+		return ""
+	}
+	changed, errs := a.instructions.Reload()
+	for _, err := range errs {
+		a.notice(fmt.Sprintf("Warning: %s", err.Error()))
+	}
+	if changed {
+		a.noticeInstructions("Reloaded instructions from")
+	}
+	return a.instructions.Prompt()
+}
+
+// noticeInstructions tells the user which instruction files are in use
+func (a *Agent) noticeInstructions(prefix string) {
+	if a.instructions == nil || a.subAgent {
+		return
+	}
+	var origins []string
+	for _, file := range a.instructions.Files() {
+		origins = append(origins, file.Origin)
+	}
+	if len(origins) == 0 {
+		a.notice("No instruction files are in use any more.")
+		return
+	}
+	a.notice(fmt.Sprintf("%s %s", prefix, strings.Join(origins, ", ")))
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/memory"
+)
+
+// maxPromptMemories is how many memories the system prompt holds
+const maxPromptMemories = 20
+
+// SetMemory gives Claude the memory tools, adds the most relevant memories
+// to the system prompt of each session and registers /memory
+func (a *Agent) SetMemory(m *memory.Memory) {
+	a.memory = m
+	a.tools = append(a.tools, m.Tools()...)
+	a.AddCommand(Command{
+		Name:        "memory",
+		Usage:       "[search QUERY | delete ID... | review]",
+		Description: "List saved memories, search them, or delete some",
+		Run:         a.memoryCommand,
+		Complete:    a.completeMemory,
+	})
+}
+
+// memoryPrompt returns the system prompt block of saved memories, or "" when
+// there are none. The memories are chosen once per session, ranked by
+// relevance to its first message, so the block stays the same and cached.
+func (a *Agent) memoryPrompt(conversation []anthropic.MessageParam) string {
+	if a.memory == nil {
+		return ""
+	}
+	a.mu.Lock()
+	loaded, prompt := a.memoryLoaded, a.memoryText
+	a.mu.Unlock()
+	if loaded {
+		return prompt
+	}
+
+	entries, err := a.memory.Entries()
+	if err != nil {
+		a.notice(fmt.Sprintf("Warning: %s", err.Error()))
+	}
+	if len(entries) > 0 {
+		ranked := memory.Rank(entries, firstMessage(conversation), maxPromptMemories)
+		lines := make([]string, len(ranked))
+		for i, entry := range ranked {
+			lines[i] = "- " + memory.Format(entry)
+		}
+		prompt = "Memories you saved with the memory tool in earlier sessions, most relevant first"
+		if len(ranked) < len(entries) {
+			prompt += fmt.Sprintf(" (%d of %d; find the others with memory_search)", len(ranked), len(entries))
+		}
+		prompt += ":\n\n" + strings.Join(lines, "\n")
+	}
+
+	a.mu.Lock()
+	a.memoryLoaded, a.memoryText = true, prompt
+	a.mu.Unlock()
+	return prompt
+}
+
+// resetMemoryPrompt has the memories chosen again for a new session
+func (a *Agent) resetMemoryPrompt() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.memoryLoaded, a.memoryText = false, ""
+}
+
+// firstMessage returns the text of the conversation's first message
+func firstMessage(conversation []anthropic.MessageParam) string {
+	if len(conversation) == 0 {
+		return ""
+	}
+	var text []string
+	for _, block := range conversation[0].Content {
+		if block.OfRequestTextBlock != nil {
+			text = append(text, block.OfRequestTextBlock.Text)
+		}
+	}
+	return strings.Join(text, "\n")
+}
+
+// memoryCommand lists, searches and deletes memories
+func (a *Agent) memoryCommand(ctx context.Context, args string) (string, error) {
+	action, rest, _ := strings.Cut(args, " ")
+	rest = strings.TrimSpace(rest)
+	switch action {
+	case "":
+		entries, err := a.memory.Entries()
+		if err != nil {
+			return "", err
+		}
+		return formatMemories(entries, "No memories saved yet."), nil
+	case "search":
+		if rest == "" {
+			return "", errors.New("usage: /memory search QUERY")
+		}
+		entries, err := a.memory.Search(rest, 0)
+		if err != nil {
+			return "", err
+		}
+		return formatMemories(entries, "No memories match."), nil
+	case "delete":
+		ids := strings.Fields(rest)
+		if len(ids) == 0 {
+			return "", errors.New("usage: /memory delete ID...")
+		}
+		var lines []string
+		for _, id := range ids {
+			entry, err := a.memory.Delete(id)
+			if err != nil {
+				return strings.Join(lines, "\n"), err
+			}
+			lines = append(lines, "Deleted "+memory.Format(entry))
+		}
+		return strings.Join(lines, "\n"), nil
+	case "review":
+		return a.reviewMemories()
+	}
+	return "", fmt.Errorf("unknown action %q; use /memory, /memory search, /memory delete or /memory review", action)
+}
+
+// reviewMemories asks about each memory in turn whether to delete it
+func (a *Agent) reviewMemories() (string, error) {
+	entries, err := a.memory.Entries()
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "No memories saved yet.", nil
+	}
+	deleted := 0
+	for i, entry := range entries {
+		a.notice(fmt.Sprintf("%d/%d %s", i+1, len(entries), memory.Format(entry)))
+		if !a.confirm("Delete it?") {
+			continue
+		}
+		if _, err := a.memory.Delete(entry.ID); err != nil {
+			return "", err
+		}
+		deleted++
+	}
+	return fmt.Sprintf("Deleted %d of %d memories.", deleted, len(entries)), nil
+}
+
+// completeMemory completes /memory actions and the ids to delete
+func (a *Agent) completeMemory(args string) []string {
+	if ids, ok := strings.CutPrefix(args, "delete "); ok {
+		entries, err := a.memory.Entries()
+		if err != nil {
+			return nil
+		}
+		values := make([]string, len(entries))
+		for i, entry := range entries {
+			values[i] = entry.ID
+		}
+		return CompleteFrom("delete "+ids, values)
+	}
+	if strings.Contains(args, " ") {
+		return nil
+	}
+	return CompleteFrom(args, []string{"search ", "delete ", "review"})
+}
+
+// formatMemories lists entries one per line, or says empty when there are none
+func formatMemories(entries []memory.Entry, empty string) string {
+	if len(entries) == 0 {
+		return empty
+	}
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = memory.Format(entry)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,281 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/plan"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// PlanApprover asks the user what to do with a plan Claude proposes
+type PlanApprover interface {
+	ApprovePlan(ctx context.Context, p *plan.Plan) (*plan.Decision, error)
+}
+
+// planModePrompt tells Claude how to work in plan mode
+const planModePrompt = `You are in plan mode. Investigate the task with the read-only tools you have, without changing anything: files cannot be edited and only read-only commands may run. When you understand what needs to be done, call submit_plan with a short summary and the ordered steps to carry out. The user will approve, edit or reject the plan; nothing is changed until they approve it.`
+
+// planInstructions is the result of submit_plan once the user approves the plan
+const planInstructions = `The user approved the plan and plan mode is over; all tools are available again. Carry out the plan step by step. Call update_plan to mark each step in_progress when you start it and done (or skipped) when you finish it.`
+
+// SubmitPlanInput is the input of submit_plan
+type SubmitPlanInput struct {
+	Summary string `json:"summary" jsonschema_description:"What the plan achieves and how, in a few sentences."`
+	Steps   []struct {
+		Title   string `json:"title" jsonschema_description:"What the step does, in one line."`
+		Details string `json:"details,omitempty" jsonschema_description:"Files, functions and commands involved, if useful."`
+	} `json:"steps" jsonschema_description:"The steps to carry out, in order."`
+}
+
+var submitPlanInputSchema = tools.GenerateSchema[SubmitPlanInput]()
+
+// UpdatePlanInput is the input of update_plan
+type UpdatePlanInput struct {
+	Step   int    `json:"step" jsonschema_description:"The number of the step, starting at 1."`
+	Status string `json:"status" jsonschema_description:"The step's new status: pending, in_progress, done or skipped."`
+}
+
+var updatePlanInputSchema = tools.GenerateSchema[UpdatePlanInput]()
+
+// SetPlanApprover sets how plans are approved; without one the user is
+// asked a yes/no question
+func (a *Agent) SetPlanApprover(approver PlanApprover) {
+	a.planApprover = approver
+}
+
+// SetPlanning switches plan mode on or off
+func (a *Agent) SetPlanning(planning bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.planning = planning
+}
+
+// Planning reports whether the agent is in plan mode
+func (a *Agent) Planning() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.planning
+}
+
+// Plan returns a copy of the approved plan, or nil when there is none
+func (a *Agent) Plan() *plan.Plan {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return copyPlan(a.plan)
+}
+
+// setPlan replaces the approved plan and shows it
+func (a *Agent) setPlan(p *plan.Plan) {
+	a.mu.Lock()
+	a.plan = copyPlan(p)
+	a.mu.Unlock()
+	if p != nil {
+		a.emit(Event{Type: EventPlanUpdated, Text: p.Checklist()})
+	}
+}
+
+// copyPlan copies p so callers cannot change the agent's plan
+func copyPlan(p *plan.Plan) *plan.Plan {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.Steps = append([]plan.Step(nil), p.Steps...)
+	return &c
+}
+
+// activeTools returns the tools Claude may use next. Plan mode offers only
+// read-only tools and submit_plan; with an approved plan update_plan is
+// offered as well. Agents may delegate unless they are sub-agents themselves.
+func (a *Agent) activeTools() []tools.ToolDefinition {
+	a.mu.Lock()
+	planning, hasPlan := a.planning, a.plan != nil
+	a.mu.Unlock()
+
+	active := a.tools
+	if planning {
+		active = a.readOnlyTools()
+	}
+	var extra []tools.ToolDefinition
+	if !a.subAgent && !a.config.SubAgents.Disabled {
+		extra = append(extra, a.delegateTool())
+	}
+	switch {
+	case planning:
+		extra = append(extra, a.submitPlanTool())
+	case hasPlan:
+		extra = append(extra, a.updatePlanTool())
+	}
+	if len(extra) == 0 {
+		return active
+	}
+	return append(append([]tools.ToolDefinition(nil), active...), extra...)
+}
+
+// readOnlyTools returns the agent's tools without side effects, with
+// run_command limited to safe commands
+func (a *Agent) readOnlyTools() []tools.ToolDefinition {
+	var readOnly []tools.ToolDefinition
+	for _, tool := range a.tools {
+		switch {
+		case tool.Name == tools.RunCommandDefinition.Name:
+			readOnly = append(readOnly, tools.SafeCommandDefinition)
+		case tool.ReadOnly:
+			readOnly = append(readOnly, tool)
+		}
+	}
+	return readOnly
+}
+
+// planPrompt returns the system prompt block describing plan mode or the
+// approved plan, or "" when neither applies
+func (a *Agent) planPrompt() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case a.planning:
+		return planModePrompt
+	case a.plan != nil:
+		finished, total := a.plan.Progress()
+		return fmt.Sprintf("You are carrying out this plan, which the user approved (%d of %d steps finished). Keep it up to date with update_plan.\n\n%s", finished, total, a.plan.Markdown())
+	}
+	return ""
+}
+
+// submitPlanTool is the tool with which Claude ends plan mode
+func (a *Agent) submitPlanTool() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "submit_plan",
+		Description: "Submit the plan for the task to the user for approval. Call this once you have investigated enough to know what to change. If the user rejects the plan, revise it using their feedback and submit it again.",
+		InputSchema: submitPlanInputSchema,
+		Function:    a.submitPlan,
+	}
+}
+
+// updatePlanTool is the tool with which Claude tracks the approved plan
+func (a *Agent) updatePlanTool() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "update_plan",
+		Description: "Set the status of a step of the approved plan: in_progress when you start it, done when it is finished, or skipped if it turned out not to be needed.",
+		InputSchema: updatePlanInputSchema,
+		Function:    a.updatePlan,
+	}
+}
+
+// submitPlan asks the user to approve a plan, switching to carrying it out if they do
+func (a *Agent) submitPlan(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+	submitPlanInput := SubmitPlanInput{}
+	if err := json.Unmarshal(input, &submitPlanInput); err != nil {
+		return "", err
+	}
+	if !a.Planning() {
+		return "", errors.New("not in plan mode; carry out the approved plan instead")
+	}
+	p := &plan.Plan{Summary: strings.TrimSpace(submitPlanInput.Summary)}
+	for _, step := range submitPlanInput.Steps {
+		p.Steps = append(p.Steps, plan.Step{Title: strings.TrimSpace(step.Title), Details: strings.TrimSpace(step.Details)})
+	}
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	decision, err := a.approvePlan(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	if !decision.Approved {
+		message := "the user rejected the plan; keep investigating if needed and submit a revised plan"
+		if decision.Feedback != "" {
+			message += "\n\nFeedback from the user: " + decision.Feedback
+		}
+		return "", errors.New(message)
+	}
+
+	a.mu.Lock()
+	a.planning = false
+	a.mu.Unlock()
+	a.setPlan(decision.Plan)
+
+	result := planInstructions
+	if decision.Edited {
+		result += "\n\nThe user edited the plan before approving it. This is the plan to carry out:\n\n" + decision.Plan.Markdown()
+	}
+	return result, nil
+}
+
+// approvePlan asks the approver about p, or falls back to a yes/no question
+func (a *Agent) approvePlan(ctx context.Context, p *plan.Plan) (*plan.Decision, error) {
+	if a.planApprover != nil {
+		return a.planApprover.ApprovePlan(ctx, p)
+	}
+	a.notice("Claude's plan:\n" + p.Markdown())
+	return &plan.Decision{Approved: a.confirm("Approve this plan?"), Plan: p}, nil
+}
+
+// updatePlan sets the status of a step of the approved plan
+func (a *Agent) updatePlan(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+	updatePlanInput := UpdatePlanInput{}
+	if err := json.Unmarshal(input, &updatePlanInput); err != nil {
+		return "", err
+	}
+	status, err := plan.ParseStatus(updatePlanInput.Status)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	if a.plan == nil {
+		a.mu.Unlock()
+		return "", errors.New("there is no approved plan")
+	}
+	if updatePlanInput.Step < 1 || updatePlanInput.Step > len(a.plan.Steps) {
+		a.mu.Unlock()
+		return "", fmt.Errorf("step %d does not exist; the plan has %d steps", updatePlanInput.Step, len(a.plan.Steps))
+	}
+	a.plan.Steps[updatePlanInput.Step-1].Status = status
+	p := copyPlan(a.plan)
+	a.mu.Unlock()
+
+	a.emit(Event{Type: EventPlanUpdated, Text: p.Checklist()})
+	finished, total := p.Progress()
+	return fmt.Sprintf("Step %d is %s; %d of %d steps finished.", updatePlanInput.Step, status, finished, total), nil
+}
+
+// planCommand enters or leaves plan mode and shows or drops the plan
+func (a *Agent) planCommand(ctx context.Context, args string) (string, error) {
+	switch args {
+	case "":
+		a.SetPlanning(true)
+		return "Plan mode: Claude will investigate with read-only tools and propose a plan for you to approve. /plan off leaves it.", nil
+	case "off":
+		if !a.Planning() {
+			return "Not in plan mode.", nil
+		}
+		a.SetPlanning(false)
+		a.addNote("The user left plan mode; all tools are available again.")
+		return "Left plan mode.", nil
+	case "show":
+		p := a.Plan()
+		if p == nil {
+			return "No plan has been approved.", nil
+		}
+		return p.Checklist(), nil
+	case "clear":
+		if a.Plan() == nil {
+			return "No plan has been approved.", nil
+		}
+		a.setPlan(nil)
+		a.addNote("The user dropped the approved plan; it no longer needs to be followed.")
+		return "Dropped the plan.", nil
+	}
+
+	// Anything else is a task to plan
+	a.SetPlanning(true)
+	// Prompt reports its own failures as events
+	a.Prompt(ctx, args)
+	return "", nil
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/plan"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// scriptedApprover answers plan approvals with the decisions it is given, in order
+type scriptedApprover struct {
+	decisions []func(p *plan.Plan) *plan.Decision
+	asked     int
+}
+
+func (s *scriptedApprover) ApprovePlan(ctx context.Context, p *plan.Plan) (*plan.Decision, error) {
+	decision := s.decisions[s.asked](p)
+	s.asked++
+	return decision, nil
+}
+
+// toolNames lists the names of the tools Claude is offered
+func toolNames(a *Agent) []string {
+	var names []string
+	for _, tool := range a.activeTools() {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestPlanTransition(t *testing.T) {
+	noop := func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) { return "ok", nil }
+	a := NewAgent(nil, nil, []tools.ToolDefinition{
+		{Name: "read_file", ReadOnly: true, Function: noop},
+		{Name: "edit_file", Function: noop},
+	}, &tools.Env{WorkspaceRoot: t.TempDir()}, nil)
+	edited := &plan.Plan{Summary: "Edited.", Steps: []plan.Step{{Title: "First", Status: plan.Pending}, {Title: "Second", Status: plan.Pending}}}
+	approver := &scriptedApprover{decisions: []func(p *plan.Plan) *plan.Decision{
+		func(p *plan.Plan) *plan.Decision { return &plan.Decision{Feedback: "add a step for the docs"} },
+		func(p *plan.Plan) *plan.Decision { return &plan.Decision{Approved: true, Plan: edited, Edited: true} },
+	}}
+	a.SetPlanApprover(approver)
+	a.SetPlanning(true)
+	ctx := context.Background()
+
+	if got, want := toolNames(a), []string{"read_file", "delegate", "submit_plan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("plan mode offers %q, want %q", got, want)
+	}
+	if output, isError, _ := a.executeTool(ctx, "toolu_1", "update_plan", json.RawMessage(`{"step": 1, "status": "done"}`)); !isError || !strings.Contains(output, "not found") {
+		t.Errorf("update_plan in plan mode: got %q (error %t), want it unavailable", output, isError)
+	}
+
+	submit := json.RawMessage(`{"summary": "Do it.", "steps": [{"title": "First"}, {"title": "Docs", "details": "README.md"}]}`)
+	if output, isError, _ := a.executeTool(ctx, "toolu_2", "submit_plan", json.RawMessage(`{"summary": "Do it.", "steps": []}`)); !isError || !strings.Contains(output, "no steps") || approver.asked != 0 {
+		t.Errorf("submit_plan without steps: got %q (error %t), want it refused before asking the user", output, isError)
+	}
+	if output, isError, _ := a.executeTool(ctx, "toolu_3", "submit_plan", submit); !isError || !strings.Contains(output, "add a step for the docs") || !a.Planning() {
+		t.Errorf("rejected submit_plan: got %q (error %t, planning %t), want the feedback and plan mode kept", output, isError, a.Planning())
+	}
+
+	output, isError, _ := a.executeTool(ctx, "toolu_4", "submit_plan", submit)
+	if isError || !strings.Contains(output, "update_plan") || !strings.Contains(output, edited.Markdown()) {
+		t.Errorf("approved submit_plan: got %q (error %t), want the instructions and the edited plan", output, isError)
+	}
+	if a.Planning() || !reflect.DeepEqual(a.Plan(), edited) {
+		t.Errorf("after approval: planning %t with plan %+v, want the edited plan carried out", a.Planning(), a.Plan())
+	}
+	if got, want := toolNames(a), []string{"read_file", "edit_file", "delegate", "update_plan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("carrying out the plan offers %q, want %q", got, want)
+	}
+
+	updates := []struct {
+		input   string
+		output  string
+		isError bool
+	}{
+		{input: `{"step": 1, "status": "done"}`, output: "Step 1 is done; 1 of 2 steps finished."},
+		{input: `{"step": 2, "status": "in_progress"}`, output: "Step 2 is in_progress; 1 of 2 steps finished."},
+		{input: `{"step": 3, "status": "done"}`, output: "step 3 does not exist; the plan has 2 steps", isError: true},
+		{input: `{"step": 2, "status": "finished"}`, output: "unknown status", isError: true},
+	}
+	for _, update := range updates {
+		output, isError, _ := a.executeTool(ctx, "toolu_5", "update_plan", json.RawMessage(update.input))
+		if isError != update.isError || !strings.Contains(output, update.output) {
+			t.Errorf("update_plan %s: got %q (error %t), want %q", update.input, output, isError, update.output)
+		}
+	}
+	if prompt := a.planPrompt(); !strings.Contains(prompt, "(1 of 2 steps finished)") || !strings.Contains(prompt, "2. [~] Second") {
+		t.Errorf("plan prompt %q does not show the progress", prompt)
+	}
+	if edited.Steps[0].Status != plan.Pending {
+		t.Error("update_plan changed the approver's copy of the plan")
+	}
+}
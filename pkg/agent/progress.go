@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"bytes"
+	"sync"
+)
+
+// progressWriter turns tool output into progress events, one line at a time
+type progressWriter struct {
+	mu   sync.Mutex
+	emit func(line string)
+	line bytes.Buffer
+}
+
+// newProgressWriter calls emit for every complete line written to it
+func newProgressWriter(emit func(line string)) *progressWriter {
+	return &progressWriter{emit: emit}
+}
+
+// Write buffers p and emits every completed line
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.line.Write(p)
+	for {
+		i := bytes.IndexByte(w.line.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := w.line.Next(i + 1)
+		w.emit(string(line[:i]))
+	}
+	return len(p), nil
+}
+
+// Flush emits any trailing output that did not end in a newline
+func (w *progressWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.line.Len() == 0 {
+		return
+	}
+	w.emit(w.line.String())
+	w.line.Reset()
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// systemPrompt is sent as the system prompt of every request
+const systemPrompt = "You are a coding assistant. You can help me with programming tasks. I'll give you tasks, and you can use tools to help me complete them."
+
+// maxTokens caps the length of each response
+const maxTokens = 4096
+
+// conversationBreakpoints is how many cache breakpoints trail the conversation.
+// The API allows four in total; the system prompt and tools use the other two.
+const conversationBreakpoints = 2
+
+// buildParams assembles the request for the next response to the conversation.
+// With prompt caching enabled, cache breakpoints are placed after the system
+// prompt, after the tool definitions and on the latest user messages, so each
+// request in a tool loop reads the previous request's prefix from the cache.
+func (a *Agent) buildParams(conversation []anthropic.MessageParam) anthropic.MessageNewParams {
+	caching := a.config.PromptCaching
+
+	system := []anthropic.TextBlockParam{{Text: systemPrompt}}
+	if prompt := a.instructionsPrompt(); prompt != "" {
+		system = append(system, anthropic.TextBlockParam{Text: prompt})
+	}
+	if prompt := a.memoryPrompt(conversation); prompt != "" {
+		system = append(system, anthropic.TextBlockParam{Text: prompt})
+	}
+	if caching {
+		system[len(system)-1].CacheControl = ephemeralCache()
+	}
+	// The plan and todo list change as work progresses, so they follow the cached prompt
+	if prompt := a.planPrompt(); prompt != "" {
+		system = append(system, anthropic.TextBlockParam{Text: prompt})
+	}
+	if prompt := a.todoPrompt(); prompt != "" {
+		system = append(system, anthropic.TextBlockParam{Text: prompt})
+	}
+
+	// Convert tools to the format expected by Claude
+	var anthropicTools []anthropic.ToolUnionParam
+	for _, tool := range a.activeTools() {
+		anthropicTools = append(anthropicTools, anthropic.ToolUnionParam{
+			OfTool: &anthropic.ToolParam{
+				Name:        tool.Name,
+				Description: anthropic.String(tool.Description),
+				InputSchema: tool.InputSchema,
+			},
+		})
+	}
+	if caching && len(anthropicTools) > 0 {
+		anthropicTools[len(anthropicTools)-1].OfTool.CacheControl = ephemeralCache()
+	}
+
+	messages := conversation
+	if caching {
+		messages = withConversationBreakpoints(conversation, conversationBreakpoints)
+	}
+
+	return anthropic.MessageNewParams{
+		Model:     a.currentModel(),
+		MaxTokens: int64(maxTokens),
+		System:    system,
+		Messages:  messages,
+		Tools:     anthropicTools,
+	}
+}
+
+// withConversationBreakpoints returns a copy of the conversation with cache
+// breakpoints on the last block of its final n user messages. The rolling
+// breakpoints let the next request reuse everything up to this one. Blocks
+// are copied so the stored conversation is never modified.
+func withConversationBreakpoints(conversation []anthropic.MessageParam, n int) []anthropic.MessageParam {
+	messages := append([]anthropic.MessageParam(nil), conversation...)
+	for i := len(messages) - 1; i >= 0 && n > 0; i-- {
+		msg := messages[i]
+		if msg.Role != anthropic.MessageParamRoleUser || len(msg.Content) == 0 {
+			continue
+		}
+
+		content := append([]anthropic.ContentBlockParamUnion(nil), msg.Content...)
+		last := len(content) - 1
+		switch block := content[last]; {
+		case block.OfRequestTextBlock != nil:
+			text := *block.OfRequestTextBlock
+			text.CacheControl = ephemeralCache()
+			content[last] = anthropic.ContentBlockParamUnion{OfRequestTextBlock: &text}
+		case block.OfRequestToolResultBlock != nil:
+			result := *block.OfRequestToolResultBlock
+			result.CacheControl = ephemeralCache()
+			content[last] = anthropic.ContentBlockParamUnion{OfRequestToolResultBlock: &result}
+		default:
+			continue
+		}
+
+		msg.Content = content
+		messages[i] = msg
+		n--
+	}
+	return messages
+}
+
+// ephemeralCache returns a cache breakpoint; the zero value would be omitted from the request
+func ephemeralCache() anthropic.CacheControlEphemeralParam {
+	return anthropic.CacheControlEphemeralParam{Type: "ephemeral"}
+}
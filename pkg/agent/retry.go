@@ -0,0 +1,276 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// ErrorKind classifies a failed API call
+type ErrorKind int
+
+const (
+	ErrorUnknown ErrorKind = iota
+	ErrorAuth
+	ErrorRateLimit
+	ErrorOverloaded
+	ErrorServer
+	ErrorNetwork
+	ErrorContextLength
+	ErrorInvalidRequest
+)
+
+// String returns a short name for the kind
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorAuth:
+		return "authentication"
+	case ErrorRateLimit:
+		return "rate limit"
+	case ErrorOverloaded:
+		return "overloaded"
+	case ErrorServer:
+		return "server"
+	case ErrorNetwork:
+		return "network"
+	case ErrorContextLength:
+		return "context length"
+	case ErrorInvalidRequest:
+		return "invalid request"
+	default:
+		return "unknown"
+	}
+}
+
+// Retryable reports whether a call failing this way may succeed if repeated
+func (k ErrorKind) Retryable() bool {
+	switch k {
+	case ErrorRateLimit, ErrorOverloaded, ErrorServer, ErrorNetwork:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIError is a classified error from the Anthropic API
+type APIError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s error (%d): %s", e.Kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s error: %s", e.Kind, e.Message)
+}
+
+// Unwrap returns the underlying error
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// UserMessage explains the error to the user and what they can do about it
+func (e *APIError) UserMessage() string {
+	switch e.Kind {
+	case ErrorAuth:
+		return "Authentication failed. Check that ANTHROPIC_API_KEY is set to a valid key."
+	case ErrorRateLimit:
+		return "Rate limit reached and retries were exhausted. Wait a moment and try again."
+	case ErrorOverloaded:
+		return "The API is overloaded and retries were exhausted. Try again shortly."
+	case ErrorServer:
+		return fmt.Sprintf("The API returned a server error (%d). Try again shortly.", e.StatusCode)
+	case ErrorNetwork:
+		return "Could not reach the API. Check your network connection and try again."
+	case ErrorContextLength:
+		return "The conversation is too long for the model's context window. Start a new session or ask for a shorter task."
+	case ErrorInvalidRequest:
+		return fmt.Sprintf("The API rejected the request: %s", e.Message)
+	default:
+		return fmt.Sprintf("Request failed: %s", e.Message)
+	}
+}
+
+// RetryPolicy controls how failed API calls are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used unless the agent is given another one
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    60 * time.Second,
+}
+
+// delay returns how long to wait before the given retry (1-based), honoring retry-after
+func (p RetryPolicy) delay(attempt int, apiErr *APIError) time.Duration {
+	if apiErr.RetryAfter > 0 {
+		return min(apiErr.RetryAfter, p.MaxDelay)
+	}
+
+	// Exponential backoff with full jitter
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// retry calls fn until it succeeds, fails permanently or attempts run out.
+// onRetry is told about every retry before the agent waits for it.
+func (p RetryPolicy) retry(ctx context.Context, fn func() error, onRetry func(attempt int, delay time.Duration, err *APIError)) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		apiErr := classifyError(err)
+		if !apiErr.Kind.Retryable() || attempt >= p.MaxAttempts {
+			return apiErr
+		}
+
+		wait := p.delay(attempt, apiErr)
+		if onRetry != nil {
+			onRetry(attempt, wait, apiErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// errorBody is the JSON body the API returns with an error status
+type errorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamErrorPrefix starts the error the SDK returns for an error event in a response stream
+const streamErrorPrefix = "received error while streaming: "
+
+// classifyStreamError classifies an error event received part way through a
+// streamed response, returning nil if err is not one
+func classifyStreamError(err error) *APIError {
+	data, ok := strings.CutPrefix(err.Error(), streamErrorPrefix)
+	if !ok {
+		return nil
+	}
+	var body errorBody
+	if json.Unmarshal([]byte(data), &body) != nil {
+		return nil
+	}
+
+	result := &APIError{Kind: ErrorUnknown, Message: body.Error.Message, Err: err}
+	switch body.Error.Type {
+	case "overloaded_error":
+		result.Kind = ErrorOverloaded
+	case "rate_limit_error":
+		result.Kind = ErrorRateLimit
+	case "api_error":
+		result.Kind = ErrorServer
+	}
+	return result
+}
+
+// classifyError turns an error from the SDK into an APIError
+func classifyError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var sdkErr *anthropic.Error
+	if !errors.As(err, &sdkErr) {
+		if streamErr := classifyStreamError(err); streamErr != nil {
+			return streamErr
+		}
+		kind := ErrorUnknown
+		var netErr net.Error
+		if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			kind = ErrorNetwork
+		}
+		return &APIError{Kind: kind, Message: err.Error(), Err: err}
+	}
+
+	var body errorBody
+	_ = json.Unmarshal([]byte(sdkErr.RawJSON()), &body)
+	result := &APIError{
+		StatusCode: sdkErr.StatusCode,
+		Message:    body.Error.Message,
+		Err:        err,
+	}
+	if result.Message == "" {
+		result.Message = http.StatusText(sdkErr.StatusCode)
+	}
+	if sdkErr.Response != nil {
+		result.RetryAfter = parseRetryAfter(sdkErr.Response.Header)
+	}
+
+	switch {
+	case sdkErr.StatusCode == http.StatusUnauthorized || sdkErr.StatusCode == http.StatusForbidden:
+		result.Kind = ErrorAuth
+	case sdkErr.StatusCode == http.StatusTooManyRequests:
+		result.Kind = ErrorRateLimit
+	case sdkErr.StatusCode == 529 || body.Error.Type == "overloaded_error":
+		result.Kind = ErrorOverloaded
+	case sdkErr.StatusCode == http.StatusRequestEntityTooLarge || isContextLengthMessage(result.Message):
+		result.Kind = ErrorContextLength
+	case sdkErr.StatusCode == http.StatusRequestTimeout || sdkErr.StatusCode == http.StatusConflict || sdkErr.StatusCode >= 500:
+		result.Kind = ErrorServer
+	case sdkErr.StatusCode >= 400:
+		result.Kind = ErrorInvalidRequest
+	}
+	return result
+}
+
+// isContextLengthMessage reports whether an invalid request was caused by the prompt size
+func isContextLengthMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "prompt is too long") || strings.Contains(msg, "context window") || strings.Contains(msg, "too many tokens")
+}
+
+// parseRetryAfter reads the retry-after-ms or retry-after header
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
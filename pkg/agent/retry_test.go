@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// sdkError builds the error the SDK returns for a response with status and JSON body
+func sdkError(t *testing.T, status int, body string, header http.Header) error {
+	t.Helper()
+	err := &anthropic.Error{}
+	if unmarshalErr := err.UnmarshalJSON([]byte(body)); unmarshalErr != nil {
+		t.Fatal(unmarshalErr)
+	}
+	err.StatusCode = status
+	err.Request, _ = http.NewRequest(http.MethodPost, "https://api.anthropic.com/v1/messages", nil)
+	err.Response = &http.Response{StatusCode: status, Header: header}
+	return err
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		kind        ErrorKind
+		message     string
+		retryAfter  time.Duration
+		wantRetried bool
+	}{
+		{name: "unauthorized", err: sdkError(t, 401, `{"error": {"type": "authentication_error", "message": "invalid x-api-key"}}`, nil),
+			kind: ErrorAuth, message: "invalid x-api-key"},
+		{name: "forbidden", err: sdkError(t, 403, `{}`, nil), kind: ErrorAuth, message: "Forbidden"},
+		{name: "rate limit with retry-after", err: sdkError(t, 429, `{"error": {"type": "rate_limit_error", "message": "slow down"}}`, http.Header{"Retry-After": {"7"}}),
+			kind: ErrorRateLimit, message: "slow down", retryAfter: 7 * time.Second, wantRetried: true},
+		{name: "529 overloaded", err: sdkError(t, 529, `{}`, nil), kind: ErrorOverloaded, wantRetried: true},
+		{name: "overloaded type on another status", err: sdkError(t, 500, `{"error": {"type": "overloaded_error", "message": "Overloaded"}}`, nil),
+			kind: ErrorOverloaded, message: "Overloaded", wantRetried: true},
+		{name: "request too large", err: sdkError(t, 413, `{}`, nil), kind: ErrorContextLength},
+		{name: "prompt too long", err: sdkError(t, 400, `{"error": {"type": "invalid_request_error", "message": "prompt is too long: 210000 tokens > 200000 maximum"}}`, nil),
+			kind: ErrorContextLength, message: "prompt is too long: 210000 tokens > 200000 maximum"},
+		{name: "other bad request", err: sdkError(t, 400, `{"error": {"type": "invalid_request_error", "message": "max_tokens: field required"}}`, nil),
+			kind: ErrorInvalidRequest, message: "max_tokens: field required"},
+		{name: "not found", err: sdkError(t, 404, `{}`, nil), kind: ErrorInvalidRequest},
+		{name: "timeout", err: sdkError(t, 408, `{}`, nil), kind: ErrorServer, wantRetried: true},
+		{name: "conflict", err: sdkError(t, 409, `{}`, nil), kind: ErrorServer, wantRetried: true},
+		{name: "internal error", err: sdkError(t, 500, `{"error": {"type": "api_error", "message": "Internal server error"}}`, nil),
+			kind: ErrorServer, message: "Internal server error", wantRetried: true},
+		{name: "bad gateway", err: sdkError(t, 502, `{}`, nil), kind: ErrorServer, wantRetried: true},
+		{name: "wrapped SDK error", err: fmt.Errorf("request failed: %w", sdkError(t, 401, `{}`, nil)), kind: ErrorAuth},
+		{name: "connection cut", err: fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), kind: ErrorNetwork, message: "reading body: unexpected EOF", wantRetried: true},
+		{name: "unknown", err: errors.New("something else"), kind: ErrorUnknown, message: "something else"},
+		{name: "classified already", err: &APIError{Kind: ErrorAuth, Message: "kept"}, kind: ErrorAuth, message: "kept"},
+	}
+	for _, test := range tests {
+		got := classifyError(test.err)
+		if got.Kind != test.kind {
+			t.Errorf("%s: kind = %s, want %s", test.name, got.Kind, test.kind)
+		}
+		if test.message != "" && got.Message != test.message {
+			t.Errorf("%s: message = %q, want %q", test.name, got.Message, test.message)
+		}
+		if got.RetryAfter != test.retryAfter {
+			t.Errorf("%s: retry after = %s, want %s", test.name, got.RetryAfter, test.retryAfter)
+		}
+		if got.Kind.Retryable() != test.wantRetried {
+			t.Errorf("%s: retryable = %t, want %t", test.name, got.Kind.Retryable(), test.wantRetried)
+		}
+		if !errors.Is(got, test.err) && got != test.err {
+			t.Errorf("%s: classified error does not wrap the original", test.name)
+		}
+	}
+}
+
+func TestClassifyStreamError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		kind        ErrorKind
+		message     string
+		wantRetried bool
+	}{
+		{name: "overloaded while streaming", err: errors.New(streamErrorPrefix + `{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`),
+			kind: ErrorOverloaded, message: "Overloaded", wantRetried: true},
+		{name: "rate limit while streaming", err: errors.New(streamErrorPrefix + `{"type": "error", "error": {"type": "rate_limit_error", "message": "slow down"}}`),
+			kind: ErrorRateLimit, message: "slow down", wantRetried: true},
+		{name: "api error while streaming", err: errors.New(streamErrorPrefix + `{"type": "error", "error": {"type": "api_error", "message": "boom"}}`),
+			kind: ErrorServer, message: "boom", wantRetried: true},
+		{name: "other error while streaming", err: errors.New(streamErrorPrefix + `{"type": "error", "error": {"type": "invalid_request_error", "message": "bad"}}`),
+			kind: ErrorUnknown, message: "bad"},
+		{name: "stream error without JSON", err: errors.New(streamErrorPrefix + "garbage"), kind: ErrorUnknown, message: streamErrorPrefix + "garbage"},
+		{name: "connection cut", err: io.ErrUnexpectedEOF, kind: ErrorNetwork, message: "unexpected EOF", wantRetried: true},
+	}
+	for _, test := range tests {
+		got := classifyError(test.err)
+		if got.Kind != test.kind || got.Message != test.message {
+			t.Errorf("%s: got %s error %q, want %s error %q", test.name, got.Kind, got.Message, test.kind, test.message)
+		}
+		if got.Kind.Retryable() != test.wantRetried {
+			t.Errorf("%s: retryable = %t, want %t", test.name, got.Kind.Retryable(), test.wantRetried)
+		}
+		if !errors.Is(got, test.err) {
+			t.Errorf("%s: classified error does not wrap the original", test.name)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "none", header: http.Header{}, want: 0},
+		{name: "milliseconds", header: http.Header{"Retry-After-Ms": {"1500"}}, want: 1500 * time.Millisecond},
+		{name: "milliseconds win", header: http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"10"}}, want: 250 * time.Millisecond},
+		{name: "seconds", header: http.Header{"Retry-After": {"2.5"}}, want: 2500 * time.Millisecond},
+		{name: "zero", header: http.Header{"Retry-After": {"0"}}, want: 0},
+		{name: "garbage", header: http.Header{"Retry-After": {"soon"}}, want: 0},
+	}
+	for _, test := range tests {
+		if got := parseRetryAfter(test.header); got != test.want {
+			t.Errorf("%s: parseRetryAfter = %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	at := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(http.Header{"Retry-After": {at}}); got < 28*time.Second || got > 30*time.Second {
+		t.Errorf("HTTP date: parseRetryAfter = %s, want about 30s", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+	if got := policy.delay(1, &APIError{RetryAfter: 3 * time.Second}); got != 3*time.Second {
+		t.Errorf("retry-after: delay = %s, want 3s", got)
+	}
+	if got := policy.delay(1, &APIError{RetryAfter: time.Hour}); got != policy.MaxDelay {
+		t.Errorf("long retry-after: delay = %s, want the max delay", got)
+	}
+	for attempt := 1; attempt <= 70; attempt++ {
+		if got := policy.delay(attempt, &APIError{}); got <= 0 || got > policy.MaxDelay {
+			t.Errorf("attempt %d: delay = %s, want within (0, %s]", attempt, got, policy.MaxDelay)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		kind     ErrorKind
+	}{
+		{name: "succeeds at once", errs: []error{nil}, attempts: 1},
+		{name: "succeeds after retries", errs: []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, nil}, attempts: 3},
+		{name: "gives up after max attempts", errs: []error{io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, nil}, attempts: 3, kind: ErrorNetwork},
+		{name: "does not retry permanent errors", errs: []error{&APIError{Kind: ErrorAuth}, nil}, attempts: 1, kind: ErrorAuth},
+	}
+	for _, test := range tests {
+		attempts, retries := 0, 0
+		err := policy.retry(context.Background(), func() error {
+			attempts++
+			return test.errs[attempts-1]
+		}, func(int, time.Duration, *APIError) { retries++ })
+
+		if attempts != test.attempts || retries != attempts-1 {
+			t.Errorf("%s: %d attempts and %d retries, want %d attempts", test.name, attempts, retries, test.attempts)
+		}
+		var apiErr *APIError
+		switch {
+		case test.kind == ErrorUnknown && err != nil:
+			t.Errorf("%s: got %v, want success", test.name, err)
+		case test.kind != ErrorUnknown && (!errors.As(err, &apiErr) || apiErr.Kind != test.kind):
+			t.Errorf("%s: got %v, want a %s error", test.name, err, test.kind)
+		}
+	}
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := policy.retry(ctx, func() error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	}, func(int, time.Duration, *APIError) { cancel() })
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want context.Canceled after 1", err, attempts)
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/markdown"
+	"golang.org/x/term"
+)
+
+// TerminalPrinter renders agent events as colored text on a terminal
+type TerminalPrinter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	status  string
+	started time.Time
+	stop    chan struct{}
+	done    chan struct{}
+	// fd is the terminal out writes to, or -1 when it is not one
+	fd int
+}
+
+// NewTerminalPrinter creates a printer writing to out. Subscribe its Handle
+// method to an agent to show the agent's events. Claude's markdown is
+// rendered when out is a terminal and shown as it is otherwise.
+func NewTerminalPrinter(out io.Writer) *TerminalPrinter {
+	fd := -1
+	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fd = int(f.Fd())
+	}
+	return &TerminalPrinter{out: out, fd: fd}
+}
+
+// Handle implements EventHandler
+func (t *TerminalPrinter) Handle(e Event) {
+	switch e.Type {
+	case EventRequestStarted:
+		t.startSpinner()
+	case EventRetry:
+		t.mu.Lock()
+		t.status = e.Text
+		t.mu.Unlock()
+	case EventRequestFinished:
+		t.stopSpinner()
+	case EventText:
+		t.printText(e.Text)
+	case EventToolStarted:
+		t.printf("tool: %s(%s)\n", e.ToolName, string(e.Input))
+	case EventToolDenied:
+		t.printf("\u001b[90mtool: %s not run: %s\u001b[0m\n", e.ToolName, e.Text)
+	case EventToolProgress:
+		t.printf("\u001b[90m  │ %s\u001b[0m\n", e.Text)
+	case EventPlanUpdated, EventTodosUpdated:
+		if e.Text == "" {
+			return
+		}
+		t.printf("\u001b[1m%s\u001b[0m\n", e.Text)
+	case EventNotice:
+		t.printf("\u001b[90m%s\u001b[0m\n", e.Text)
+	case EventError:
+		t.printf("\u001b[91mError\u001b[0m: %s\n", e.Text)
+	}
+}
+
+// printText shows Claude's response, rendering its markdown on a terminal
+func (t *TerminalPrinter) printText(text string) {
+	if t.fd < 0 {
+		t.printf("Claude: %s\n", text)
+		return
+	}
+	t.printf("\u001b[1mClaude:\u001b[0m\n%s\n", markdown.Render(text, markdown.TerminalWidth(t.fd)))
+}
+
+// printf writes to the terminal, serialized with the spinner
+func (t *TerminalPrinter) printf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.out, format, args...)
+}
+
+// startSpinner shows a loading message with the elapsed time until stopSpinner
+func (t *TerminalPrinter) startSpinner() {
+	t.stopSpinner()
+
+	t.mu.Lock()
+	t.status = "Thinking..."
+	t.started = time.Now()
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	stop, done := t.stop, t.done
+	t.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				t.mu.Lock()
+				elapsed := time.Since(t.started).Seconds()
+				fmt.Fprintf(t.out, "\r\033[K%s %.1fs elapsed", t.status, elapsed)
+				t.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// stopSpinner stops the loading message and clears its line
+func (t *TerminalPrinter) stopSpinner() {
+	t.mu.Lock()
+	stop, done := t.stop, t.done
+	t.stop, t.done = nil, nil
+	t.mu.Unlock()
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-done
+	t.printf("\r\033[K") // Clear the current line
+}
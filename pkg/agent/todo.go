@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// trackTodos keeps a todo list in the agent's environment, reporting each
+// change as an event
+func (a *Agent) trackTodos() {
+	if a.env.Todos == nil {
+		a.env.Todos = tools.NewTodoList()
+	}
+	a.env.Todos.OnChange(func(items []tools.TodoItem) {
+		text := ""
+		if len(items) > 0 {
+			text = tools.FormatTodos(items)
+		}
+		a.emit(Event{Type: EventTodosUpdated, Text: text})
+	})
+}
+
+// todoPrompt returns the system prompt block holding the todo list, or ""
+// when it is empty. Sending it with every request keeps the list in front of
+// Claude however long the conversation gets. The agent does not compact
+// conversations, so nothing reinjects the list after a compaction.
+func (a *Agent) todoPrompt() string {
+	items := a.env.Todos.Items()
+	if len(items) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Your todo list for the current task, which you keep with the todo tool:\n\n%s", tools.FormatTodos(items))
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+// FileName is the name of the config file in the user and project config directories
+const FileName = "config.json"
+
+// Config holds the agent's settings
+type Config struct {
+	// Model is the Claude model the agent talks to
+	Model string `json:"model,omitempty"`
+	// PromptCaching places cache breakpoints on the system prompt, tools and conversation
+	PromptCaching bool `json:"prompt_caching"`
+	// Prices adds to or overrides the built-in price table, in USD per million tokens
+	Prices usage.PriceTable `json:"prices,omitempty"`
+	// Limits caps what a single turn and the whole session may consume
+	Limits Budget `json:"limits"`
+	// Permissions decides which tool calls run without asking
+	Permissions Permissions `json:"permissions"`
+	// MCPServers are Model Context Protocol servers whose tools the agent can use, by name
+	MCPServers map[string]MCPServer `json:"mcp_servers,omitempty"`
+	// Tools are external executables offered to Claude as tools, by name
+	Tools map[string]PluginTool `json:"tools,omitempty"`
+	// Hooks are shell commands run around tool calls, turns and sessions
+	Hooks Hooks `json:"hooks,omitempty"`
+	// SubAgents configures the agents Claude starts with the delegate tool
+	SubAgents SubAgents `json:"sub_agents,omitempty"`
+
+	// untrusted holds the project settings ignored because the workspace is not trusted
+	untrusted map[string]json.RawMessage
+}
+
+// SubAgents limits the agents Claude delegates research to
+type SubAgents struct {
+	// MaxTokens caps the tokens each sub-agent uses; zero means the default
+	MaxTokens int64 `json:"max_tokens,omitempty"`
+	// MaxRequests caps the requests each sub-agent makes; zero means the default
+	MaxRequests int  `json:"max_requests,omitempty"`
+	Disabled    bool `json:"disabled,omitempty"`
+}
+
+// Hooks lists the hooks to run for each lifecycle event, in order
+type Hooks struct {
+	PreToolUse          []Hook `json:"pre_tool_use,omitempty"`
+	PostToolUse         []Hook `json:"post_tool_use,omitempty"`
+	UserPromptSubmitted []Hook `json:"user_prompt_submitted,omitempty"`
+	TurnEnd             []Hook `json:"turn_end,omitempty"`
+	SessionStart        []Hook `json:"session_start,omitempty"`
+	SessionEnd          []Hook `json:"session_end,omitempty"`
+}
+
+// Hook is a shell command run with the event as JSON on stdin
+type Hook struct {
+	// Matcher limits tool hooks to tools whose name matches; * matches any
+	// characters and an empty matcher matches every tool
+	Matcher string `json:"matcher,omitempty"`
+	Command string `json:"command"`
+	// Timeout limits the command; zero means the default of one minute
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// PluginTool describes an executable tool. It is run in the workspace with
+// the tool input as JSON on stdin and writes a JSON result to stdout.
+type PluginTool struct {
+	Command     string            `json:"command"`
+	Args        []string          `json:"args,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Description string            `json:"description"`
+	// InputSchema is the JSON schema of the tool input
+	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+	// Timeout limits each call; zero means the default of one minute
+	Timeout Duration `json:"timeout,omitempty"`
+	// ReadOnly marks tools without side effects, which run without asking
+	ReadOnly bool `json:"read_only,omitempty"`
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// MCPServer describes how to reach an MCP server: a command to launch and talk
+// to over stdio, or the URL of a streamable HTTP endpoint
+type MCPServer struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout limits each tool call; zero means no limit
+	Timeout  Duration `json:"timeout,omitempty"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+// Permissions configures the permission policy
+type Permissions struct {
+	// Mode is one of ask, accept-edits, allow-all or read-only
+	Mode string `json:"mode,omitempty"`
+	// Allow lists rules, such as "run_command(go test *)", that run without asking
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists rules that never run
+	Deny []string `json:"deny,omitempty"`
+	// ReviewEdits shows each file edit for review before it is written
+	ReviewEdits bool `json:"review_edits,omitempty"`
+}
+
+// Budget holds the limits applied to each turn and to the session as a whole
+type Budget struct {
+	Turn    LimitSet `json:"turn"`
+	Session LimitSet `json:"session"`
+}
+
+// LimitSet pairs soft limits, which pause and ask to continue, with hard limits, which stop
+type LimitSet struct {
+	Soft Limits `json:"soft"`
+	Hard Limits `json:"hard"`
+}
+
+// Limits caps resource use; a zero field means no limit
+type Limits struct {
+	Tokens    int64    `json:"tokens,omitempty"`
+	Cost      float64  `json:"cost,omitempty"`
+	Time      Duration `json:"time,omitempty"`
+	ToolCalls int      `json:"tool_calls,omitempty"`
+	Commands  int      `json:"commands,omitempty"`
+	Requests  int      `json:"requests,omitempty"`
+}
+
+// Duration is a time.Duration written in config as a string such as "10m"
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"10m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON formats the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Default returns the settings used when no config file overrides them
+func Default() *Config {
+	return &Config{
+		Model:         "claude-3-opus-20240229",
+		PromptCaching: true,
+		Permissions: Permissions{
+			Mode: "allow-all",
+		},
+	}
+}
+
+// UserDir returns the per-user config directory, ~/.coding-agent
+func UserDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".coding-agent"), nil
+}
+
+// ProjectDir returns the per-project config directory inside workspaceRoot
+func ProjectDir(workspaceRoot string) string {
+	return filepath.Join(workspaceRoot, ".coding-agent")
+}
+
+// Load reads the user config and then the project config on top of the defaults.
+// Settings in the project config take precedence; missing files are skipped.
+// Hooks, tools, MCP servers and permissions in the project config are only
+// used once the user trusts the workspace (see Trust); until then they are
+// ignored and listed by Untrusted.
+func Load(workspaceRoot string) (*Config, error) {
+	cfg := Default()
+
+	userPath := ""
+	if dir, err := UserDir(); err == nil {
+		userPath = filepath.Join(dir, FileName)
+		if err := loadFile(userPath, cfg); err != nil {
+			return nil, err
+		}
+	}
+	// In the home directory the project config is the user config, read already
+	if workspaceRoot != "" && filepath.Join(ProjectDir(workspaceRoot), FileName) != userPath {
+		if err := loadProjectFile(workspaceRoot, cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a config file over cfg, leaving settings it does not mention untouched
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadProjectFile decodes the project config over cfg, leaving out its
+// privileged settings unless the user trusts them
+func loadProjectFile(workspaceRoot string, cfg *Config) error {
+	path := filepath.Join(ProjectDir(workspaceRoot), FileName)
+	settings, err := readSettings(path)
+	if err != nil || settings == nil {
+		return err
+	}
+	if found := privileged(settings); len(found) > 0 && !isTrusted(workspaceRoot, found) {
+		for key := range found {
+			delete(settings, key)
+		}
+		cfg.untrusted = found
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// PriceTable returns the built-in prices with the configured ones applied
+func (c *Config) PriceTable() usage.PriceTable {
+	return usage.DefaultPrices.Merge(c.Prices)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// TrustFileName is the name of the file in the user config directory that
+// records which workspaces the user trusts
+const TrustFileName = "trusted.json"
+
+// privilegedKeys are the settings that run commands or change permissions.
+// The project config only sets them once the user trusts the workspace, so
+// opening a cloned repository cannot run its commands.
+var privilegedKeys = []string{"hooks", "tools", "mcp_servers", "permissions"}
+
+// Untrusted returns the names of the project settings that were ignored
+// because the workspace is not trusted, sorted
+func (c *Config) Untrusted() []string {
+	names := make([]string, 0, len(c.untrusted))
+	for name := range c.untrusted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UntrustedSettings returns the ignored project settings as indented JSON
+func (c *Config) UntrustedSettings() string {
+	data, err := json.MarshalIndent(c.untrusted, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Trust records that the user trusts the project config of workspaceRoot
+// as it is now. Changing its privileged settings later needs trust again.
+func Trust(workspaceRoot string) error {
+	settings, err := readSettings(filepath.Join(ProjectDir(workspaceRoot), FileName))
+	if err != nil {
+		return err
+	}
+	trusted, path, err := loadTrusted()
+	if err != nil {
+		return err
+	}
+	trusted[workspaceRoot] = digest(privileged(settings))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// isTrusted reports whether the user trusted these privileged settings of workspaceRoot
+func isTrusted(workspaceRoot string, settings map[string]json.RawMessage) bool {
+	trusted, _, err := loadTrusted()
+	if err != nil {
+		return false
+	}
+	return trusted[workspaceRoot] == digest(settings)
+}
+
+// loadTrusted reads the digest of the trusted settings of each workspace, and
+// returns the path of the file they are kept in
+func loadTrusted() (map[string]string, string, error) {
+	dir, err := UserDir()
+	if err != nil {
+		return nil, "", err
+	}
+	path := filepath.Join(dir, TrustFileName)
+	trusted := map[string]string{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return trusted, path, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return trusted, path, nil
+}
+
+// readSettings reads a config file as its top-level settings; a missing file has none
+func readSettings(path string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// privileged returns the privileged settings among settings
+func privileged(settings map[string]json.RawMessage) map[string]json.RawMessage {
+	found := map[string]json.RawMessage{}
+	for _, key := range privilegedKeys {
+		if value, ok := settings[key]; ok {
+			found[key] = value
+		}
+	}
+	return found
+}
+
+// digest identifies settings regardless of their formatting
+func digest(settings map[string]json.RawMessage) string {
+	// Maps marshal with sorted keys and raw messages compacted
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
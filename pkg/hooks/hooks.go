@@ -0,0 +1,253 @@
+// Package hooks runs the shell commands configured for points in the
+// agent's lifecycle, such as before and after each tool call
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+)
+
+// Event names a point in the lifecycle that hooks can run at
+type Event string
+
+// Lifecycle events
+const (
+	PreToolUse          Event = "pre_tool_use"
+	PostToolUse         Event = "post_tool_use"
+	UserPromptSubmitted Event = "user_prompt_submitted"
+	TurnEnd             Event = "turn_end"
+	SessionStart        Event = "session_start"
+	SessionEnd          Event = "session_end"
+)
+
+// DefaultTimeout limits a hook that sets no timeout
+const DefaultTimeout = time.Minute
+
+// exitBlock is the exit status with which a hook blocks what it was run for
+const exitBlock = 2
+
+// Payload is the JSON a hook receives on stdin. Fields that do not apply to
+// the event are left out.
+type Payload struct {
+	Event         Event           `json:"event"`
+	SessionID     string          `json:"session_id"`
+	WorkspaceRoot string          `json:"workspace_root"`
+	ToolName      string          `json:"tool_name,omitempty"`
+	ToolInput     json.RawMessage `json:"tool_input,omitempty"`
+	ToolOutput    string          `json:"tool_output,omitempty"`
+	ToolError     bool            `json:"tool_error,omitempty"`
+	Prompt        string          `json:"prompt,omitempty"`
+	Response      string          `json:"response,omitempty"`
+	StopReason    string          `json:"stop_reason,omitempty"`
+}
+
+// reply is what a hook may write to stdout as JSON instead of plain text
+type reply struct {
+	// Decision "block" stops the tool call or prompt, like exit status 2
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+	// Input replaces the tool input of a pre_tool_use hook
+	Input json.RawMessage `json:"input"`
+	// Output is fed back to Claude
+	Output string `json:"output"`
+}
+
+// Result is the combined outcome of the hooks run for one event
+type Result struct {
+	// Blocked is set when a hook exited with status 2 or decided "block"
+	Blocked bool
+	Reason  string
+	// Input is the tool input as rewritten by pre_tool_use hooks, or nil
+	Input json.RawMessage
+	// Output is what the hooks wrote for Claude, one hook per line
+	Output string
+	// Errors are hooks that failed without blocking
+	Errors []error
+}
+
+// Runner runs the configured hooks in a workspace
+type Runner struct {
+	hooks  config.Hooks
+	dir    string
+	logger *log.Logger
+}
+
+// New creates a runner for the hooks in cfg, which run in dir
+func New(cfg config.Hooks, dir string, logger *log.Logger) *Runner {
+	return &Runner{hooks: cfg, dir: dir, logger: logger}
+}
+
+// WithoutSession returns a runner for the same hooks but the session_start
+// and session_end ones, for agents working within another agent's session
+func (r *Runner) WithoutSession() *Runner {
+	if r == nil {
+		return nil
+	}
+	cfg := r.hooks
+	cfg.SessionStart, cfg.SessionEnd = nil, nil
+	return &Runner{hooks: cfg, dir: r.dir, logger: r.logger}
+}
+
+// forEvent returns the hooks configured for an event
+func (r *Runner) forEvent(event Event) []config.Hook {
+	switch event {
+	case PreToolUse:
+		return r.hooks.PreToolUse
+	case PostToolUse:
+		return r.hooks.PostToolUse
+	case UserPromptSubmitted:
+		return r.hooks.UserPromptSubmitted
+	case TurnEnd:
+		return r.hooks.TurnEnd
+	case SessionStart:
+		return r.hooks.SessionStart
+	case SessionEnd:
+		return r.hooks.SessionEnd
+	}
+	return nil
+}
+
+// Run runs the hooks for the payload's event in order. A pre_tool_use hook
+// sees the input as rewritten by the hooks before it, and the first hook to
+// block stops the rest. A nil runner runs nothing.
+func (r *Runner) Run(ctx context.Context, p Payload) Result {
+	var result Result
+	if r == nil {
+		return result
+	}
+	var outputs []string
+	for _, hook := range r.forEvent(p.Event) {
+		if !matches(hook.Matcher, p.ToolName) {
+			continue
+		}
+		if result.Input != nil {
+			p.ToolInput = result.Input
+		}
+
+		out, err := r.run(ctx, hook, p)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s hook %q: %w", p.Event, hook.Command, err))
+			continue
+		}
+		if out.Output != "" {
+			outputs = append(outputs, out.Output)
+		}
+		if out.Decision == "block" {
+			result.Blocked = true
+			result.Reason = out.Reason
+			if result.Reason == "" {
+				result.Reason = fmt.Sprintf("no reason given by %q", hook.Command)
+			}
+			break
+		}
+		if len(out.Input) > 0 && p.Event == PreToolUse {
+			result.Input = out.Input
+		}
+	}
+	result.Output = strings.Join(outputs, "\n")
+	return result
+}
+
+// run runs one hook and interprets its exit status and output
+func (r *Runner) run(ctx context.Context, hook config.Hook, p Payload) (*reply, error) {
+	timeout := time.Duration(hook.Timeout)
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	cmd.Dir = r.dir
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"CODING_AGENT_EVENT="+string(p.Event),
+		"CODING_AGENT_SESSION_ID="+p.SessionID,
+		"CODING_AGENT_WORKSPACE="+p.WorkspaceRoot,
+	)
+	if p.ToolName != "" {
+		cmd.Env = append(cmd.Env, "CODING_AGENT_TOOL="+p.ToolName)
+	}
+	if file := inputPath(p.ToolInput); file != "" {
+		cmd.Env = append(cmd.Env, "CODING_AGENT_FILE="+file)
+	}
+
+	start := time.Now()
+	err = cmd.Run()
+	if r.logger != nil {
+		r.logger.Printf("hook: %s %q took %s: %v", p.Event, hook.Command, time.Since(start).Round(time.Millisecond), err)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, fmt.Errorf("timed out after %s", timeout)
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == exitBlock:
+		reason := strings.TrimSpace(stderr.String())
+		if reason == "" {
+			reason = strings.TrimSpace(stdout.String())
+		}
+		return &reply{Decision: "block", Reason: reason}, nil
+	case err != nil:
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", err, msg)
+	}
+	return parseReply(stdout.Bytes()), nil
+}
+
+// parseReply reads a hook's stdout, which is either a JSON reply or plain
+// text for Claude
+func parseReply(data []byte) *reply {
+	data = bytes.TrimSpace(data)
+	var out reply
+	if bytes.HasPrefix(data, []byte("{")) && json.Unmarshal(data, &out) == nil {
+		return &out
+	}
+	return &reply{Output: string(data)}
+}
+
+// matches reports whether a hook's matcher selects the tool. Hooks for events
+// without a tool always run.
+func matches(matcher, tool string) bool {
+	if matcher == "" || matcher == "*" || tool == "" {
+		return true
+	}
+	ok, err := path.Match(matcher, tool)
+	return err == nil && ok
+}
+
+// inputPath returns the path a tool input names, if any
+func inputPath(input json.RawMessage) string {
+	var fields struct {
+		Path string `json:"path"`
+	}
+	if len(input) == 0 || json.Unmarshal(input, &fields) != nil {
+		return ""
+	}
+	return fields.Path
+}
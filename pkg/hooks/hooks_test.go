@@ -0,0 +1,121 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+)
+
+func TestRun(t *testing.T) {
+	readEnv := Payload{Event: PreToolUse, SessionID: "s1", ToolName: "read_file", ToolInput: json.RawMessage(`{"path": ".env"}`)}
+	tests := []struct {
+		name    string
+		hooks   []config.Hook
+		payload Payload
+		blocked bool
+		reason  string
+		input   string
+		output  string
+		errors  int
+	}{
+		{
+			name:    "exit 2 blocks with stderr as the reason",
+			hooks:   []config.Hook{{Matcher: "read_file", Command: "echo secrets are off limits >&2; exit 2"}},
+			payload: readEnv,
+			blocked: true,
+			reason:  "secrets are off limits",
+		},
+		{
+			name:    "a block stops the later hooks",
+			hooks:   []config.Hook{{Command: `echo '{"decision": "block"}'`}, {Command: "touch ran"}},
+			payload: readEnv,
+			blocked: true,
+			reason:  `no reason given by "echo '{\"decision\": \"block\"}'"`,
+		},
+		{
+			name:    "matchers pick the tools",
+			hooks:   []config.Hook{{Matcher: "edit_*", Command: "exit 2"}, {Matcher: "read_*", Command: "echo reading"}},
+			payload: readEnv,
+			output:  "reading",
+		},
+		{
+			name: "later hooks see rewritten input",
+			hooks: []config.Hook{
+				{Command: `echo '{"input": {"path": "README.md"}}'`},
+				{Command: `test "$CODING_AGENT_FILE" = README.md && echo "$CODING_AGENT_TOOL $CODING_AGENT_SESSION_ID"`},
+			},
+			payload: readEnv,
+			input:   `{"path": "README.md"}`,
+			output:  "read_file s1",
+		},
+		{
+			name:    "the payload is on stdin",
+			hooks:   []config.Hook{{Command: `grep -q '"prompt":"hello"' && echo seen`}},
+			payload: Payload{Event: UserPromptSubmitted, Prompt: "hello"},
+			output:  "seen",
+		},
+		{
+			name:    "a failing hook does not block",
+			hooks:   []config.Hook{{Command: "echo broken >&2; exit 1"}, {Command: "echo still ran"}},
+			payload: readEnv,
+			output:  "still ran",
+			errors:  1,
+		},
+		{
+			name:    "a hook that times out fails open",
+			hooks:   []config.Hook{{Command: "exec sleep 5", Timeout: config.Duration(50 * time.Millisecond)}},
+			payload: readEnv,
+			errors:  1,
+		},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		runner := New(config.Hooks{PreToolUse: test.hooks, UserPromptSubmitted: test.hooks}, dir, nil)
+		result := runner.Run(context.Background(), test.payload)
+		if result.Blocked != test.blocked || result.Reason != test.reason || string(result.Input) != test.input ||
+			result.Output != test.output || len(result.Errors) != test.errors {
+			t.Errorf("%s: got %+v", test.name, result)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+			t.Errorf("%s: a hook ran after the hook that blocked", test.name)
+		}
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	runner := New(config.Hooks{PostToolUse: []config.Hook{{Command: "exec sleep 5", Timeout: config.Duration(50 * time.Millisecond)}}}, t.TempDir(), nil)
+	start := time.Now()
+	result := runner.Run(context.Background(), Payload{Event: PostToolUse, ToolName: "run_command"})
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Error(), "timed out after 50ms") || result.Blocked {
+		t.Errorf("got %+v, want a timeout error that does not block", result)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the hook ran for %s despite its timeout", elapsed)
+	}
+}
+
+func TestWithoutSession(t *testing.T) {
+	var nilRunner *Runner
+	if nilRunner.WithoutSession() != nil || nilRunner.Run(context.Background(), Payload{Event: SessionStart}).Blocked {
+		t.Error("a nil runner should run nothing")
+	}
+
+	dir := t.TempDir()
+	runner := New(config.Hooks{
+		SessionStart: []config.Hook{{Command: "touch started"}},
+		PreToolUse:   []config.Hook{{Command: "exit 2"}},
+	}, dir, nil).WithoutSession()
+	runner.Run(context.Background(), Payload{Event: SessionStart})
+	if _, err := os.Stat(filepath.Join(dir, "started")); !os.IsNotExist(err) {
+		t.Errorf("session_start hook ran without a session (stat: %v)", err)
+	}
+	if !runner.Run(context.Background(), Payload{Event: PreToolUse, ToolName: "edit_file"}).Blocked {
+		t.Error("tool hooks should still run without a session")
+	}
+}
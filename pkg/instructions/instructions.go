@@ -0,0 +1,306 @@
+// Package instructions loads the AGENTS.md files in which users and projects
+// write down conventions for Claude to follow, so they apply to every session.
+package instructions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+)
+
+// FileName is the name of instruction files
+const FileName = "AGENTS.md"
+
+// maxIncludeDepth bounds how deeply @path includes may nest
+const maxIncludeDepth = 5
+
+// File is a loaded instruction file
+type File struct {
+	// Path is the file's absolute path
+	Path string
+	// Origin is where the file is shown to come from, such as
+	// ~/.coding-agent/AGENTS.md or pkg/AGENTS.md in the repository
+	Origin string
+	// Content is the file's text with its includes expanded
+	Content string
+
+	// within is the directory the file's includes must stay inside, or "" for
+	// the user's own file, which may include any file
+	within string
+}
+
+// stamp is what a file looked like when it was read, to notice changes
+type stamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// Set is the instruction files of a workspace: the user's own file and the
+// files from the repository root down to the workspace. It is safe for
+// concurrent use.
+type Set struct {
+	workspaceRoot string
+
+	mu     sync.Mutex
+	files  []File
+	stamps map[string]stamp
+}
+
+// Load reads the instruction files that apply to workspaceRoot. Files that
+// cannot be read or included are reported and left out.
+func Load(workspaceRoot string) (*Set, []error) {
+	s := &Set{workspaceRoot: workspaceRoot}
+	return s, s.load()
+}
+
+// Files returns the loaded files, the user's first and the workspace's last
+func (s *Set) Files() []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]File(nil), s.files...)
+}
+
+// Prompt returns the instructions to add to the system prompt, each file
+// marked with its origin, or "" when there are none
+func (s *Set) Prompt() string {
+	files := s.Files()
+	if len(files) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("The user and project gave these instructions. Follow them; when they conflict, later files, which are closer to the working directory, take precedence.\n")
+	for _, file := range files {
+		fmt.Fprintf(&b, "\n<instructions origin=%q>\n%s\n</instructions>\n", file.Origin, strings.TrimSpace(file.Content))
+	}
+	return b.String()
+}
+
+// Reload reads the files again if any of them, or of the files they
+// include, was changed, created or removed since they were read. It reports
+// whether they were, with any errors reading them.
+func (s *Set) Reload() (bool, []error) {
+	s.mu.Lock()
+	changed := false
+	for path, old := range s.stamps {
+		if statFile(path) != old {
+			changed = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if !changed {
+		return false, nil
+	}
+	return true, s.load()
+}
+
+// load reads every instruction file, replacing what was loaded before
+func (s *Set) load() []error {
+	r := &reader{stamps: map[string]stamp{}}
+	var files []File
+	for _, candidate := range s.candidates() {
+		r.stamps[candidate.Path] = statFile(candidate.Path)
+		content, err := os.ReadFile(candidate.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("failed to read %s: %w", candidate.Origin, err))
+			continue
+		}
+		candidate.Content = r.expand(candidate.Path, string(content), candidate.within, []string{candidate.Path})
+		if strings.TrimSpace(candidate.Content) != "" {
+			files = append(files, candidate)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files, s.stamps = files, r.stamps
+	return r.errs
+}
+
+// candidates returns where instruction files may be, in the order they apply
+func (s *Set) candidates() []File {
+	var candidates []File
+	if dir, err := config.UserDir(); err == nil {
+		path := filepath.Join(dir, FileName)
+		candidates = append(candidates, File{Path: path, Origin: homeRelative(path)})
+	}
+	if s.workspaceRoot == "" {
+		return candidates
+	}
+
+	root := repositoryRoot(s.workspaceRoot)
+	var dirs []string
+	for dir := s.workspaceRoot; ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, FileName)
+		origin, err := filepath.Rel(root, path)
+		if err != nil {
+			origin = path
+		}
+		candidates = append(candidates, File{Path: path, Origin: origin, within: root})
+	}
+	return candidates
+}
+
+// repositoryRoot returns the root of the git repository dir is in, or dir
+// itself when it is not in one
+func repositoryRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if d == filepath.Dir(d) {
+			return dir
+		}
+	}
+}
+
+// reader expands includes, recording every file it looks at
+type reader struct {
+	stamps map[string]stamp
+	errs   []error
+}
+
+// expand replaces each line of content that is an @path include with the
+// text of that file, resolved against the directory of path. Includes must
+// stay inside within unless it is "". Lines in code blocks are left alone.
+// stack holds the files being expanded, to stop cycles.
+func (r *reader) expand(path, content, within string, stack []string) string {
+	lines := strings.Split(content, "\n")
+	inCode := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode || !isInclude(trimmed) {
+			continue
+		}
+
+		included, err := includePath(filepath.Dir(path), trimmed[1:], within)
+		switch {
+		case err != nil:
+			r.errs = append(r.errs, fmt.Errorf("%s: cannot include %s: %w", homeRelative(path), trimmed, err))
+			continue
+		case contains(stack, included):
+			r.errs = append(r.errs, fmt.Errorf("%s: %s includes itself", homeRelative(path), trimmed))
+			continue
+		case len(stack) > maxIncludeDepth:
+			r.errs = append(r.errs, fmt.Errorf("%s: %s is nested more than %d includes deep", homeRelative(path), trimmed, maxIncludeDepth))
+			continue
+		}
+		r.stamps[included] = statFile(included)
+		text, err := os.ReadFile(included)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: failed to include %s: %w", homeRelative(path), trimmed, err))
+			continue
+		}
+		lines[i] = strings.TrimRight(r.expand(included, string(text), within, append(stack, included)), "\n")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isInclude reports whether a line is an @path include: @ followed by a
+// path with a directory or a file extension, such as @docs/style.md or
+// @CONVENTIONS.md, rather than a mention such as @octocat
+func isInclude(line string) bool {
+	ref, ok := strings.CutPrefix(line, "@")
+	if !ok || ref == "" || strings.ContainsAny(ref, " \t") {
+		return false
+	}
+	if strings.Contains(ref, "/") {
+		return true
+	}
+	ext := strings.TrimPrefix(filepath.Ext(ref), ".")
+	return ext != "" && strings.IndexFunc(ext, func(r rune) bool { return !unicode.IsLetter(r) }) < 0
+}
+
+// includePath resolves an include against dir. Paths under ~/ may only be
+// included from the user's own file; other includes must stay inside
+// within, after following symlinks, unless it is "".
+func includePath(dir, ref, within string) (string, error) {
+	if rest, ok := strings.CutPrefix(ref, "~/"); ok {
+		if within != "" {
+			return "", errors.New("only ~/.coding-agent/AGENTS.md may include files from the home directory")
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, rest), nil
+	}
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if within == "" {
+		return path, nil
+	}
+
+	resolved, resolvedWithin := path, within
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		resolved = p
+	}
+	if w, err := filepath.EvalSymlinks(within); err == nil {
+		resolvedWithin = w
+	}
+	if !isInside(within, path) || !isInside(resolvedWithin, resolved) {
+		return "", errors.New("files in the repository may only include files inside it")
+	}
+	return path, nil
+}
+
+// isInside reports whether path is dir or inside it
+func isInside(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// statFile returns the stamp of the file at path
+func statFile(path string) stamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// homeRelative shows path with the home directory as ~
+func homeRelative(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
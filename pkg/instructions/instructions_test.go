@@ -0,0 +1,83 @@
+package instructions
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a file, creating its directory
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	home, repo := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	outside := filepath.Join(t.TempDir(), "outside.md")
+	writeFile(t, outside, "OUTSIDE")
+	writeFile(t, filepath.Join(home, "secret.txt"), "SECRET")
+	writeFile(t, filepath.Join(home, "notes.md"), "USER NOTES")
+	writeFile(t, filepath.Join(home, ".coding-agent", FileName), "@~/notes.md")
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repo, "docs", "style.md"), "STYLE")
+	if err := os.Symlink(outside, filepath.Join(repo, "docs", "link.md")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repo, FileName), strings.Join([]string{
+		"@docs/style.md",
+		"@~/secret.txt",
+		"@" + outside,
+		"@../" + filepath.Base(filepath.Dir(outside)) + "/outside.md",
+		"@docs/link.md",
+		"@octocat",
+		"@v1.2",
+	}, "\n"))
+
+	set, errs := Load(repo)
+	prompt := set.Prompt()
+	for _, want := range []string{"USER NOTES", "STYLE", "@octocat", "@v1.2"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, prompt)
+		}
+	}
+	for _, leaked := range []string{"SECRET", "OUTSIDE"} {
+		if strings.Contains(prompt, leaked) {
+			t.Errorf("prompt includes %q from outside the repository:\n%s", leaked, prompt)
+		}
+	}
+	if len(errs) != 4 {
+		t.Errorf("got %d errors, want 4 for the includes outside the repository: %v", len(errs), errs)
+	}
+}
+
+func TestIsInclude(t *testing.T) {
+	tests := []struct {
+		line    string
+		include bool
+	}{
+		{"@docs/style.md", true},
+		{"@CONVENTIONS.md", true},
+		{"@~/notes.md", true},
+		{"@./notes", true},
+		{"@octocat", false},
+		{"@v1.2", false},
+		{"@", false},
+		{"@docs/a b.md", false},
+		{"docs/style.md", false},
+	}
+	for _, test := range tests {
+		if got := isInclude(test.line); got != test.include {
+			t.Errorf("isInclude(%q) = %t, want %t", test.line, got, test.include)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Package jsonrpc implements JSON-RPC 2.0 connections that exchange one
+// message per line, as used by the stdio server and MCP
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// ErrClosed is returned for calls still waiting when the connection closes
+var ErrClosed = errors.New("connection closed")
+
+// Error is a JSON-RPC error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Message is any JSON-RPC message: a request, a notification or a response
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Request is an outgoing request or, without an ID, notification
+type Request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// rpcResponse is an outgoing response
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Handler answers a request; notifications are handled the same way and the
+// answer dropped. Errors that are not an *Error are reported as internal errors.
+type Handler func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// Conn is a JSON-RPC 2.0 connection exchanging one message per line.
+// Either side may send requests.
+type Conn struct {
+	r *bufio.Reader
+
+	wmu sync.Mutex
+	w   io.Writer
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *Message
+	closed  bool
+}
+
+// NewConn creates a connection reading from r and writing to w
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{
+		r:       bufio.NewReader(r),
+		w:       w,
+		pending: map[string]chan *Message{},
+	}
+}
+
+// Serve reads messages until the input ends, handling each request in its
+// own goroutine so a long request does not hold up the others. When the input
+// ends the handlers' context is cancelled and serve waits for them to return.
+func (c *Conn) Serve(ctx context.Context, handle Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	defer c.close()
+
+	for {
+		line, err := c.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			c.dispatch(ctx, line, handle, &wg)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch routes one incoming message
+func (c *Conn) dispatch(ctx context.Context, line []byte, handle Handler, wg *sync.WaitGroup) {
+	var msg Message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		c.reply(nil, nil, &Error{Code: CodeParseError, Message: err.Error()})
+		return
+	}
+
+	if msg.Method == "" {
+		if msg.ID == nil {
+			c.reply(nil, nil, &Error{Code: CodeInvalidRequest, Message: "message has neither a method nor an id"})
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[string(msg.ID)]
+		delete(c.pending, string(msg.ID))
+		c.mu.Unlock()
+		if ok {
+			ch <- &msg
+		}
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, err := handle(ctx, msg.Method, msg.Params)
+		if msg.ID == nil {
+			return
+		}
+		c.reply(msg.ID, result, err)
+	}()
+}
+
+// reply sends the response to a request
+func (c *Conn) reply(id json.RawMessage, result interface{}, err error) {
+	resp := rpcResponse{JSONRPC: "2.0", ID: id, Result: result}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Result, resp.Error = nil, rpcErr
+	} else if result == nil {
+		resp.Result = struct{}{}
+	}
+	c.write(resp)
+}
+
+// Notify sends a notification
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.write(Request{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Call sends a request and waits for its response, decoding the result into result
+func (c *Conn) Call(ctx context.Context, method string, params, result interface{}) error {
+	ch := make(chan *Message, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := c.nextID
+	key := strconv.FormatInt(id, 10)
+	c.pending[key] = ch
+	c.mu.Unlock()
+
+	if err := c.write(Request{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		c.forget(key)
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.forget(key)
+		return ctx.Err()
+	case msg, ok := <-ch:
+		if !ok {
+			return ErrClosed
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+// forget stops waiting for the response to a call
+func (c *Conn) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, key)
+}
+
+// close fails every call still waiting for a response
+func (c *Conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for key, ch := range c.pending {
+		close(ch)
+		delete(c.pending, key)
+	}
+}
+
+// write sends one message as a line of JSON
+func (c *Conn) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
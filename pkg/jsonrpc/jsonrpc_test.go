@@ -0,0 +1,172 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pair connects two conns to each other, serving both with their handlers
+// until the test ends
+func pair(t *testing.T, handleA, handleB Handler) (*Conn, *Conn) {
+	t.Helper()
+	aIn, bOut := io.Pipe()
+	bIn, aOut := io.Pipe()
+	a, b := NewConn(aIn, aOut), NewConn(bIn, bOut)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); a.Serve(context.Background(), handleA) }()
+	go func() { defer wg.Done(); b.Serve(context.Background(), handleB) }()
+	t.Cleanup(func() {
+		aOut.Close()
+		bOut.Close()
+		wg.Wait()
+	})
+	return a, b
+}
+
+func TestCallAndNotify(t *testing.T) {
+	notified := make(chan string, 1)
+	server := func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		var p struct {
+			Text string `json:"text"`
+		}
+		json.Unmarshal(params, &p)
+		switch method {
+		case "echo":
+			return map[string]string{"text": p.Text}, nil
+		case "empty":
+			return nil, nil
+		case "invalid":
+			return nil, &Error{Code: CodeInvalidParams, Message: "bad text"}
+		case "fail":
+			return nil, errors.New("it broke")
+		case "note":
+			notified <- p.Text
+			return "ignored", nil
+		}
+		return nil, &Error{Code: CodeMethodNotFound, Message: "unknown method"}
+	}
+	client, _ := pair(t, nil, server)
+
+	tests := []struct {
+		method string
+		want   string
+		code   int
+	}{
+		{method: "echo", want: `{"text":"hi"}`},
+		{method: "empty", want: `{}`},
+		{method: "invalid", code: CodeInvalidParams},
+		{method: "fail", code: CodeInternalError},
+		{method: "missing", code: CodeMethodNotFound},
+	}
+	for _, test := range tests {
+		var result json.RawMessage
+		err := client.Call(context.Background(), test.method, map[string]string{"text": "hi"}, &result)
+		var rpcErr *Error
+		switch {
+		case test.code != 0 && (!errors.As(err, &rpcErr) || rpcErr.Code != test.code):
+			t.Errorf("%s: got %v, want error code %d", test.method, err, test.code)
+		case test.code == 0 && (err != nil || string(result) != test.want):
+			t.Errorf("%s: got %s, %v, want %s", test.method, result, err, test.want)
+		}
+	}
+
+	if err := client.Notify("note", map[string]string{"text": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case text := <-notified:
+		if text != "hello" {
+			t.Errorf("notification carried %q, want hello", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not handled")
+	}
+}
+
+func TestCallsBothWays(t *testing.T) {
+	// The server calls back into the client while answering its request
+	var server *Conn
+	client, server := pair(t,
+		func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+			return "approved", nil
+		},
+		func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+			var answer string
+			if err := server.Call(ctx, "approve", nil, &answer); err != nil {
+				return nil, err
+			}
+			return "ran after " + answer, nil
+		})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result string
+			if err := client.Call(context.Background(), "run", nil, &result); err != nil || result != "ran after approved" {
+				t.Errorf("run = %q, %v", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestServeReportsBadMessages(t *testing.T) {
+	in := strings.NewReader("not json\n{\"jsonrpc\": \"2.0\"}\n\n{\"jsonrpc\": \"2.0\", \"id\": 9, \"result\": {}}\n")
+	var out strings.Builder
+	conn := NewConn(in, &out)
+	if err := conn.Serve(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The response to an unknown call is dropped; the blank line is skipped
+	var codes []int
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.Error == nil {
+			t.Fatalf("reply %s: %v", scanner.Text(), err)
+		}
+		codes = append(codes, msg.Error.Code)
+	}
+	if len(codes) != 2 || codes[0] != CodeParseError || codes[1] != CodeInvalidRequest {
+		t.Errorf("error codes %v, want parse error then invalid request", codes)
+	}
+}
+
+func TestPendingCallsFailWhenClosed(t *testing.T) {
+	in, out := io.Pipe()
+	conn := NewConn(in, io.Discard)
+	served := make(chan error, 1)
+	go func() { served <- conn.Serve(context.Background(), nil) }()
+
+	// A call whose context ends stops waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := conn.Call(ctx, "slow", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("call with an expired context: got %v, want DeadlineExceeded", err)
+	}
+
+	called := make(chan error, 1)
+	go func() { called <- conn.Call(context.Background(), "never answered", nil, nil) }()
+	time.Sleep(10 * time.Millisecond)
+	out.Close()
+	if err := <-called; !errors.Is(err, ErrClosed) {
+		t.Errorf("call when the input ended: got %v, want ErrClosed", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Call(context.Background(), "late", nil, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("call after closing: got %v, want ErrClosed", err)
+	}
+}
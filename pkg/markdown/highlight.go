@@ -0,0 +1,40 @@
+package markdown
+
+import (
+	"os"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// codeStyle is the chroma style code blocks are highlighted with
+const codeStyle = "monokai"
+
+// highlight colors code by its language, a name or file extension such as
+// "go" or "py". Code in an unknown language is returned as it is.
+func highlight(code, language string) string {
+	if language == "" {
+		return code
+	}
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return code
+	}
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return code
+	}
+
+	formatter := formatters.TTY256
+	if colorterm := os.Getenv("COLORTERM"); colorterm == "truecolor" || colorterm == "24bit" {
+		formatter = formatters.TTY16m
+	}
+	var b strings.Builder
+	if err := formatter.Format(&b, styles.Get(codeStyle), tokens); err != nil {
+		return code
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,107 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Patterns of the inline elements, applied in order
+var (
+	escapePattern      = regexp.MustCompile(`\\([!-/:-@\[-` + "`" + `{-~])`)
+	imagePattern       = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	autolinkPattern    = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	boldPattern        = regexp.MustCompile(`\*\*(\S|\S.*?\S)\*\*`)
+	boldUnderPattern   = regexp.MustCompile(`(^|\W)__(\S|\S.*?\S)__(\W|$)`)
+	italicPattern      = regexp.MustCompile(`(^|[^*\w])\*([^\s*](?:[^*]*[^\s*])?)\*`)
+	italicUnderPattern = regexp.MustCompile(`(^|\W)_([^\s_](?:[^_]*[^\s_])?)_(\W|$)`)
+	strikePattern      = regexp.MustCompile(`~~(\S|\S.*?\S)~~`)
+)
+
+// escapeBase is where escaped punctuation is kept in the private use area
+// while emphasis is applied, so that it stays literal
+const escapeBase = 0xE000
+
+// inline styles the inline elements of text: code spans, emphasis, links
+// and images
+func inline(text string) string {
+	var b strings.Builder
+	for text != "" {
+		start := strings.IndexByte(text, '`')
+		if start < 0 {
+			b.WriteString(emphasis(text))
+			break
+		}
+		n := start
+		for n < len(text) && text[n] == '`' {
+			n++
+		}
+		fence := text[start:n]
+		end := strings.Index(text[n:], fence)
+		if end < 0 {
+			b.WriteString(emphasis(text[:n]))
+			text = text[n:]
+			continue
+		}
+
+		b.WriteString(emphasis(text[:start]))
+		code := text[n : n+end]
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+			code = code[1 : len(code)-1]
+		}
+		b.WriteString(styleCode + code + "\u001b[39m")
+		text = text[n+end+len(fence):]
+	}
+	return b.String()
+}
+
+// emphasis styles the inline elements of text without code spans
+func emphasis(text string) string {
+	text = escapePattern.ReplaceAllStringFunc(text, func(m string) string {
+		return string(rune(escapeBase + int(m[1])))
+	})
+
+	text = imagePattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := imagePattern.FindStringSubmatch(m)
+		return styleDim + "[image: " + sub[1] + "] " + protect(sub[2]) + reset
+	})
+	text = linkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := linkPattern.FindStringSubmatch(m)
+		if sub[1] == sub[2] {
+			return styleLink + protect(sub[2]) + "\u001b[24;39m"
+		}
+		return styleLink + sub[1] + "\u001b[24;39m " + styleDim + "(" + protect(sub[2]) + ")\u001b[39m"
+	})
+	text = autolinkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		return styleLink + protect(m[1:len(m)-1]) + "\u001b[24;39m"
+	})
+
+	text = boldPattern.ReplaceAllString(text, styleBold+"$1\u001b[22m")
+	text = boldUnderPattern.ReplaceAllString(text, "${1}"+styleBold+"${2}\u001b[22m${3}")
+	text = italicPattern.ReplaceAllString(text, "${1}"+styleItalic+"${2}\u001b[23m")
+	text = italicUnderPattern.ReplaceAllString(text, "${1}"+styleItalic+"${2}\u001b[23m${3}")
+	text = strikePattern.ReplaceAllString(text, styleStrike+"$1\u001b[29m")
+
+	return strings.Map(func(r rune) rune {
+		if r >= escapeBase && r < escapeBase+128 {
+			return r - escapeBase
+		}
+		return r
+	}, text)
+}
+
+// protect keeps the emphasis characters of a URL literal
+func protect(url string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '*' || r == '_' || r == '~' {
+			return escapeBase + r
+		}
+		return r
+	}, url)
+}
+
+// stripInline returns text with its inline markup removed, for elements
+// styled as a whole
+func stripInline(text string) string {
+	return ansiEscape.ReplaceAllString(inline(text), "")
+}
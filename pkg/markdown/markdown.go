@@ -0,0 +1,337 @@
+// Package markdown renders the markdown in Claude's responses as styled
+// terminal text: headings, lists, emphasis, tables, links, block quotes and
+// syntax-highlighted code blocks, wrapped to the terminal's width
+package markdown
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Styles of the rendered elements, as ANSI escape codes
+const (
+	reset         = "\u001b[0m"
+	styleHeading1 = "\u001b[1;4;95m"
+	styleHeading  = "\u001b[1;95m"
+	styleCode     = "\u001b[36m"
+	styleDim      = "\u001b[90m"
+	styleBold     = "\u001b[1m"
+	styleItalic   = "\u001b[3m"
+	styleStrike   = "\u001b[9m"
+	styleLink     = "\u001b[4;94m"
+)
+
+// Patterns of the block-level elements
+var (
+	fencePattern     = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([^`\\s]*)")
+	headingPattern   = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	rulePattern      = regexp.MustCompile(`^\s{0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	listPattern      = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	quotePattern     = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	separatorPattern = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// Render formats markdown for a terminal width columns wide
+func Render(text string, width int) string {
+	if width < 20 {
+		width = 20
+	}
+	r := renderer{lines: strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), width: width}
+	return strings.TrimRight(r.render(), "\n")
+}
+
+// TerminalWidth returns the width of the terminal fd refers to, or 80 when it is unknown
+func TerminalWidth(fd int) int {
+	width, _, err := term.GetSize(fd)
+	if err != nil || width <= 0 {
+		return 80
+	}
+	return width
+}
+
+// renderer renders a document one block at a time
+type renderer struct {
+	lines []string
+	i     int
+	width int
+	out   strings.Builder
+}
+
+// render renders every block and returns the result
+func (r *renderer) render() string {
+	lastBlank := true
+	for r.i < len(r.lines) {
+		line := r.lines[r.i]
+		if strings.TrimSpace(line) == "" {
+			// Keep at most one blank line between blocks
+			if !lastBlank {
+				r.out.WriteString("\n")
+			}
+			lastBlank = true
+			r.i++
+			continue
+		}
+		lastBlank = false
+
+		switch {
+		case fencePattern.MatchString(line):
+			r.codeBlock()
+		case headingPattern.MatchString(line):
+			r.heading()
+		case rulePattern.MatchString(line):
+			r.out.WriteString(styleDim + strings.Repeat("─", r.width) + reset + "\n")
+			r.i++
+		case quotePattern.MatchString(line):
+			r.quote()
+		case listPattern.MatchString(line):
+			r.listItem()
+		case r.tableStart():
+			r.table()
+		default:
+			r.paragraph()
+		}
+	}
+	return r.out.String()
+}
+
+// startsBlock reports whether line begins a block other than a paragraph
+func (r *renderer) startsBlock(line string) bool {
+	return strings.TrimSpace(line) == "" || fencePattern.MatchString(line) || headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) || quotePattern.MatchString(line) || listPattern.MatchString(line)
+}
+
+// codeBlock renders a fenced code block, highlighted by its language
+func (r *renderer) codeBlock() {
+	m := fencePattern.FindStringSubmatch(r.lines[r.i])
+	fence, language := m[1], m[2]
+	r.i++
+
+	var code []string
+	for r.i < len(r.lines) {
+		line := r.lines[r.i]
+		r.i++
+		if strings.HasPrefix(strings.TrimSpace(line), fence) && strings.Trim(strings.TrimSpace(line), fence[:1]) == "" {
+			break
+		}
+		code = append(code, line)
+	}
+
+	// Colors carry over line breaks, as in multi-line comments and strings
+	highlighted := highlight(strings.Join(code, "\n"), language)
+	r.out.WriteString("  " + strings.ReplaceAll(highlighted, "\n", "\n  ") + reset + "\n")
+}
+
+// heading renders an ATX heading
+func (r *renderer) heading() {
+	m := headingPattern.FindStringSubmatch(r.lines[r.i])
+	r.i++
+	style := styleHeading
+	if len(m[1]) == 1 {
+		style = styleHeading1
+	}
+	r.out.WriteString(style + stripInline(m[2]) + reset + "\n")
+}
+
+// quote renders a block quote, rendering its content as markdown with a bar before it
+func (r *renderer) quote() {
+	var inner []string
+	for r.i < len(r.lines) {
+		m := quotePattern.FindStringSubmatch(r.lines[r.i])
+		if m == nil {
+			break
+		}
+		inner = append(inner, m[1])
+		r.i++
+	}
+	for _, line := range strings.Split(Render(strings.Join(inner, "\n"), r.width-2), "\n") {
+		r.out.WriteString(styleDim + "│" + reset + " " + line + "\n")
+	}
+}
+
+// listItem renders one list item with its continuation lines, indented by
+// its nesting level
+func (r *renderer) listItem() {
+	m := listPattern.FindStringSubmatch(r.lines[r.i])
+	r.i++
+	level := min(len(strings.ReplaceAll(m[1], "\t", "    "))/2, 6)
+	text := m[3]
+	for r.i < len(r.lines) && !r.startsBlock(r.lines[r.i]) {
+		text += " " + strings.TrimSpace(r.lines[r.i])
+		r.i++
+	}
+
+	marker := m[2]
+	if !strings.ContainsAny(marker, "0123456789") {
+		marker = []string{"•", "◦", "▪"}[level%3]
+	}
+	switch {
+	case strings.HasPrefix(text, "[ ] "):
+		marker, text = marker+" ☐", text[4:]
+	case strings.HasPrefix(text, "[x] "), strings.HasPrefix(text, "[X] "):
+		marker, text = marker+" ☑", text[4:]
+	}
+
+	indent := strings.Repeat("  ", level)
+	r.out.WriteString(wrap(inline(text), r.width, indent+marker+" ", indent+strings.Repeat(" ", displayWidth(marker)+1)))
+}
+
+// paragraph renders lines up to the next block as one wrapped paragraph
+func (r *renderer) paragraph() {
+	text := strings.TrimSpace(r.lines[r.i])
+	r.i++
+	for r.i < len(r.lines) && !r.startsBlock(r.lines[r.i]) {
+		text += " " + strings.TrimSpace(r.lines[r.i])
+		r.i++
+	}
+	r.out.WriteString(wrap(inline(text), r.width, "", ""))
+}
+
+// tableStart reports whether a table starts at the current line, which it
+// does when the line has cells and the next separates them from the rows
+func (r *renderer) tableStart() bool {
+	return strings.Contains(r.lines[r.i], "|") && r.i+1 < len(r.lines) &&
+		strings.Contains(r.lines[r.i+1], "-") && separatorPattern.MatchString(r.lines[r.i+1])
+}
+
+// table renders a table with aligned columns. A table too wide for the
+// terminal is shown as a list of records instead.
+func (r *renderer) table() {
+	header := splitRow(r.lines[r.i])
+	var aligns []string
+	for _, cell := range splitRow(r.lines[r.i+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "right")
+		default:
+			aligns = append(aligns, "left")
+		}
+	}
+	r.i += 2
+
+	rows := [][]string{header}
+	for r.i < len(r.lines) && strings.Contains(r.lines[r.i], "|") && strings.TrimSpace(r.lines[r.i]) != "" {
+		rows = append(rows, splitRow(r.lines[r.i]))
+		r.i++
+	}
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for c := range widths {
+			if c < len(row) {
+				row[c] = inline(row[c])
+				widths[c] = max(widths[c], displayWidth(row[c]))
+			}
+		}
+	}
+
+	total := 3 * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	if total > r.width {
+		for _, row := range rows[1:] {
+			for c, name := range header {
+				value := ""
+				if c < len(row) {
+					value = row[c]
+				}
+				r.out.WriteString(wrap(value, r.width, styleBold+name+"\u001b[22m: ", "  "))
+			}
+			r.out.WriteString("\n")
+		}
+		return
+	}
+
+	for n, row := range rows {
+		cells := make([]string, len(widths))
+		for c, w := range widths {
+			value, align := "", "left"
+			if c < len(row) {
+				value = row[c]
+			}
+			if c < len(aligns) {
+				align = aligns[c]
+			}
+			cells[c] = pad(value, w, align)
+			if n == 0 {
+				cells[c] = styleBold + cells[c] + "\u001b[22m"
+			}
+		}
+		r.out.WriteString(strings.Join(cells, styleDim+" │ "+reset) + "\n")
+		if n == 0 {
+			rules := make([]string, len(widths))
+			for c, w := range widths {
+				rules[c] = strings.Repeat("─", w)
+			}
+			r.out.WriteString(styleDim + strings.Join(rules, "─┼─") + reset + "\n")
+		}
+	}
+}
+
+// splitRow returns the cells of a table row, leaving escaped pipes in them
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '|':
+			cells = append(cells, strings.TrimSpace(line[start:i]))
+			start = i + 1
+		}
+	}
+	return append(cells, strings.TrimSpace(line[start:]))
+}
+
+// pad fills styled text with spaces to width columns
+func pad(text string, width int, align string) string {
+	gap := width - displayWidth(text)
+	switch align {
+	case "right":
+		return strings.Repeat(" ", gap) + text
+	case "center":
+		return strings.Repeat(" ", gap/2) + text + strings.Repeat(" ", gap-gap/2)
+	}
+	return text + strings.Repeat(" ", gap)
+}
+
+// wrap breaks styled text into lines of at most width columns, starting the
+// first with prefix and the others with indent
+func wrap(text string, width int, prefix, indent string) string {
+	var b strings.Builder
+	line, lineWidth := prefix, displayWidth(prefix)
+	empty := true
+	for _, word := range strings.Fields(text) {
+		w := displayWidth(word)
+		if !empty && lineWidth+1+w > width {
+			b.WriteString(line + "\n")
+			line, lineWidth, empty = indent, displayWidth(indent), true
+		}
+		if !empty {
+			line += " "
+			lineWidth++
+		}
+		line += word
+		lineWidth += w
+		empty = false
+	}
+	b.WriteString(line + "\n")
+	return b.String()
+}
+
+// ansiEscape matches the escape codes styling rendered text
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// displayWidth returns how many columns styled text takes
+func displayWidth(s string) int {
+	return len([]rune(ansiEscape.ReplaceAllString(s, "")))
+}
@@ -0,0 +1,99 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "just text", want: "just text"},
+		{name: "bold", text: "a **bold** word", want: "a " + styleBold + "bold\u001b[22m word"},
+		{name: "bold underscores", text: "a __bold__ word", want: "a " + styleBold + "bold\u001b[22m word"},
+		{name: "italic", text: "an *italic* word", want: "an " + styleItalic + "italic\u001b[23m word"},
+		{name: "italic underscores", text: "an _italic_ word", want: "an " + styleItalic + "italic\u001b[23m word"},
+		{name: "snake_case is not italic", text: "call snake_case_name now", want: "call snake_case_name now"},
+		{name: "strikethrough", text: "~~gone~~", want: styleStrike + "gone\u001b[29m"},
+		{name: "code span", text: "run `go test`", want: "run " + styleCode + "go test\u001b[39m"},
+		{name: "no emphasis in code", text: "`**not bold**`", want: styleCode + "**not bold**\u001b[39m"},
+		{name: "double backtick code", text: "``a ` b``", want: styleCode + "a ` b\u001b[39m"},
+		{name: "unclosed backtick", text: "a ` b *c*", want: "a ` b " + styleItalic + "c\u001b[23m"},
+		{name: "escaped", text: `\*not italic\*`, want: "*not italic*"},
+		{name: "link", text: "[docs](https://go.dev)", want: styleLink + "docs\u001b[24;39m " + styleDim + "(https://go.dev)\u001b[39m"},
+		{name: "bare link", text: "[https://go.dev](https://go.dev)", want: styleLink + "https://go.dev\u001b[24;39m"},
+		{name: "autolink", text: "<https://a.dev/x_y_z>", want: styleLink + "https://a.dev/x_y_z\u001b[24;39m"},
+		{name: "link with emphasis characters", text: "[x](https://a.dev/*a*)", want: styleLink + "x\u001b[24;39m " + styleDim + "(https://a.dev/*a*)\u001b[39m"},
+		{name: "image", text: "![logo](logo.png)", want: styleDim + "[image: logo] logo.png" + reset},
+	}
+	for _, test := range tests {
+		if got := inline(test.text); got != test.want {
+			t.Errorf("%s: inline(%q) = %q, want %q", test.name, test.text, got, test.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  string
+	}{
+		{name: "paragraph lines are joined and wrapped", text: "one two three\nfour five six seven eight", width: 20,
+			want: "one two three four\nfive six seven eight"},
+		{name: "blank lines collapse", text: "a\n\n\n\nb", width: 80, want: "a\n\nb"},
+		{name: "headings", text: "# Title\n## Section *one* ##", width: 80,
+			want: styleHeading1 + "Title" + reset + "\n" + styleHeading + "Section one" + reset},
+		{name: "rule", text: "---", width: 20, want: styleDim + strings.Repeat("─", 20) + reset},
+		{name: "lists", text: "- one\n  - nested\n    continued\n1. first\n- [ ] todo\n- [x] done", width: 80,
+			want: "• one\n  ◦ nested continued\n1. first\n• ☐ todo\n• ☑ done"},
+		{name: "wrapped list item", text: "- alpha beta gamma delta epsilon", width: 20,
+			want: "• alpha beta gamma\n  delta epsilon"},
+		{name: "quote", text: "> quoted **text**\n> more", width: 80,
+			want: styleDim + "│" + reset + " quoted " + styleBold + "text\u001b[22m more"},
+		{name: "table", text: "| a | b |\n|---|--:|\n| 1 | 22 |", width: 80,
+			want: styleBold + "a" + "\u001b[22m" + styleDim + " │ " + reset + styleBold + " b" + "\u001b[22m\n" +
+				styleDim + "─" + "─┼─" + "──" + reset + "\n" +
+				"1" + styleDim + " │ " + reset + "22"},
+		{name: "narrow table as records", text: "| name | description |\n|---|---|\n| x | a long description |", width: 20,
+			want: styleBold + "name\u001b[22m: x\n" + styleBold + "description\u001b[22m: a long\n  description"},
+		{name: "unknown language code is not highlighted", text: "```nolang\n**a**\n  b\n```\nafter", width: 80,
+			want: "  **a**\n    b" + reset + "\nafter"},
+		{name: "tilde fence with backticks inside", text: "~~~\n```\n~~~", width: 80,
+			want: "  ```" + reset},
+		{name: "unclosed fence runs to the end", text: "```\ncode", width: 80, want: "  code" + reset},
+	}
+	for _, test := range tests {
+		if got := Render(test.text, test.width); got != test.want {
+			t.Errorf("%s: Render(%q) =\n%q\nwant\n%q", test.name, test.text, got, test.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	code := "func main() {\n\t// start\n\tfmt.Println(\"hi\")\n}"
+	for _, language := range []string{"go", "golang"} {
+		got := highlight(code, language)
+		if got == code || !strings.Contains(got, "\u001b[") {
+			t.Errorf("highlight(%s) = %q, want it colored", language, got)
+		}
+		if plain := ansiEscape.ReplaceAllString(got, ""); plain != code {
+			t.Errorf("highlight(%s) changed the code to %q", language, plain)
+		}
+	}
+	for _, language := range []string{"", "no-such-language"} {
+		if got := highlight(code, language); got != code {
+			t.Errorf("highlight(%q) = %q, want the code as it is", language, got)
+		}
+	}
+
+	rendered := Render("```go\n"+code+"\n```", 80)
+	lines := strings.Split(ansiEscape.ReplaceAllString(rendered, ""), "\n")
+	if len(lines) != 4 || lines[0] != "  func main() {" || lines[3] != "  }" {
+		t.Errorf("rendered code block %q, want the code indented by two spaces", lines)
+	}
+}
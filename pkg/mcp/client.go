@@ -0,0 +1,432 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/jsonrpc"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// connectTimeout bounds starting a server and listing its tools
+const connectTimeout = 30 * time.Second
+
+// ToolPrefix starts the name of every MCP tool given to Claude
+const ToolPrefix = "mcp__"
+
+// Server is a connection to one configured MCP server. It reconnects on
+// the next call after the server exits or drops the session.
+type Server struct {
+	Name   string
+	config config.MCPServer
+	dir    string
+	logger *log.Logger
+
+	// reconnectMu is held while replacing the transport, so calls that find
+	// it gone start one new connection between them
+	reconnectMu sync.Mutex
+
+	mu        sync.Mutex
+	transport transport
+	info      Implementation
+	tools     []Tool
+	err       error
+}
+
+// connect starts the transport, performs the initialize handshake and lists
+// the server's tools
+func (s *Server) connect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	var stderr io.Writer = io.Discard
+	if s.logger != nil {
+		stderr = s.logger.Writer()
+	}
+	t, err := newTransport(s.config, s.dir, stderr)
+	if err != nil {
+		return s.fail(err)
+	}
+
+	var init initializeResult
+	err = t.Call(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      agentInfo,
+	}, &init)
+	if err == nil {
+		err = t.Notify(ctx, "notifications/initialized", nil)
+	}
+	var list []Tool
+	if err == nil {
+		list, err = listTools(ctx, t)
+	}
+	if err != nil {
+		t.Close()
+		return s.fail(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transport, s.info, s.tools, s.err = t, init.ServerInfo, list, nil
+	if s.logger != nil {
+		s.logger.Printf("mcp: connected to %s (%s %s), %d tools", s.Name, init.ServerInfo.Name, init.ServerInfo.Version, len(list))
+	}
+	return nil
+}
+
+// fail records a connection error
+func (s *Server) fail(err error) error {
+	err = fmt.Errorf("MCP server %s: %w", s.Name, err)
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	return err
+}
+
+// listTools reads every page of the server's tool list
+func listTools(ctx context.Context, t transport) ([]Tool, error) {
+	var all []Tool
+	cursor := ""
+	for {
+		var page listToolsResult
+		if err := t.Call(ctx, "tools/list", listToolsParams{Cursor: cursor}, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// current returns the transport, or nil if there is none
+func (s *Server) current() transport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transport
+}
+
+// alive reports whether t is connected
+func alive(t transport) bool {
+	if t == nil {
+		return false
+	}
+	select {
+	case <-t.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// connected returns the live transport, reconnecting if the last one is gone
+func (s *Server) connected(ctx context.Context) (transport, error) {
+	t := s.current()
+	if alive(t) {
+		return t, nil
+	}
+	return s.replace(ctx, t)
+}
+
+// replace reconnects in place of dead, a transport a call found gone. If
+// another call has already replaced it, the new transport is used instead.
+func (s *Server) replace(ctx context.Context, dead transport) (transport, error) {
+	s.reconnectMu.Lock()
+	defer s.reconnectMu.Unlock()
+	if t := s.current(); t != dead && alive(t) {
+		return t, nil
+	}
+	if dead != nil {
+		dead.Close()
+	}
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	return s.current(), nil
+}
+
+// restart closes the transport, if any, and connects again
+func (s *Server) restart(ctx context.Context) error {
+	s.reconnectMu.Lock()
+	defer s.reconnectMu.Unlock()
+	s.Close()
+	return s.connect(ctx)
+}
+
+// Call invokes one of the server's tools
+func (s *Server) Call(ctx context.Context, tool string, args json.RawMessage) (*CallResult, error) {
+	if s.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.config.Timeout))
+		defer cancel()
+	}
+
+	t, err := s.connected(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var result CallResult
+	err = t.Call(ctx, "tools/call", callToolParams{Name: tool, Arguments: args}, &result)
+
+	// An expired HTTP session never saw the call, so it is safe to send again
+	if errors.Is(err, errSessionExpired) {
+		if t, err = s.replace(ctx, t); err != nil {
+			return nil, err
+		}
+		err = t.Call(ctx, "tools/call", callToolParams{Name: tool, Arguments: args}, &result)
+	}
+	if errors.Is(err, jsonrpc.ErrClosed) {
+		return nil, fmt.Errorf("MCP server %s exited during the call; it will be restarted on the next one", s.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	t := s.transport
+	s.transport = nil
+	s.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+	return t.Close()
+}
+
+// Status describes the server's connection
+func (s *Server) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.err != nil:
+		return "failed: " + s.err.Error()
+	case s.transport == nil:
+		return "not connected"
+	}
+	if !alive(s.transport) {
+		return "disconnected (reconnects on next call)"
+	}
+	if s.info.Name != "" {
+		return fmt.Sprintf("connected to %s %s", s.info.Name, s.info.Version)
+	}
+	return "connected"
+}
+
+// Tools returns the tools the server offered when it last connected
+func (s *Server) Tools() []Tool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Tool(nil), s.tools...)
+}
+
+// Manager runs the MCP servers listed in config
+type Manager struct {
+	servers []*Server
+}
+
+// NewManager creates a manager for the enabled servers, which are started
+// in dir. Nothing is launched until Start.
+func NewManager(servers map[string]config.MCPServer, dir string, logger *log.Logger) *Manager {
+	names := make([]string, 0, len(servers))
+	for name, cfg := range servers {
+		if !cfg.Disabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	m := &Manager{}
+	for _, name := range names {
+		m.servers = append(m.servers, &Server{Name: name, config: servers[name], dir: dir, logger: logger})
+	}
+	return m
+}
+
+// Start connects to every server at once, returning the errors of those that
+// failed and of tools left out because their name is taken. Failed servers
+// are retried on their next tool call.
+func (m *Manager) Start(ctx context.Context) []error {
+	errs := make([]error, len(m.servers))
+	var wg sync.WaitGroup
+	for i, s := range m.servers {
+		wg.Add(1)
+		go func(i int, s *Server) {
+			defer wg.Done()
+			errs[i] = s.restart(ctx)
+		}(i, s)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	for _, t := range m.offered() {
+		if t.duplicate {
+			failed = append(failed, fmt.Errorf("MCP server %s: tool %s is left out, another tool is already named %s", t.server.Name, t.tool.Name, t.name))
+		}
+	}
+	return failed
+}
+
+// Servers returns the managed servers in name order
+func (m *Manager) Servers() []*Server {
+	return m.servers
+}
+
+// Close stops every server
+func (m *Manager) Close() {
+	for _, s := range m.servers {
+		s.Close()
+	}
+}
+
+// Reconnect restarts the named server, or every server if name is empty
+func (m *Manager) Reconnect(ctx context.Context, name string) error {
+	found := false
+	var errs []error
+	for _, s := range m.servers {
+		if name != "" && s.Name != name {
+			continue
+		}
+		found = true
+		if err := s.restart(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no MCP server named %s", name)
+	}
+	return errors.Join(errs...)
+}
+
+// Tools returns tool definitions for every tool of the connected servers,
+// named mcp__<server>__<tool>. Calls go through the environment's
+// permission check like any other tool.
+func (m *Manager) Tools() []tools.ToolDefinition {
+	var defs []tools.ToolDefinition
+	for _, t := range m.offered() {
+		if !t.duplicate {
+			defs = append(defs, toolDefinition(t.server, t.tool))
+		}
+	}
+	return defs
+}
+
+// offeredTool is a server's tool under the name Claude sees it by
+type offeredTool struct {
+	server *Server
+	tool   Tool
+	name   string
+	// duplicate is set when an earlier tool has the same name, so this one is left out
+	duplicate bool
+}
+
+// offered lists every tool of the connected servers in order
+func (m *Manager) offered() []offeredTool {
+	var offered []offeredTool
+	seen := map[string]bool{}
+	for _, s := range m.servers {
+		for _, tool := range s.Tools() {
+			name := ToolName(s.Name, tool.Name)
+			offered = append(offered, offeredTool{server: s, tool: tool, name: name, duplicate: seen[name]})
+			seen[name] = true
+		}
+	}
+	return offered
+}
+
+// Status describes every server and its tools, for the /mcp command
+func (m *Manager) Status() string {
+	if len(m.servers) == 0 {
+		return "No MCP servers configured."
+	}
+	offered := m.offered()
+	var b strings.Builder
+	for i, s := range m.servers {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s: %s", s.Name, s.Status())
+		for _, t := range offered {
+			if t.server != s {
+				continue
+			}
+			fmt.Fprintf(&b, "\n  %s", t.name)
+			if t.duplicate {
+				b.WriteString(" (left out, the name is taken)")
+			}
+		}
+	}
+	return b.String()
+}
+
+// invalidNameChars are characters Claude does not accept in tool names
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// maxToolName is the longest tool name Claude accepts
+const maxToolName = 64
+
+// ToolName returns the name an MCP tool is given to Claude under. Names too
+// long for Claude are cut short and end in a hash of the whole name, so
+// tools that differ only past the cut keep different names.
+func ToolName(server, tool string) string {
+	name := ToolPrefix + invalidNameChars.ReplaceAllString(server, "_") + "__" + invalidNameChars.ReplaceAllString(tool, "_")
+	if len(name) > maxToolName {
+		sum := sha256.Sum256([]byte(server + "\x00" + tool))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		name = name[:maxToolName-len(suffix)] + suffix
+	}
+	return name
+}
+
+// toolDefinition wraps an MCP tool as a tool the agent can call
+func toolDefinition(s *Server, tool Tool) tools.ToolDefinition {
+	description := tool.Description
+	if description == "" {
+		description = tool.Name
+	}
+	return tools.ToolDefinition{
+		Name:        ToolName(s.Name, tool.Name),
+		Description: fmt.Sprintf("[MCP server %s] %s", s.Name, description),
+		InputSchema: inputSchema(tool.InputSchema),
+		Function: func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+			env.Logf("mcp: %s/%s %s", s.Name, tool.Name, string(input))
+			result, err := s.Call(ctx, tool.Name, input)
+			if err != nil {
+				return "", err
+			}
+			if result.IsError {
+				return "", errors.New(result.Text())
+			}
+			return result.Text(), nil
+		},
+	}
+}
+
+// inputSchema converts an MCP tool's JSON schema for Claude. A malformed
+// schema leaves the tool without declared properties.
+func inputSchema(raw json.RawMessage) anthropic.ToolInputSchemaParam {
+	param, _ := tools.ParseSchema(raw)
+	return param
+}
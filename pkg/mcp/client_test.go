@@ -0,0 +1,174 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// testServerEnv makes the test binary run as an MCP server over stdio
+const testServerEnv = "MCP_TEST_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testServerEnv) != "" {
+		serveTestTools()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serveTestTools serves testTools on stdin and stdout, noting each launch
+// in the launches file of the working directory
+func serveTestTools() {
+	if f, err := os.OpenFile("launches", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+		f.WriteString("launched\n")
+		f.Close()
+	}
+	Serve(context.Background(), testTools(), &tools.Env{}, os.Stdin, os.Stdout)
+}
+
+// testTools echo their input or make the server exit
+func testTools() []tools.ToolDefinition {
+	return []tools.ToolDefinition{
+		{Name: "echo", Description: "Echo the text", Function: func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+			var p struct {
+				Text string `json:"text"`
+			}
+			json.Unmarshal(input, &p)
+			return p.Text, nil
+		}},
+		{Name: "exit", Description: "Stop the server", Function: func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+			os.Exit(1)
+			return "", nil
+		}},
+	}
+}
+
+// launches counts how often the test server was started in dir
+func launches(t *testing.T, dir string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "launches"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "launched\n")
+}
+
+// startTestServer starts a manager running the test binary as the server "test"
+func startTestServer(t *testing.T) (*Manager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	manager := NewManager(map[string]config.MCPServer{
+		"test": {Command: os.Args[0], Env: map[string]string{testServerEnv: "1"}},
+	}, dir, nil)
+	t.Cleanup(manager.Close)
+	if errs := manager.Start(context.Background()); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	return manager, dir
+}
+
+func TestStdioServer(t *testing.T) {
+	manager, dir := startTestServer(t)
+	defs := manager.Tools()
+	if len(defs) != 2 || defs[0].Name != "mcp__test__echo" || defs[1].Name != "mcp__test__exit" {
+		t.Fatalf("Tools = %v, want mcp__test__echo and mcp__test__exit", defs)
+	}
+	output, err := defs[0].Function(context.Background(), &tools.Env{}, json.RawMessage(`{"text": "hello"}`))
+	if err != nil || output != "hello" {
+		t.Fatalf("echo = %q, %v", output, err)
+	}
+	if status := manager.Status(); !strings.Contains(status, "test: connected to coding-agent") {
+		t.Errorf("Status = %q", status)
+	}
+
+	// A server that exits is started again by the next calls, once between them
+	exited := manager.Servers()[0].current()
+	if _, err := defs[1].Function(context.Background(), &tools.Env{}, nil); err == nil || !strings.Contains(err.Error(), "exited during the call") {
+		t.Errorf("exit: got %v, want the server to have exited", err)
+	}
+	<-exited.Done()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := defs[0].Function(context.Background(), &tools.Env{}, json.RawMessage(`{"text": "again"}`))
+			if err != nil || output != "again" {
+				t.Errorf("echo after the exit = %q, %v", output, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := launches(t, dir); n != 2 {
+		t.Errorf("server launched %d times, want 2", n)
+	}
+
+	if err := manager.Reconnect(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := launches(t, dir); n != 3 {
+		t.Errorf("server launched %d times after /mcp reconnect, want 3", n)
+	}
+	if err := manager.Reconnect(context.Background(), "other"); err == nil {
+		t.Error("reconnected a server that is not configured")
+	}
+}
+
+func TestToolName(t *testing.T) {
+	long := strings.Repeat("x", 70)
+	tests := []struct {
+		server, tool string
+		want         string
+	}{
+		{server: "github", tool: "create_issue", want: "mcp__github__create_issue"},
+		{server: "my.docs", tool: "search docs", want: "mcp__my_docs__search_docs"},
+		{server: "s", tool: long + "a", want: "mcp__s__" + long[:47] + "_"},
+	}
+	for _, test := range tests {
+		got := ToolName(test.server, test.tool)
+		if !strings.HasPrefix(got, test.want) || len(got) > maxToolName {
+			t.Errorf("ToolName(%q, %q) = %q, want it to start with %q and fit in %d", test.server, test.tool, got, test.want, maxToolName)
+		}
+	}
+
+	// Long names that differ only past the cut, or in characters replaced, stay apart
+	if ToolName("s", long+"a") == ToolName("s", long+"b") {
+		t.Error("tools differing past the cut got the same name")
+	}
+	if ToolName("s", strings.Repeat("a.", 35)) == ToolName("s", strings.Repeat("a_", 35)) {
+		t.Error("long tools differing in replaced characters got the same name")
+	}
+	if got := ToolName("s", long); len(got) != maxToolName {
+		t.Errorf("ToolName of a long tool is %d long, want %d", len(got), maxToolName)
+	}
+}
+
+func TestDuplicateToolNames(t *testing.T) {
+	manager := &Manager{servers: []*Server{
+		{Name: "a", tools: []Tool{{Name: "search.docs"}, {Name: "search_docs"}, {Name: "other"}}},
+		{Name: "b", tools: []Tool{{Name: "search_docs"}}},
+	}}
+	var names []string
+	for _, def := range manager.Tools() {
+		names = append(names, def.Name)
+	}
+	want := "mcp__a__search_docs mcp__a__other mcp__b__search_docs"
+	if strings.Join(names, " ") != want {
+		t.Errorf("Tools = %v, want %s", names, want)
+	}
+	if status := manager.Status(); strings.Count(status, "left out") != 1 {
+		t.Errorf("Status = %q, want the duplicate marked", status)
+	}
+	if errs := manager.Start(context.Background()); !strings.Contains(fmt.Sprint(errs), "tool search_docs is left out") {
+		t.Errorf("Start = %v, want the duplicate reported", errs)
+	}
+}
@@ -0,0 +1,106 @@
+// Package mcp connects the agent to Model Context Protocol servers and
+// serves the agent's own tools over MCP
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the MCP revision this package speaks
+const ProtocolVersion = "2025-03-26"
+
+// Implementation names a client or server in the initialize handshake
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// agentInfo identifies the agent to MCP servers and clients
+var agentInfo = Implementation{Name: "coding-agent", Version: "1.0.0"}
+
+// initializeParams are sent by the client to start a session
+type initializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      Implementation         `json:"clientInfo"`
+}
+
+// initializeResult is the server's answer to initialize
+type initializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      Implementation         `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// Tool is a tool offered by an MCP server
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// listToolsParams page through tools/list
+type listToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// listToolsResult is one page of tools
+type listToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// callToolParams invoke a tool
+type callToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Content is one item of a tool result
+type Content struct {
+	Type     string           `json:"type"`
+	Text     string           `json:"text,omitempty"`
+	Data     string           `json:"data,omitempty"`
+	MimeType string           `json:"mimeType,omitempty"`
+	Resource *ResourceContent `json:"resource,omitempty"`
+}
+
+// ResourceContent is a resource embedded in a tool result
+type ResourceContent struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// CallResult is the outcome of a tool call
+type CallResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text renders the result as text for Claude. Binary content is described
+// rather than included.
+func (r *CallResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, c := range r.Content {
+		switch {
+		case c.Type == "text":
+			parts = append(parts, c.Text)
+		case c.Type == "resource" && c.Resource != nil && c.Resource.Text != "":
+			parts = append(parts, c.Resource.Text)
+		case c.Type == "resource" && c.Resource != nil:
+			parts = append(parts, fmt.Sprintf("[resource %s]", c.Resource.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content, %s]", c.Type, c.MimeType))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// TextResult returns a result holding a single piece of text
+func TextResult(text string, isError bool) *CallResult {
+	return &CallResult{Content: []Content{{Type: "text", Text: text}}, IsError: isError}
+}
@@ -0,0 +1,107 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/jsonrpc"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// Serve exposes tools over MCP on r and w, one JSON-RPC message per line,
+// until r ends. Calls run in env and must pass its permission check; a tool
+// that fails or is denied returns an error result rather than a protocol error.
+func Serve(ctx context.Context, defs []tools.ToolDefinition, env *tools.Env, r io.Reader, w io.Writer) error {
+	s := &toolServer{tools: defs, env: env}
+	return jsonrpc.NewConn(r, w).Serve(ctx, s.handle)
+}
+
+// toolServer answers MCP requests for a fixed set of tools
+type toolServer struct {
+	tools []tools.ToolDefinition
+	env   *tools.Env
+}
+
+// handle answers one request
+func (s *toolServer) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return initializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      agentInfo,
+		}, nil
+
+	case "ping":
+		return struct{}{}, nil
+
+	case "tools/list":
+		list := make([]Tool, 0, len(s.tools))
+		for _, def := range s.tools {
+			list = append(list, Tool{Name: def.Name, Description: def.Description, InputSchema: schemaJSON(def.InputSchema)})
+		}
+		return listToolsResult{Tools: list}, nil
+
+	case "tools/call":
+		var p callToolParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: err.Error()}
+		}
+		return s.call(ctx, p)
+	}
+	if strings.HasPrefix(method, "notifications/") {
+		return nil, nil
+	}
+	return nil, &jsonrpc.Error{Code: jsonrpc.CodeMethodNotFound, Message: fmt.Sprintf("unsupported method %q", method)}
+}
+
+// call runs one tool after checking the environment's permissions
+func (s *toolServer) call(ctx context.Context, p callToolParams) (*CallResult, error) {
+	var tool *tools.ToolDefinition
+	for i := range s.tools {
+		if s.tools[i].Name == p.Name {
+			tool = &s.tools[i]
+			break
+		}
+	}
+	if tool == nil {
+		return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: fmt.Sprintf("unknown tool %q", p.Name)}
+	}
+
+	input := p.Arguments
+	if len(input) == 0 {
+		input = json.RawMessage("{}")
+	}
+	s.env.Logf("mcp-serve: %s %s", tool.Name, string(input))
+	if err := s.env.CheckPermission(ctx, tool, input); err != nil {
+		return TextResult(err.Error(), true), nil
+	}
+	output, err := tool.Function(ctx, s.env, input)
+	if err != nil {
+		return TextResult(err.Error(), true), nil
+	}
+	return TextResult(output, false), nil
+}
+
+// schemaJSON renders a tool's input schema as a JSON schema object. The
+// param is not marshalled directly, which would emit its "-" extras key.
+func schemaJSON(p anthropic.ToolInputSchemaParam) json.RawMessage {
+	schema := map[string]interface{}{}
+	for k, v := range p.GetExtraFields() {
+		schema[k] = v
+	}
+	for k, v := range p.ExtraFields {
+		schema[k] = v
+	}
+	schema["type"] = "object"
+	schema["properties"] = p.Properties
+	if p.Properties == nil {
+		schema["properties"] = map[string]interface{}{}
+	}
+	data, _ := json.Marshal(schema)
+	return data
+}
@@ -0,0 +1,110 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/jsonrpc"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+func TestServeTools(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("remember the milk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Nobody is asked, so only read-only tools may run
+	policy, err := permission.NewPolicy(permission.ModeAsk, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &tools.Env{WorkspaceRoot: dir, Permissions: policy, Confined: true}
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(context.Background(), tools.GetAllTools(), env, serverIn, serverOut)
+		serverOut.Close()
+	}()
+	client := jsonrpc.NewConn(clientIn, clientOut)
+	go client.Serve(context.Background(), serverRequestHandler)
+	ctx := context.Background()
+
+	var init initializeResult
+	if err := client.Call(ctx, "initialize", initializeParams{ProtocolVersion: ProtocolVersion, ClientInfo: agentInfo}, &init); err != nil {
+		t.Fatal(err)
+	}
+	if init.ProtocolVersion != ProtocolVersion || init.ServerInfo.Name != agentInfo.Name {
+		t.Errorf("initialize = %+v", init)
+	}
+	if err := client.Notify("notifications/initialized", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var list listToolsResult
+	if err := client.Call(ctx, "tools/list", listToolsParams{}, &list); err != nil {
+		t.Fatal(err)
+	}
+	var readFile *Tool
+	for i := range list.Tools {
+		if list.Tools[i].Name == "read_file" {
+			readFile = &list.Tools[i]
+		}
+	}
+	if len(list.Tools) != len(tools.GetAllTools()) || readFile == nil {
+		t.Fatalf("tools/list = %+v, want every built-in tool", list.Tools)
+	}
+	var schema map[string]json.RawMessage
+	if err := json.Unmarshal(readFile.InputSchema, &schema); err != nil || string(schema["type"]) != `"object"` || !strings.Contains(string(schema["properties"]), `"path"`) {
+		t.Errorf("read_file schema %s, want an object with a path property", readFile.InputSchema)
+	}
+	if _, ok := schema["-"]; ok {
+		t.Errorf("read_file schema %s has the extras key", readFile.InputSchema)
+	}
+
+	tests := []struct {
+		name    string
+		args    string
+		want    string
+		isError bool
+	}{
+		{name: "read_file", args: `{"path": "notes.txt"}`, want: "remember the milk"},
+		{name: "read_file", args: `{"path": "../outside.txt"}`, want: "outside", isError: true},
+		{name: "edit_file", args: `{"path": "notes.txt", "old_str": "milk", "new_str": "eggs"}`, want: "permission", isError: true},
+	}
+	for _, test := range tests {
+		var result CallResult
+		if err := client.Call(ctx, "tools/call", callToolParams{Name: test.name, Arguments: json.RawMessage(test.args)}, &result); err != nil {
+			t.Fatalf("%s %s: %v", test.name, test.args, err)
+		}
+		if result.IsError != test.isError || !strings.Contains(strings.ToLower(result.Text()), test.want) {
+			t.Errorf("%s %s = %+v, want %q (error %t)", test.name, test.args, result, test.want, test.isError)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != "remember the milk" {
+		t.Errorf("a denied edit changed the file to %q", data)
+	}
+
+	var rpcErr *jsonrpc.Error
+	err = client.Call(ctx, "tools/call", callToolParams{Name: "missing"}, &struct{}{})
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc.CodeInvalidParams {
+		t.Errorf("calling a missing tool: got %v, want invalid params", err)
+	}
+	err = client.Call(ctx, "resources/list", nil, &struct{}{})
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc.CodeMethodNotFound {
+		t.Errorf("resources/list: got %v, want method not found", err)
+	}
+
+	clientOut.Close()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
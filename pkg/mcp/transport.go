@@ -0,0 +1,312 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/jsonrpc"
+)
+
+// errSessionExpired is returned when an HTTP server no longer knows our session
+var errSessionExpired = errors.New("MCP session expired")
+
+// stopTimeout is how long a stdio server gets to exit after its input is closed
+const stopTimeout = 2 * time.Second
+
+// transport carries JSON-RPC messages to one MCP server
+type transport interface {
+	Call(ctx context.Context, method string, params, result interface{}) error
+	Notify(ctx context.Context, method string, params interface{}) error
+	// Done is closed once the transport can no longer be used
+	Done() <-chan struct{}
+	Close() error
+}
+
+// newTransport starts the transport the server config describes
+func newTransport(cfg config.MCPServer, dir string, stderr io.Writer) (transport, error) {
+	switch {
+	case cfg.Command != "" && cfg.URL != "":
+		return nil, errors.New("set either command or url, not both")
+	case cfg.Command != "":
+		return startStdio(cfg, dir, stderr)
+	case cfg.URL != "":
+		return newHTTPTransport(cfg), nil
+	}
+	return nil, errors.New("no command or url set")
+}
+
+// stdioTransport talks to a server process over its stdin and stdout
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	conn  *jsonrpc.Conn
+	done  chan struct{}
+}
+
+// startStdio launches the server process in dir
+func startStdio(cfg config.MCPServer, dir string, stderr io.Writer) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+	}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+
+	t := &stdioTransport{
+		cmd:   cmd,
+		stdin: stdin,
+		conn:  jsonrpc.NewConn(stdout, stdin),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		t.conn.Serve(context.Background(), serverRequestHandler)
+	}()
+	return t, nil
+}
+
+// Call implements transport
+func (t *stdioTransport) Call(ctx context.Context, method string, params, result interface{}) error {
+	return t.conn.Call(ctx, method, params, result)
+}
+
+// Notify implements transport
+func (t *stdioTransport) Notify(ctx context.Context, method string, params interface{}) error {
+	return t.conn.Notify(method, params)
+}
+
+// Done implements transport
+func (t *stdioTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// Close closes the server's input and waits for it to exit, killing it if it does not
+func (t *stdioTransport) Close() error {
+	t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(stopTimeout):
+		t.cmd.Process.Kill()
+		<-t.done
+	}
+	return t.cmd.Wait()
+}
+
+// serverRequestHandler answers the requests a server may send the client
+func serverRequestHandler(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	if method == "ping" {
+		return struct{}{}, nil
+	}
+	if strings.HasPrefix(method, "notifications/") {
+		return nil, nil
+	}
+	return nil, &jsonrpc.Error{Code: jsonrpc.CodeMethodNotFound, Message: fmt.Sprintf("unsupported method %q", method)}
+}
+
+// httpTransport talks to a streamable HTTP server, one POST per message.
+// Responses arrive as JSON or as a Server-Sent Events stream.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	nextID  atomic.Int64
+
+	mu        sync.Mutex
+	sessionID string
+	done      chan struct{}
+	closed    bool
+}
+
+// newHTTPTransport creates a transport posting to the server's URL
+func newHTTPTransport(cfg config.MCPServer) *httpTransport {
+	headers := map[string]string{}
+	for k, v := range cfg.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: headers,
+		client:  &http.Client{},
+		done:    make(chan struct{}),
+	}
+}
+
+// Call implements transport
+func (t *httpTransport) Call(ctx context.Context, method string, params, result interface{}) error {
+	id := t.nextID.Add(1)
+	resp, err := t.post(ctx, jsonrpc.Request{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	msg, err := readResponse(resp, id)
+	if err != nil {
+		return err
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// Notify implements transport
+func (t *httpTransport) Notify(ctx context.Context, method string, params interface{}) error {
+	resp, err := t.post(ctx, jsonrpc.Request{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// post sends one message, keeping track of the session the server assigns
+func (t *httpTransport) post(ctx context.Context, msg jsonrpc.Request) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && sessionID != "" {
+		resp.Body.Close()
+		t.expire()
+		return nil, errSessionExpired
+	}
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("MCP server returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// readResponse finds the response to request id in a JSON or SSE reply
+func readResponse(resp *http.Response, id int64) (*jsonrpc.Message, error) {
+	want := fmt.Sprint(id)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var msg jsonrpc.Message
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return nil, fmt.Errorf("invalid MCP response: %w", err)
+		}
+		return &msg, nil
+	}
+
+	// Read events until the one answering our request
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		var msg jsonrpc.Message
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err == nil && msg.Method == "" && string(msg.ID) == want {
+			return &msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("MCP server closed the stream without responding")
+}
+
+// expire marks the transport unusable after the server dropped our session
+func (t *httpTransport) expire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.done)
+	}
+}
+
+// Done implements transport
+func (t *httpTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// Close ends the session on the server
+func (t *httpTransport) Close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	t.expire()
+	if sessionID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,372 @@
+// Package memory keeps notes Claude saves about the user and the project, so
+// what it learns in one session is available in the next.
+package memory
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+)
+
+// FileName is the name of the memory file in the user and project config directories
+const FileName = "memory.json"
+
+// Scope is where a memory applies
+type Scope string
+
+const (
+	// ScopeUser memories apply in every workspace
+	ScopeUser Scope = "user"
+	// ScopeProject memories apply in one workspace
+	ScopeProject Scope = "project"
+)
+
+// ParseScope validates a scope name, defaulting to the project
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case "", ScopeProject:
+		return ScopeProject, nil
+	case ScopeUser:
+		return ScopeUser, nil
+	}
+	return "", fmt.Errorf("unknown scope %q; use user or project", s)
+}
+
+// Entry is a saved memory
+type Entry struct {
+	ID        string    `json:"id"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Uses counts how often the memory was found by a search
+	Uses  int   `json:"uses,omitempty"`
+	Scope Scope `json:"-"`
+}
+
+// ErrNotFound is returned for memory ids that do not exist
+var ErrNotFound = errors.New("no memory with that id")
+
+// Memory stores entries in a JSON file per scope. Files are read on every
+// access and changed under a file lock, so sessions running side by side see
+// each other's changes and do not lose them.
+type Memory struct {
+	mu    sync.Mutex
+	paths map[Scope]string
+}
+
+// Open returns the memory of the user and of the workspace at workspaceRoot
+func Open(workspaceRoot string) *Memory {
+	paths := map[Scope]string{}
+	if dir, err := config.UserDir(); err == nil {
+		paths[ScopeUser] = filepath.Join(dir, FileName)
+	}
+	if workspaceRoot != "" {
+		paths[ScopeProject] = filepath.Join(config.ProjectDir(workspaceRoot), FileName)
+	}
+	return &Memory{paths: paths}
+}
+
+// Entries returns every memory, project ones first, oldest first within a scope
+func (m *Memory) Entries() ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []Entry
+	for _, scope := range []Scope{ScopeProject, ScopeUser} {
+		entries, err := m.load(scope)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+// Save adds a memory
+func (m *Memory) Save(scope Scope, content string, tags []string) (Entry, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Entry{}, errors.New("the memory is empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	unlock, err := m.lock(scope)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer unlock()
+	entries, err := m.load(scope)
+	if err != nil {
+		return Entry{}, err
+	}
+	now := time.Now()
+	entry := Entry{ID: newID(), Content: content, Tags: tags, CreatedAt: now, UpdatedAt: now, Scope: scope}
+	if err := m.store(scope, append(entries, entry)); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// Update replaces the content of a memory, and its tags if tags is not nil
+func (m *Memory) Update(id, content string, tags []string) (Entry, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Entry{}, errors.New("the memory is empty; delete it instead")
+	}
+	var updated Entry
+	err := m.change(id, func(entries []Entry, i int) []Entry {
+		entries[i].Content = content
+		if tags != nil {
+			entries[i].Tags = tags
+		}
+		entries[i].UpdatedAt = time.Now()
+		updated = entries[i]
+		return entries
+	})
+	return updated, err
+}
+
+// Delete removes a memory, returning what it held
+func (m *Memory) Delete(id string) (Entry, error) {
+	var deleted Entry
+	err := m.change(id, func(entries []Entry, i int) []Entry {
+		deleted = entries[i]
+		return append(entries[:i], entries[i+1:]...)
+	})
+	return deleted, err
+}
+
+// MarkUsed counts a use of each of the memories
+func (m *Memory) MarkUsed(ids []string) error {
+	for _, id := range ids {
+		err := m.change(id, func(entries []Entry, i int) []Entry {
+			entries[i].Uses++
+			return entries
+		})
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search returns up to limit memories ranked by relevance to query, leaving
+// out those that share no words with it
+func (m *Memory) Search(query string, limit int) ([]Entry, error) {
+	entries, err := m.Entries()
+	if err != nil {
+		return nil, err
+	}
+	terms := words(query)
+	var matches []Entry
+	for _, entry := range entries {
+		if overlap(terms, entry) > 0 {
+			matches = append(matches, entry)
+		}
+	}
+	return Rank(matches, query, limit), nil
+}
+
+// Rank orders entries by relevance to query: shared words first, then
+// project memories, ones used often and ones updated recently. It returns
+// at most limit entries, or all of them if limit is 0.
+func Rank(entries []Entry, query string, limit int) []Entry {
+	terms := words(query)
+	scores := make(map[string]float64, len(entries))
+	for _, entry := range entries {
+		score := 2 * float64(overlap(terms, entry))
+		if entry.Scope == ScopeProject {
+			score += 0.5
+		}
+		score += 0.5 * math.Log1p(float64(entry.Uses))
+		age := time.Since(entry.UpdatedAt).Hours() / 24
+		score += 1 / (1 + age/30)
+		scores[entry.ID] = score
+	}
+	ranked := append([]Entry(nil), entries...)
+	sort.SliceStable(ranked, func(i, j int) bool { return scores[ranked[i].ID] > scores[ranked[j].ID] })
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// change applies fn to the entries of the scope holding id and stores the result
+func (m *Memory) change(id string, fn func(entries []Entry, i int) []Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, scope := range []Scope{ScopeProject, ScopeUser} {
+		found, err := m.changeIn(scope, id, fn)
+		if found || err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// changeIn applies fn to the entry with id if the scope holds it, under the
+// scope's file lock, and reports whether it did
+func (m *Memory) changeIn(scope Scope, id string, fn func(entries []Entry, i int) []Entry) (bool, error) {
+	if _, ok := m.paths[scope]; !ok {
+		return false, nil
+	}
+	unlock, err := m.lock(scope)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	entries, err := m.load(scope)
+	if err != nil {
+		return false, err
+	}
+	for i := range entries {
+		if entries[i].ID == id {
+			return true, m.store(scope, fn(entries, i))
+		}
+	}
+	return false, nil
+}
+
+// lock takes the advisory lock on a scope's memory, which other processes
+// using the same file honor too, and returns the function releasing it
+func (m *Memory) lock(scope Scope) (func(), error) {
+	path, ok := m.paths[scope]
+	if !ok {
+		return nil, fmt.Errorf("there is no %s memory", scope)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create memory directory: %w", err)
+	}
+	// The lock is on a file of its own, as the memory file is replaced on every write
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s memory: %w", scope, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s memory: %w", scope, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// load reads the entries of a scope; a missing file holds none
+func (m *Memory) load(scope Scope) ([]Entry, error) {
+	path, ok := m.paths[scope]
+	if !ok {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s memory: %w", scope, err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i := range entries {
+		entries[i].Scope = scope
+	}
+	return entries, nil
+}
+
+// store writes the entries of a scope; the caller holds the scope's lock
+func (m *Memory) store(scope Scope, entries []Entry) error {
+	path, ok := m.paths[scope]
+	if !ok {
+		return fmt.Errorf("there is no %s memory", scope)
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted write never loses memories
+	tmp, err := os.CreateTemp(filepath.Dir(path), FileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s memory: %w", scope, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s memory: %w", scope, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Format shows an entry on one line with its id and scope
+func Format(entry Entry) string {
+	line := strings.Join(strings.Fields(entry.Content), " ")
+	if len(entry.Tags) > 0 {
+		line += fmt.Sprintf(" [%s]", strings.Join(entry.Tags, ", "))
+	}
+	return fmt.Sprintf("%s (%s) %s", entry.ID, entry.Scope, line)
+}
+
+// newID returns a short random memory id
+func newID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("m%d", time.Now().UnixNano())
+	}
+	return "m" + hex.EncodeToString(b)
+}
+
+// stopWords are too common to tell memories apart
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "this": true, "that": true, "are": true,
+	"was": true, "use": true, "not": true, "you": true, "how": true, "what": true, "from": true,
+	"into": true, "can": true, "should": true, "when": true, "all": true, "any": true,
+}
+
+// words returns the distinct lowercase words of text worth matching on
+func words(text string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		if len(word) > 2 && !stopWords[word] {
+			set[word] = true
+		}
+	}
+	return set
+}
+
+// overlap counts the query terms found in an entry's content and tags
+func overlap(terms map[string]bool, entry Entry) int {
+	entryWords := words(entry.Content + " " + strings.Join(entry.Tags, " "))
+	n := 0
+	for term := range terms {
+		if entryWords[term] {
+			n++
+		}
+	}
+	return n
+}
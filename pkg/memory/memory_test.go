@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTemp opens a memory whose user and project files are in a temporary directory
+func openTemp(t *testing.T) *Memory {
+	t.Helper()
+	dir := t.TempDir()
+	return &Memory{paths: map[Scope]string{
+		ScopeUser:    filepath.Join(dir, "user", FileName),
+		ScopeProject: filepath.Join(dir, "project", FileName),
+	}}
+}
+
+func TestRank(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-365 * 24 * time.Hour)
+	entries := []Entry{
+		{ID: "unrelated", Content: "the user prefers tabs", Scope: ScopeUser, UpdatedAt: now},
+		{ID: "tests", Content: "run the tests with make test", Scope: ScopeUser, UpdatedAt: now},
+		{ID: "tests-race", Content: "run the tests with the race detector", Tags: []string{"race"}, Scope: ScopeUser, UpdatedAt: now},
+		{ID: "project", Content: "run the tests with make test", Scope: ScopeProject, UpdatedAt: now},
+		{ID: "stale", Content: "run the tests with make test", Scope: ScopeUser, UpdatedAt: old},
+		{ID: "used", Content: "run the tests with make test", Scope: ScopeUser, UpdatedAt: now, Uses: 20},
+	}
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{name: "shared words first", query: "race tests", limit: 1, want: []string{"tests-race"}},
+		{name: "project, used and recent memories next", query: "tests", limit: 0,
+			want: []string{"used", "project", "tests", "tests-race", "stale", "unrelated"}},
+		{name: "limit", query: "tabs", limit: 2, want: []string{"unrelated", "used"}},
+		{name: "stop words do not count", query: "the with", limit: 1, want: []string{"used"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, entry := range Rank(entries, test.query, test.limit) {
+			got = append(got, entry.ID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Rank = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSaveUpdateDelete(t *testing.T) {
+	m := openTemp(t)
+	saved, err := m.Save(ScopeProject, "  run go test ./... before committing ", []string{"tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := m.Save(ScopeUser, "the user likes short commit messages", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Save(ScopeProject, "   ", nil); err == nil {
+		t.Error("saved an empty memory")
+	}
+
+	entries, err := m.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != saved.ID || entries[0].Content != "run go test ./... before committing" || entries[1].Scope != ScopeUser {
+		t.Fatalf("Entries = %+v, want the project memory then the user one", entries)
+	}
+
+	updated, err := m.Update(user.ID, "the user likes one-line commit messages", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Content != "the user likes one-line commit messages" || updated.Scope != ScopeUser {
+		t.Errorf("Update = %+v", updated)
+	}
+	found, err := m.Search("commit messages", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].ID != user.ID {
+		t.Errorf("Search = %+v, want only the updated user memory", found)
+	}
+	if err := m.MarkUsed([]string{user.ID, "m-gone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := m.Delete(saved.ID)
+	if err != nil || deleted.ID != saved.ID {
+		t.Fatalf("Delete = %+v, %v", deleted, err)
+	}
+	if _, err := m.Delete(saved.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrNotFound", err)
+	}
+
+	// Another session reads what this one wrote
+	other := &Memory{paths: m.paths}
+	entries, err = other.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != user.ID || entries[0].Uses != 1 || len(entries[0].Tags) != 0 {
+		t.Errorf("Entries = %+v, want only the updated user memory, used once", entries)
+	}
+}
+
+func TestConcurrentSave(t *testing.T) {
+	m := openTemp(t)
+	const sessions, saves = 4, 10
+
+	// Each session has its own Memory, as separate processes would
+	var wg sync.WaitGroup
+	for s := 0; s < sessions; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			session := &Memory{paths: m.paths}
+			for i := 0; i < saves; i++ {
+				if _, err := session.Save(ScopeProject, fmt.Sprintf("session %d note %d", s, i), nil); err != nil {
+					t.Error(err)
+				}
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	entries, err := m.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != sessions*saves {
+		t.Errorf("%d memories saved, want %d", len(entries), sessions*saves)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(m.paths[ScopeProject]), "*.tmp"))
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+	if info, err := os.Stat(m.paths[ScopeProject]); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("memory file: %v, %v", info, err)
+	}
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// maxSearchResults is how many memories a search returns
+const maxSearchResults = 10
+
+// ToolInput is the input of the memory tool
+type ToolInput struct {
+	Action  string   `json:"action" jsonschema:"enum=save,enum=update,enum=delete" jsonschema_description:"save a new memory, update one's content or delete one."`
+	Content string   `json:"content,omitempty" jsonschema_description:"For save and update: the memory, a short self-contained fact."`
+	Tags    []string `json:"tags,omitempty" jsonschema_description:"For save and update: a few keywords to find the memory by."`
+	Scope   string   `json:"scope,omitempty" jsonschema:"enum=project,enum=user" jsonschema_description:"For save: project (the default) for facts about this codebase, user for the user's preferences everywhere."`
+	ID      string   `json:"id,omitempty" jsonschema_description:"For update and delete: the memory's id."`
+}
+
+// SearchInput is the input of the memory_search tool
+type SearchInput struct {
+	Query string `json:"query" jsonschema_description:"Words to look for."`
+}
+
+var (
+	toolInputSchema   = tools.GenerateSchema[ToolInput]()
+	searchInputSchema = tools.GenerateSchema[SearchInput]()
+)
+
+// Tools returns the memory tools: memory_search, which only reads and so
+// runs in every mode, and memory, which saves, updates and deletes notes
+// that outlast the session
+func (m *Memory) Tools() []tools.ToolDefinition {
+	return []tools.ToolDefinition{m.SearchTool(), m.Tool()}
+}
+
+// SearchTool returns the memory_search tool
+func (m *Memory) SearchTool() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name: "memory_search",
+		Description: `Search memories: short notes kept across sessions.
+
+Relevant memories are shown to you when a session starts; search for others when they might help.
+`,
+		InputSchema: searchInputSchema,
+		Function:    m.search,
+		// Searching only counts how often each memory is found
+		ReadOnly: true,
+	}
+}
+
+// Tool returns the memory tool
+func (m *Memory) Tool() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name: "memory",
+		Description: `Save, update or delete memories: short notes kept across sessions.
+
+Save what would help in future sessions and is not obvious from the code, such as how to build and test the project,
+conventions the user asked for, or pitfalls you ran into. Keep each memory to one self-contained fact. Search with
+memory_search before saving, and update or delete memories that turn out to be wrong or out of date instead of saving
+contradicting ones.
+`,
+		InputSchema: toolInputSchema,
+		Function:    m.run,
+	}
+}
+
+// search carries out a memory_search tool call
+func (m *Memory) search(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+	searchInput := SearchInput{}
+	if err := json.Unmarshal(input, &searchInput); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(searchInput.Query) == "" {
+		return "", errors.New("search needs a query")
+	}
+	entries, err := m.Search(searchInput.Query, maxSearchResults)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "No memories match.", nil
+	}
+	ids := make([]string, len(entries))
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i], lines[i] = entry.ID, Format(entry)
+	}
+	if err := m.MarkUsed(ids); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// run carries out a memory tool call
+func (m *Memory) run(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+	toolInput := ToolInput{}
+	if err := json.Unmarshal(input, &toolInput); err != nil {
+		return "", err
+	}
+
+	switch toolInput.Action {
+	case "save":
+		scope, err := ParseScope(toolInput.Scope)
+		if err != nil {
+			return "", err
+		}
+		entry, err := m.Save(scope, toolInput.Content, toolInput.Tags)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Saved %s memory %s.", scope, entry.ID), nil
+	case "update":
+		entry, err := m.Update(toolInput.ID, toolInput.Content, toolInput.Tags)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Updated memory %s.", entry.ID), nil
+	case "delete":
+		entry, err := m.Delete(toolInput.ID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Deleted memory %s.", entry.ID), nil
+	}
+	return "", fmt.Errorf("unknown action %q; use save, update or delete, or memory_search to search", toolInput.Action)
+}
@@ -0,0 +1,429 @@
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// Mode decides which tool calls run without asking
+type Mode string
+
+const (
+	// ModeAsk asks before any tool call with side effects
+	ModeAsk Mode = "ask"
+	// ModeAcceptEdits allows file edits but asks before other side effects
+	ModeAcceptEdits Mode = "accept-edits"
+	// ModeAllowAll runs every tool call without asking
+	ModeAllowAll Mode = "allow-all"
+	// ModeReadOnly only allows tools without side effects
+	ModeReadOnly Mode = "read-only"
+)
+
+// Modes lists every valid mode
+var Modes = []Mode{ModeAsk, ModeAcceptEdits, ModeAllowAll, ModeReadOnly}
+
+// ParseMode validates a mode name
+func ParseMode(s string) (Mode, error) {
+	for _, m := range Modes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown permission mode %q (want one of ask, accept-edits, allow-all, read-only)", s)
+}
+
+// EditTools are the tools ModeAcceptEdits allows without asking
+var EditTools = map[string]bool{
+	"edit_file": true,
+}
+
+// StateTools change only the agent's own todo list or plan; every mode but
+// read-only allows them without asking
+var StateTools = map[string]bool{
+	"todo":        true,
+	"submit_plan": true,
+	"update_plan": true,
+}
+
+// CommandTools are the tools whose subject is a shell command. A rule pattern
+// must match each command of a compound command, and never matches commands
+// that substitute other commands or redirect.
+var CommandTools = map[string]bool{
+	"run_command": true,
+}
+
+// ErrDenied is returned for tool calls the policy does not allow
+var ErrDenied = errors.New("permission denied")
+
+// Decision is the user's answer to a permission request
+type Decision int
+
+const (
+	Deny Decision = iota
+	Allow
+	AllowAlways
+)
+
+// decisionNames are the names decisions have in protocols and config
+var decisionNames = map[Decision]string{
+	Deny:        "deny",
+	Allow:       "allow",
+	AllowAlways: "always",
+}
+
+// String returns the decision's name
+func (d Decision) String() string {
+	return decisionNames[d]
+}
+
+// ParseDecision parses a decision name: deny, allow or always
+func ParseDecision(s string) (Decision, error) {
+	for d, name := range decisionNames {
+		if name == s {
+			return d, nil
+		}
+	}
+	return Deny, fmt.Errorf("unknown permission decision %q (want allow, deny or always)", s)
+}
+
+// Request describes a tool call awaiting approval
+type Request struct {
+	Tool    string          `json:"tool"`
+	Input   json.RawMessage `json:"input"`
+	Subject string          `json:"subject,omitempty"`
+}
+
+// AlwaysLabel describes what answering always allows for the rest of the session
+func (r Request) AlwaysLabel() string {
+	if r.Subject == "" {
+		return "always allow " + r.Tool
+	}
+	return "always allow exactly this"
+}
+
+// Asker asks the user whether a tool call may run
+type Asker interface {
+	AskPermission(ctx context.Context, req Request) (Decision, error)
+}
+
+// Policy decides whether tool calls may run, asking the user when it cannot decide
+type Policy struct {
+	mu    sync.Mutex
+	mode  Mode
+	allow []Rule
+	deny  []Rule
+	asker Asker
+	// always holds the calls the user allowed for the rest of the session, as
+	// "tool(subject)", or the tool name for calls without a subject
+	always map[string]bool
+	// reviewEdits lets edits run without asking, as the user reviews them before they are written
+	reviewEdits bool
+}
+
+// NewPolicy creates a policy. Rules are tool names, optionally followed by a
+// pattern in parentheses matched against the command or path, e.g.
+// "run_command(go test *)"; * in the tool name matches any characters, as in
+// "mcp__github__*". A nil asker denies anything that needs approval.
+func NewPolicy(mode Mode, allow, deny []string, asker Asker) (*Policy, error) {
+	allowRules, err := ParseRules(allow)
+	if err != nil {
+		return nil, err
+	}
+	denyRules, err := ParseRules(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{
+		mode:   mode,
+		allow:  allowRules,
+		deny:   denyRules,
+		asker:  asker,
+		always: map[string]bool{},
+	}, nil
+}
+
+// Mode returns the current mode
+func (p *Policy) Mode() Mode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mode
+}
+
+// SetMode switches the policy to another mode
+func (p *Policy) SetMode(mode Mode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mode = mode
+}
+
+// SetAsker replaces the asker used for calls that need approval
+func (p *Policy) SetAsker(asker Asker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.asker = asker
+}
+
+// SetReviewEdits tells the policy whether the user reviews file edits
+// before they are written, which then need no approval beforehand
+func (p *Policy) SetReviewEdits(review bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reviewEdits = review
+}
+
+// Rules returns the allow and deny rules and the calls the user allowed for
+// the rest of the session
+func (p *Policy) Rules() (allow, deny []Rule, always []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for call := range p.always {
+		always = append(always, call)
+	}
+	sort.Strings(always)
+	return append([]Rule(nil), p.allow...), append([]Rule(nil), p.deny...), always
+}
+
+// AddAllow adds an allow rule for the rest of the session
+func (p *Policy) AddAllow(rule Rule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allow = append(p.allow, rule)
+}
+
+// AddDeny adds a deny rule for the rest of the session
+func (p *Policy) AddDeny(rule Rule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deny = append(p.deny, rule)
+}
+
+// CheckPermission implements tools.PermissionChecker
+func (p *Policy) CheckPermission(ctx context.Context, tool *tools.ToolDefinition, input json.RawMessage) error {
+	subject := Subject(input)
+
+	p.mu.Lock()
+	mode, asker, reviewEdits := p.mode, p.asker, p.reviewEdits
+	denied := blockAny(p.deny, tool.Name, subject)
+	allowed := allowAll(p.allow, tool.Name, subject) || p.always[alwaysKey(tool.Name, subject)]
+	p.mu.Unlock()
+
+	switch {
+	case denied:
+		return fmt.Errorf("%w: %s is blocked by a deny rule", ErrDenied, tool.Name)
+	case mode == ModeReadOnly && !tool.ReadOnly:
+		return fmt.Errorf("%w: %s is not available in read-only mode", ErrDenied, tool.Name)
+	case tool.ReadOnly, allowed, mode == ModeAllowAll, StateTools[tool.Name]:
+		return nil
+	case (mode == ModeAcceptEdits || reviewEdits) && EditTools[tool.Name]:
+		return nil
+	case asker == nil:
+		return fmt.Errorf("%w: %s needs approval, which is not available here; change the permission mode or add an allow rule", ErrDenied, tool.Name)
+	}
+
+	decision, err := asker.AskPermission(ctx, Request{Tool: tool.Name, Input: input, Subject: subject})
+	if err != nil {
+		return err
+	}
+	switch decision {
+	case AllowAlways:
+		p.mu.Lock()
+		p.always[alwaysKey(tool.Name, subject)] = true
+		p.mu.Unlock()
+		return nil
+	case Allow:
+		return nil
+	default:
+		return fmt.Errorf("%w: the user declined to run %s", ErrDenied, tool.Name)
+	}
+}
+
+// alwaysKey identifies the calls an always answer allows: the same tool with
+// exactly the same subject
+func alwaysKey(tool, subject string) string {
+	if subject == "" {
+		return tool
+	}
+	return fmt.Sprintf("%s(%s)", tool, subject)
+}
+
+// Rule matches tool calls by tool name and, optionally, by subject
+type Rule struct {
+	Tool    string
+	Pattern string
+	toolRe  *regexp.Regexp
+	re      *regexp.Regexp
+}
+
+// ParseRules parses rules of the form "tool" or "tool(pattern)"
+func ParseRules(specs []string) ([]Rule, error) {
+	var rules []Rule
+	for _, spec := range specs {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ParseRule parses a single rule; "*" in the pattern matches any text
+func ParseRule(spec string) (Rule, error) {
+	spec = strings.TrimSpace(spec)
+	open := strings.IndexByte(spec, '(')
+	if open < 0 {
+		if spec == "" {
+			return Rule{}, fmt.Errorf("empty permission rule")
+		}
+		return Rule{Tool: spec, toolRe: glob(spec)}, nil
+	}
+	if !strings.HasSuffix(spec, ")") {
+		return Rule{}, fmt.Errorf("invalid permission rule %q: missing closing parenthesis", spec)
+	}
+
+	rule := Rule{Tool: spec[:open], Pattern: spec[open+1 : len(spec)-1]}
+	rule.toolRe = glob(rule.Tool)
+	rule.re = glob(rule.Pattern)
+	return rule, nil
+}
+
+// glob compiles a pattern in which * matches anything
+func glob(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// Matches reports whether the rule applies to a call. For command tools the
+// pattern has to match every command of a compound command.
+func (r Rule) Matches(tool, subject string) bool {
+	if !r.toolRe.MatchString(tool) {
+		return false
+	}
+	if r.re == nil {
+		return true
+	}
+	if !CommandTools[tool] {
+		return r.re.MatchString(subject)
+	}
+	commands, ok := splitCommand(subject)
+	if !ok || len(commands) == 0 {
+		return false
+	}
+	for _, command := range commands {
+		if !r.re.MatchString(command) {
+			return false
+		}
+	}
+	return true
+}
+
+// blocks reports whether the rule, as a deny rule, applies to a call: to its
+// whole subject or to any command of a compound command
+func (r Rule) blocks(tool, subject string) bool {
+	if !r.toolRe.MatchString(tool) {
+		return false
+	}
+	if r.re == nil || r.re.MatchString(subject) {
+		return true
+	}
+	if CommandTools[tool] {
+		commands, _ := splitCommand(subject)
+		for _, command := range commands {
+			if r.re.MatchString(command) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String formats the rule as it is written in config
+func (r Rule) String() string {
+	if r.Pattern == "" {
+		return r.Tool
+	}
+	return fmt.Sprintf("%s(%s)", r.Tool, r.Pattern)
+}
+
+// matchAny reports whether any rule applies to a call
+func matchAny(rules []Rule, tool, subject string) bool {
+	for _, r := range rules {
+		if r.Matches(tool, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowAll reports whether allow rules cover a call. Each command of a
+// compound command may be covered by a different rule.
+func allowAll(rules []Rule, tool, subject string) bool {
+	if matchAny(rules, tool, subject) {
+		return true
+	}
+	if !CommandTools[tool] {
+		return false
+	}
+	commands, ok := splitCommand(subject)
+	if !ok || len(commands) < 2 {
+		return false
+	}
+	for _, command := range commands {
+		if !matchAny(rules, tool, command) {
+			return false
+		}
+	}
+	return true
+}
+
+// blockAny reports whether any deny rule applies to a call
+func blockAny(rules []Rule, tool, subject string) bool {
+	for _, r := range rules {
+		if r.blocks(tool, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandSeparator splits a shell command line into the commands it runs
+var commandSeparator = regexp.MustCompile(`&&|\|\||[;|&\n]`)
+
+// splitCommand splits a shell command on ;, &&, ||, |, & and newlines,
+// trimming the subshell and group brackets around each command. ok is false
+// when the command substitutes other commands or redirects, which no rule
+// pattern can vouch for.
+func splitCommand(command string) (commands []string, ok bool) {
+	for _, part := range commandSeparator.Split(command, -1) {
+		if part = strings.Trim(part, " \t(){}"); part != "" {
+			commands = append(commands, part)
+		}
+	}
+	return commands, !strings.ContainsAny(command, "`<>") && !strings.Contains(command, "$(")
+}
+
+// Subject extracts what a call acts on, its command or path, for rule matching and prompts
+func Subject(input json.RawMessage) string {
+	var fields struct {
+		Command string `json:"command"`
+		Path    string `json:"path"`
+	}
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return ""
+	}
+	if fields.Command != "" {
+		return fields.Command
+	}
+	return fields.Path
+}
@@ -0,0 +1,93 @@
+package plan
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/review"
+)
+
+// Decision is what the user made of a proposed plan
+type Decision struct {
+	Approved bool
+	// Plan is the plan to carry out, changed if the user edited it
+	Plan   *Plan
+	Edited bool
+	// Feedback is why the user rejected the plan
+	Feedback string
+}
+
+// Approver asks the user to approve, edit or reject plans
+type Approver struct {
+	UI review.UI
+}
+
+var approveChoices = []review.Choice{{Key: 'a', Label: "approve"}, {Key: 'e', Label: "edit"}, {Key: 'r', Label: "reject"}}
+
+// ApprovePlan shows p and returns the user's decision. Editing opens the plan
+// as markdown in the user's editor and shows it again once saved.
+func (a *Approver) ApprovePlan(ctx context.Context, p *Plan) (*Decision, error) {
+	decision := &Decision{Plan: p}
+	var note string
+	for {
+		body := strings.Split(strings.TrimRight(decision.Plan.Markdown(), "\n"), "\n")
+		if note != "" {
+			body = append([]string{note, ""}, body...)
+			note = ""
+		}
+		choice, err := a.UI.Choose(ctx, "Review Claude's plan", body, approveChoices)
+		if err != nil {
+			return nil, err
+		}
+
+		switch choice {
+		case 'a':
+			decision.Approved = true
+			return decision, nil
+		case 'r':
+			feedback, err := a.UI.Ask(ctx, "Why reject it? Tell Claude what to change (optional)")
+			if err != nil {
+				return nil, err
+			}
+			decision.Feedback = strings.TrimSpace(feedback)
+			return decision, nil
+		case 'e':
+			edited, err := a.edit(decision.Plan)
+			if err != nil {
+				note = fmt.Sprintf("\u001b[91mError\u001b[0m: %s", err.Error())
+				continue
+			}
+			decision.Plan = edited
+			decision.Edited = true
+		}
+	}
+}
+
+// edit opens the plan in the user's editor and parses what was saved
+func (a *Approver) edit(p *Plan) (*Plan, error) {
+	dir, err := os.MkdirTemp("", "coding-agent-plan-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a file to edit: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "plan.md")
+	if err := os.WriteFile(file, []byte(p.Markdown()), 0600); err != nil {
+		return nil, fmt.Errorf("failed to create a file to edit: %w", err)
+	}
+
+	if err := a.UI.RunEditor(review.EditorCommand(file)); err != nil {
+		return nil, fmt.Errorf("editor failed: %w", err)
+	}
+	edited, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the edited plan: %w", err)
+	}
+	parsed, err := Parse(string(edited))
+	if err != nil {
+		return nil, fmt.Errorf("the edited plan is not valid: %w", err)
+	}
+	return parsed, nil
+}
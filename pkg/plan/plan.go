@@ -0,0 +1,149 @@
+// Package plan holds the plans Claude proposes in plan mode: their steps and
+// progress, how they are shown and edited, and how the user approves them.
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Status is how far a step has got
+type Status string
+
+const (
+	Pending    Status = "pending"
+	InProgress Status = "in_progress"
+	Done       Status = "done"
+	Skipped    Status = "skipped"
+)
+
+// Statuses lists every valid status
+var Statuses = []Status{Pending, InProgress, Done, Skipped}
+
+// ParseStatus validates a status name
+func ParseStatus(s string) (Status, error) {
+	for _, status := range Statuses {
+		if string(status) == s {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("unknown status %q; use pending, in_progress, done or skipped", s)
+}
+
+// boxes mark each status in a plan's markdown
+var boxes = map[Status]string{Pending: "[ ]", InProgress: "[~]", Done: "[x]", Skipped: "[-]"}
+
+// icons mark each status in a checklist
+var icons = map[Status]string{Pending: "○", InProgress: "▸", Done: "✓", Skipped: "–"}
+
+// Step is one thing to do in a plan
+type Step struct {
+	Title   string `json:"title"`
+	Details string `json:"details,omitempty"`
+	Status  Status `json:"status,omitempty"`
+}
+
+// Plan is what Claude proposes to do: a summary and the steps to get there
+type Plan struct {
+	Summary string `json:"summary"`
+	Steps   []Step `json:"steps"`
+}
+
+// Validate checks the plan has steps with titles, marking steps without a status pending
+func (p *Plan) Validate() error {
+	if len(p.Steps) == 0 {
+		return errors.New("the plan has no steps")
+	}
+	for i := range p.Steps {
+		if strings.TrimSpace(p.Steps[i].Title) == "" {
+			return fmt.Errorf("step %d has no title", i+1)
+		}
+		if p.Steps[i].Status == "" {
+			p.Steps[i].Status = Pending
+		}
+	}
+	return nil
+}
+
+// Progress counts the steps that are finished, done or skipped
+func (p *Plan) Progress() (finished, total int) {
+	for _, step := range p.Steps {
+		if step.Status == Done || step.Status == Skipped {
+			finished++
+		}
+	}
+	return finished, len(p.Steps)
+}
+
+// Markdown writes the plan as markdown with a numbered checklist of steps,
+// which Parse reads back
+func (p *Plan) Markdown() string {
+	var b strings.Builder
+	if p.Summary != "" {
+		b.WriteString(strings.TrimSpace(p.Summary) + "\n\n")
+	}
+	for i, step := range p.Steps {
+		status := step.Status
+		if status == "" {
+			status = Pending
+		}
+		fmt.Fprintf(&b, "%d. %s %s\n", i+1, boxes[status], step.Title)
+		for _, line := range strings.Split(strings.TrimSpace(step.Details), "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "   %s\n", line)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Checklist shows the steps with their status, one per line
+func (p *Plan) Checklist() string {
+	finished, total := p.Progress()
+	lines := []string{fmt.Sprintf("Plan: %d of %d steps done", finished, total)}
+	for i, step := range p.Steps {
+		lines = append(lines, fmt.Sprintf("  %s %d. %s", icons[step.Status], i+1, step.Title))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stepLine matches a step of a plan's markdown: a number or bullet, an
+// optional checkbox and the title
+var stepLine = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*+])\s+(?:\[([ xX~-])\]\s*)?(.+)$`)
+
+// Parse reads a plan written as markdown: text before the first list item is
+// the summary, each item is a step and the lines under an item are its details
+func Parse(text string) (*Plan, error) {
+	p := &Plan{}
+	var summary []string
+	for _, line := range strings.Split(text, "\n") {
+		if m := stepLine.FindStringSubmatch(line); m != nil {
+			status := Pending
+			switch m[1] {
+			case "x", "X":
+				status = Done
+			case "~":
+				status = InProgress
+			case "-":
+				status = Skipped
+			}
+			p.Steps = append(p.Steps, Step{Title: strings.TrimSpace(m[2]), Status: status})
+			continue
+		}
+		if len(p.Steps) == 0 {
+			summary = append(summary, line)
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			step := &p.Steps[len(p.Steps)-1]
+			step.Details = strings.TrimSpace(step.Details + "\n" + line)
+		}
+	}
+	p.Summary = strings.TrimSpace(strings.Join(summary, "\n"))
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
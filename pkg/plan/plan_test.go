@@ -0,0 +1,92 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		plan  Plan
+		err   string
+		steps []Step
+	}{
+		{name: "no steps", plan: Plan{Summary: "nothing"}, err: "the plan has no steps"},
+		{name: "a step without a title", plan: Plan{Steps: []Step{{Title: "one"}, {Title: "  "}}}, err: "step 2 has no title"},
+		{
+			name:  "steps without a status are pending",
+			plan:  Plan{Steps: []Step{{Title: "one", Status: Done}, {Title: "two"}}},
+			steps: []Step{{Title: "one", Status: Done}, {Title: "two", Status: Pending}},
+		},
+	}
+	for _, test := range tests {
+		err := test.plan.Validate()
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(test.plan.Steps, test.steps) {
+			t.Errorf("%s: got %+v (error %v), want %+v", test.name, test.plan.Steps, err, test.steps)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	p := &Plan{Steps: []Step{{Status: Done}, {Status: Skipped}, {Status: InProgress}, {Status: Pending}, {}}}
+	if finished, total := p.Progress(); finished != 2 || total != 5 {
+		t.Errorf("Progress() = %d, %d, want 2, 5", finished, total)
+	}
+	if finished, total := (&Plan{}).Progress(); finished != 0 || total != 0 {
+		t.Errorf("Progress() of an empty plan = %d, %d, want 0, 0", finished, total)
+	}
+
+	p = &Plan{Steps: []Step{{Title: "a", Status: Done}, {Title: "b", Status: Skipped}, {Title: "c", Status: InProgress}, {Title: "d", Status: Pending}}}
+	want := "Plan: 2 of 4 steps done\n  ✓ 1. a\n  – 2. b\n  ▸ 3. c\n  ○ 4. d"
+	if got := p.Checklist(); got != want {
+		t.Errorf("Checklist() = %q, want %q", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	p := &Plan{
+		Summary: "Add a flag.",
+		Steps: []Step{
+			{Title: "Read the config", Status: Done},
+			{Title: "Add the flag", Details: "cmd/agent/main.go\nkeep the default", Status: InProgress},
+			{Title: "Update the docs", Status: Skipped},
+			{Title: "Run the tests", Status: Pending},
+		},
+	}
+	text := p.Markdown()
+	want := "Add a flag.\n\n1. [x] Read the config\n2. [~] Add the flag\n   cmd/agent/main.go\n   keep the default\n3. [-] Update the docs\n4. [ ] Run the tests\n"
+	if text != want {
+		t.Errorf("Markdown() = %q, want %q", text, want)
+	}
+	parsed, err := Parse(text)
+	if err != nil || !reflect.DeepEqual(parsed, p) {
+		t.Errorf("Parse(Markdown()) = %+v (error %v), want %+v", parsed, err, p)
+	}
+
+	parsed, err = Parse("Fix it\n\n- first\n* [X] second\n  why\n3) third")
+	steps := []Step{{Title: "first", Status: Pending}, {Title: "second", Details: "why", Status: Done}, {Title: "third", Status: Pending}}
+	if err != nil || parsed.Summary != "Fix it" || !reflect.DeepEqual(parsed.Steps, steps) {
+		t.Errorf("Parse = %+v (error %v), want the summary and %+v", parsed, err, steps)
+	}
+	if _, err := Parse("just a summary"); err == nil {
+		t.Error("Parse accepted a plan without steps")
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, status := range Statuses {
+		if got, err := ParseStatus(string(status)); got != status || err != nil {
+			t.Errorf("ParseStatus(%q) = %q, %v", status, got, err)
+		}
+	}
+	if _, err := ParseStatus("finished"); err == nil {
+		t.Error("ParseStatus accepted an unknown status")
+	}
+}
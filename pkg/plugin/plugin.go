@@ -0,0 +1,256 @@
+// Package plugin turns executables declared in config into tools. A plugin
+// runs in the workspace with the tool input as JSON on stdin and answers with
+// JSON on stdout.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// DefaultTimeout limits a call when the plugin sets no timeout
+const DefaultTimeout = time.Minute
+
+// maxOutput caps how much of a plugin's stdout is read
+const maxOutput = 1 << 20
+
+// validName matches the tool names Claude accepts
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Result is what a plugin writes to stdout. A plugin may also write any other
+// JSON value, which is given to Claude as is.
+type Result struct {
+	Output json.RawMessage `json:"output"`
+	Error  string          `json:"error"`
+}
+
+// New validates a plugin declaration and returns its tool definition
+func New(name string, spec config.PluginTool) (tools.ToolDefinition, error) {
+	if !validName.MatchString(name) {
+		return tools.ToolDefinition{}, fmt.Errorf("tool %q: names may only use letters, digits, _ and -, up to 64 characters", name)
+	}
+	if strings.HasPrefix(name, "mcp__") {
+		return tools.ToolDefinition{}, fmt.Errorf("tool %s: the mcp__ prefix is reserved for MCP tools", name)
+	}
+	if spec.Command == "" {
+		return tools.ToolDefinition{}, fmt.Errorf("tool %s: no command set", name)
+	}
+	if spec.Description == "" {
+		return tools.ToolDefinition{}, fmt.Errorf("tool %s: no description set", name)
+	}
+	if spec.Timeout < 0 {
+		return tools.ToolDefinition{}, fmt.Errorf("tool %s: timeout must not be negative", name)
+	}
+	schema, err := tools.ParseSchema(spec.InputSchema)
+	if err != nil {
+		return tools.ToolDefinition{}, fmt.Errorf("tool %s: %w", name, err)
+	}
+	required, _ := schema.GetExtraFields()["required"].([]interface{})
+
+	return tools.ToolDefinition{
+		Name:        name,
+		Description: spec.Description,
+		InputSchema: schema,
+		ReadOnly:    spec.ReadOnly,
+		Function: func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+			if err := checkRequired(input, required); err != nil {
+				return "", err
+			}
+			return Run(ctx, name, spec, env, input)
+		},
+	}, nil
+}
+
+// Load returns the tools of every enabled plugin in name order, with an error
+// for each one that is invalid, has a missing command in dir or takes the
+// name of a reserved tool
+func Load(specs map[string]config.PluginTool, dir string, reserved []tools.ToolDefinition) ([]tools.ToolDefinition, []error) {
+	taken := map[string]bool{}
+	for _, def := range reserved {
+		taken[def.Name] = true
+	}
+
+	var defs []tools.ToolDefinition
+	var errs []error
+	for _, name := range Names(specs) {
+		spec := specs[name]
+		if spec.Disabled {
+			continue
+		}
+		if taken[name] {
+			errs = append(errs, fmt.Errorf("tool %s: the name is already used by a built-in tool", name))
+			continue
+		}
+		def, err := New(name, spec)
+		if err == nil {
+			_, err = LookPath(spec.Command, dir)
+			if err != nil {
+				err = fmt.Errorf("tool %s: %w", name, err)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		defs = append(defs, def)
+	}
+	return defs, errs
+}
+
+// Names returns the declared plugin names in order
+func Names(specs map[string]config.PluginTool) []string {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookPath finds a plugin's command. Commands containing a slash are relative
+// to dir; others are searched for on PATH.
+func LookPath(command, dir string) (string, error) {
+	if strings.ContainsRune(command, filepath.Separator) && !filepath.IsAbs(command) {
+		command = filepath.Join(dir, command)
+	}
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "", fmt.Errorf("command not found: %w", err)
+	}
+	return path, nil
+}
+
+// Run invokes a plugin in the environment's workspace and returns its output
+func Run(ctx context.Context, name string, spec config.PluginTool, env *tools.Env, input json.RawMessage) (string, error) {
+	timeout := time.Duration(spec.Timeout)
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dir, err := env.ResolvePath(".")
+	if err != nil {
+		return "", err
+	}
+	command, err := LookPath(spec.Command, dir)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, spec.Args...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &limitedBuffer{buf: &stdout, limit: maxOutput}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: maxOutput}
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"CODING_AGENT_TOOL="+name,
+		"CODING_AGENT_WORKSPACE="+dir,
+	)
+	if env != nil && env.SessionID != "" {
+		cmd.Env = append(cmd.Env, "CODING_AGENT_SESSION_ID="+env.SessionID)
+	}
+	for k, v := range spec.Env {
+		cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+	}
+
+	env.Logf("plugin: %s %s", name, string(input))
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("tool %s timed out after %s", name, timeout)
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("tool %s cancelled: %w", name, ctx.Err())
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("tool %s failed (%s): %s", name, err.Error(), msg)
+	}
+	return parseOutput(name, stdout.Bytes())
+}
+
+// parseOutput reads a plugin's JSON answer
+func parseOutput(name string, data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+	if !json.Valid(data) {
+		return "", fmt.Errorf("tool %s did not write valid JSON to stdout: %q", name, truncate(string(data), 200))
+	}
+
+	var result Result
+	if bytes.HasPrefix(data, []byte("{")) && json.Unmarshal(data, &result) == nil && (result.Output != nil || result.Error != "") {
+		if result.Error != "" {
+			return "", errors.New(result.Error)
+		}
+		data = result.Output
+	}
+
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		return text, nil
+	}
+	return string(data), nil
+}
+
+// checkRequired reports required properties missing from a tool input
+func checkRequired(input json.RawMessage, required []interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return fmt.Errorf("tool input must be a JSON object: %w", err)
+	}
+	var missing []string
+	for _, r := range required {
+		if name, ok := r.(string); ok {
+			if _, ok := fields[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required input: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+// Write implements io.Writer
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// truncate shortens s to n bytes
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/config"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// manifest declares plugins the way a config file does
+const manifest = `{
+	"tools": {
+		"lint": {
+			"command": "./lint.sh",
+			"description": "Lint a file",
+			"input_schema": {"type": "object", "properties": {"path": {"type": "string"}}, "required": ["path"]},
+			"timeout": "5s",
+			"read_only": true
+		},
+		"deploy": {"command": "./lint.sh", "args": ["--deploy"], "description": "Deploy", "env": {"TARGET": "staging"}},
+		"read_file": {"command": "./lint.sh", "description": "Shadows a built-in tool"},
+		"bad name": {"command": "./lint.sh", "description": "Not a valid tool name"},
+		"mcp__fake": {"command": "./lint.sh", "description": "Looks like an MCP tool"},
+		"missing": {"command": "./missing.sh", "description": "Has no command"},
+		"old": {"command": "./lint.sh", "description": "Switched off", "disabled": true}
+	}
+}`
+
+// writeScript writes an executable shell script into dir
+func writeScript(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "lint.sh", `echo '{"output": "ok"}'`)
+	var cfg config.Config
+	if err := json.Unmarshal([]byte(manifest), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := time.Duration(cfg.Tools["lint"].Timeout); got != 5*time.Second {
+		t.Errorf("lint timeout %s, want 5s", got)
+	}
+
+	defs, errs := Load(cfg.Tools, dir, tools.GetAllTools())
+	var names []string
+	for _, def := range defs {
+		names = append(names, fmt.Sprintf("%s read-only=%t", def.Name, def.ReadOnly))
+	}
+	if want := "deploy read-only=false, lint read-only=true"; strings.Join(names, ", ") != want {
+		t.Errorf("loaded %v, want %s", names, want)
+	}
+	wantErrs := []string{"bad name", "mcp__ prefix", "missing: command not found", "read_file: the name is already used"}
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("errors %v, want %d", errs, len(wantErrs))
+	}
+	for i, want := range wantErrs {
+		if !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("error %d is %q, want it to mention %q", i, errs[i], want)
+		}
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		spec config.PluginTool
+		want string
+	}{
+		{name: "x", spec: config.PluginTool{Description: "d"}, want: "no command"},
+		{name: "x", spec: config.PluginTool{Command: "c"}, want: "no description"},
+		{name: "x", spec: config.PluginTool{Command: "c", Description: "d", Timeout: -1}, want: "negative"},
+		{name: "x", spec: config.PluginTool{Command: "c", Description: "d", InputSchema: json.RawMessage(`{"type": "array"}`)}, want: "x:"},
+		{name: strings.Repeat("x", 65), spec: config.PluginTool{Command: "c", Description: "d"}, want: "up to 64"},
+	}
+	for _, test := range tests {
+		if _, err := New(test.name, test.spec); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("New(%q, %+v): got %v, want an error mentioning %q", test.name, test.spec, err, test.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	env := &tools.Env{WorkspaceRoot: dir, SessionID: "s1"}
+	tests := []struct {
+		name    string
+		script  string
+		spec    config.PluginTool
+		input   string
+		want    string
+		wantErr string
+	}{
+		{name: "result output", script: `echo '{"output": "linted"}'`, want: "linted"},
+		{name: "structured output", script: `echo '{"output": {"warnings": 2}}'`, want: `{"warnings": 2}`},
+		{name: "any JSON", script: `echo '[1, 2]'`, want: "[1, 2]"},
+		{name: "reads its input", script: `cat`, input: `"from stdin"`, want: "from stdin"},
+		{name: "environment", script: `printf '"%s %s %s %s"' "$CODING_AGENT_TOOL" "$CODING_AGENT_SESSION_ID" "$TARGET" "$1"`,
+			spec: config.PluginTool{Args: []string{"--fast"}, Env: map[string]string{"TARGET": "staging"}}, want: "environment s1 staging --fast"},
+		{name: "result error", script: `echo '{"error": "file not found"}'`, wantErr: "file not found"},
+		{name: "not JSON", script: `echo done`, wantErr: "did not write valid JSON"},
+		{name: "fails", script: `echo broken >&2; exit 1`, wantErr: "broken"},
+		{name: "slow", script: `exec sleep 5`, spec: config.PluginTool{Timeout: config.Duration(50 * time.Millisecond)}, wantErr: "timed out"},
+	}
+	for i, test := range tests {
+		script := fmt.Sprintf("plugin%d.sh", i)
+		writeScript(t, dir, script, test.script)
+		spec := test.spec
+		spec.Command = "./" + script
+		input := test.input
+		if input == "" {
+			input = "{}"
+		}
+		got, err := Run(context.Background(), test.name, spec, env, json.RawMessage(input))
+		switch {
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s: got %q, %v, want an error mentioning %q", test.name, got, err, test.wantErr)
+		case test.wantErr == "" && (err != nil || got != test.want):
+			t.Errorf("%s: got %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestRequiredInput(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "lint.sh", `echo '{"output": "ok"}'`)
+	def, err := New("lint", config.PluginTool{
+		Command:     "./lint.sh",
+		Description: "Lint a file",
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {"path": {"type": "string"}}, "required": ["path"]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &tools.Env{WorkspaceRoot: dir}
+	if _, err := def.Function(context.Background(), env, json.RawMessage(`{}`)); err == nil || !strings.Contains(err.Error(), "missing required input: path") {
+		t.Errorf("without path: got %v, want it reported missing", err)
+	}
+	if got, err := def.Function(context.Background(), env, json.RawMessage(`{"path": "main.go"}`)); err != nil || got != "ok" {
+		t.Errorf("with path: got %q, %v", got, err)
+	}
+}
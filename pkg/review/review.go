@@ -0,0 +1,197 @@
+// Package review lets the user review file edits before they are written:
+// accept them, reject them with feedback, pick which hunks to keep, or
+// change the proposed content in their editor.
+package review
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// Choice is an answer the user can pick with its key, the first letter of its label
+type Choice struct {
+	Key   rune
+	Label string
+}
+
+// UI is how a review talks to the user
+type UI interface {
+	// Choose shows title and body and returns the key of the choice the user picked
+	Choose(ctx context.Context, title string, body []string, choices []Choice) (rune, error)
+	// Ask returns the text the user typed in answer to prompt
+	Ask(ctx context.Context, prompt string) (string, error)
+	// RunEditor runs cmd, an editor, handing it the terminal
+	RunEditor(cmd *exec.Cmd) error
+}
+
+// Reviewer implements tools.EditReviewer with a UI
+type Reviewer struct {
+	UI UI
+	// WorkspaceRoot shortens the paths shown
+	WorkspaceRoot string
+}
+
+var reviewChoices = []Choice{{'a', "accept"}, {'r', "reject"}, {'e', "edit"}, {'h', "hunks"}}
+
+// Quitting rejects the hunks not yet decided
+var hunkChoices = []Choice{{'y', "yes"}, {'n', "no"}, {'q', "quit"}}
+
+// ReviewEdit implements tools.EditReviewer
+func (r *Reviewer) ReviewEdit(ctx context.Context, preview *tools.EditPreview) (*tools.EditReview, error) {
+	name := r.relative(preview.Path)
+	proposal := preview.After
+	var note string
+	for {
+		lines := preview.Diff(proposal)
+		hunks := tools.Hunks(lines, tools.DiffContext)
+		if len(hunks) == 0 && !preview.Created {
+			// The proposal was edited back to the file as it is
+			return &tools.EditReview{Content: preview.Before}, nil
+		}
+
+		title := fmt.Sprintf("Review edit to %s", name)
+		if preview.Created {
+			title = fmt.Sprintf("Review new file %s", name)
+		}
+		body, choices := Rows(hunks), reviewChoices
+		if len(hunks) == 0 {
+			// A new empty file has no diff to show or hunks to pick from
+			body, choices = []string{"\u001b[2m(empty file)\u001b[0m"}, reviewChoices[:3]
+		}
+		if note != "" {
+			body = append([]string{note, ""}, body...)
+			note = ""
+		}
+		choice, err := r.UI.Choose(ctx, title, body, choices)
+		if err != nil {
+			return nil, err
+		}
+
+		switch choice {
+		case 'a':
+			return &tools.EditReview{Accepted: true, Content: proposal}, nil
+		case 'r':
+			feedback, err := r.UI.Ask(ctx, "Why reject it? Tell Claude what to do instead (optional)")
+			if err != nil {
+				return nil, err
+			}
+			return &tools.EditReview{Feedback: strings.TrimSpace(feedback)}, nil
+		case 'e':
+			edited, err := r.edit(preview.Path, proposal)
+			if err != nil {
+				note = fmt.Sprintf("\u001b[91mError\u001b[0m: %s", err.Error())
+				continue
+			}
+			proposal = edited
+		case 'h':
+			return r.pickHunks(ctx, name, lines, hunks)
+		}
+	}
+}
+
+// pickHunks asks about each hunk in turn and applies the accepted ones
+func (r *Reviewer) pickHunks(ctx context.Context, name string, lines []tools.DiffLine, hunks []tools.Hunk) (*tools.EditReview, error) {
+	accepted := make([]bool, len(hunks))
+	kept := 0
+	for i := range hunks {
+		title := fmt.Sprintf("Hunk %d of %d in %s", i+1, len(hunks), name)
+		choice, err := r.UI.Choose(ctx, title, Rows(hunks[i:i+1]), hunkChoices)
+		if err != nil {
+			return nil, err
+		}
+		if choice == 'q' {
+			break
+		}
+		if choice == 'y' {
+			accepted[i] = true
+			kept++
+		}
+	}
+
+	prompt := "Why reject the other hunks? (optional)"
+	if kept == 0 {
+		prompt = "Why reject it? Tell Claude what to do instead (optional)"
+	}
+	var feedback string
+	if kept < len(hunks) {
+		answer, err := r.UI.Ask(ctx, prompt)
+		if err != nil {
+			return nil, err
+		}
+		feedback = strings.TrimSpace(answer)
+	}
+	if kept == 0 {
+		return &tools.EditReview{Feedback: feedback}, nil
+	}
+	return &tools.EditReview{Accepted: true, Content: tools.ApplyHunks(lines, hunks, accepted), Feedback: feedback}, nil
+}
+
+// edit opens content in the user's editor, in a temporary file named like
+// path so the editor recognizes its type, and returns what was saved
+func (r *Reviewer) edit(path, content string) (string, error) {
+	dir, err := os.MkdirTemp("", "coding-agent-review-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a file to edit: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("failed to create a file to edit: %w", err)
+	}
+
+	if err := r.UI.RunEditor(EditorCommand(file)); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+	edited, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the edited file: %w", err)
+	}
+	return string(edited), nil
+}
+
+// relative shows path relative to the workspace when it is inside it
+func (r *Reviewer) relative(path string) string {
+	if rel, err := filepath.Rel(r.WorkspaceRoot, path); err == nil && r.WorkspaceRoot != "" && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// EditorCommand returns the command that opens path in the user's editor,
+// from $VISUAL or $EDITOR, which may include arguments, or vi
+func EditorCommand(path string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		fields = []string{"vi"}
+	}
+	return exec.Command(fields[0], append(fields[1:], path)...)
+}
+
+// Rows renders hunks as colored unified diff lines
+func Rows(hunks []tools.Hunk) []string {
+	var rows []string
+	for _, h := range hunks {
+		rows = append(rows, "\u001b[36m"+h.Header()+"\u001b[0m")
+		for _, line := range h.Lines {
+			switch line.Op {
+			case '-':
+				rows = append(rows, "\u001b[31m-"+line.Text+"\u001b[0m")
+			case '+':
+				rows = append(rows, "\u001b[32m+"+line.Text+"\u001b[0m")
+			default:
+				rows = append(rows, " "+line.Text)
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,127 @@
+package review
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// fakeUI answers choices and questions from a script and records what it was shown
+type fakeUI struct {
+	choices []rune
+	answer  string
+	// edited is what the editor saves
+	edited string
+	titles []string
+	bodies [][]string
+	asked  []string
+}
+
+func (u *fakeUI) Choose(ctx context.Context, title string, body []string, choices []Choice) (rune, error) {
+	u.titles = append(u.titles, title)
+	u.bodies = append(u.bodies, body)
+	choice := u.choices[0]
+	u.choices = u.choices[1:]
+	return choice, nil
+}
+
+func (u *fakeUI) Ask(ctx context.Context, prompt string) (string, error) {
+	u.asked = append(u.asked, prompt)
+	return u.answer, nil
+}
+
+func (u *fakeUI) RunEditor(cmd *exec.Cmd) error {
+	return os.WriteFile(cmd.Args[len(cmd.Args)-1], []byte(u.edited), 0600)
+}
+
+// numbered returns n distinct lines, with the given 1-based lines replaced
+func numbered(n int, replace map[int]string) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", i+1)
+		if text, ok := replace[i+1]; ok {
+			lines[i] = text
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestReviewEdit(t *testing.T) {
+	before := numbered(30, nil)
+	after := numbered(30, map[int]string{5: "five", 25: "twenty-five"})
+	edit := &tools.EditPreview{Path: "/work/main.go", Before: before, After: after}
+	created := &tools.EditPreview{Path: "/work/new.go", After: "package main\n", Created: true}
+
+	tests := []struct {
+		name    string
+		preview *tools.EditPreview
+		ui      fakeUI
+		want    tools.EditReview
+		titles  []string
+		asked   int
+	}{
+		{name: "accept", preview: edit, ui: fakeUI{choices: []rune{'a'}},
+			want: tools.EditReview{Accepted: true, Content: after}, titles: []string{"Review edit to main.go"}},
+		{name: "reject with feedback", preview: edit, ui: fakeUI{choices: []rune{'r'}, answer: " use a constant "},
+			want: tools.EditReview{Feedback: "use a constant"}, titles: []string{"Review edit to main.go"}, asked: 1},
+		{name: "keep the first hunk", preview: edit, ui: fakeUI{choices: []rune{'h', 'y', 'n'}, answer: "not that one"},
+			want:   tools.EditReview{Accepted: true, Content: numbered(30, map[int]string{5: "five"}), Feedback: "not that one"},
+			titles: []string{"Review edit to main.go", "Hunk 1 of 2 in main.go", "Hunk 2 of 2 in main.go"}, asked: 1},
+		{name: "keep every hunk", preview: edit, ui: fakeUI{choices: []rune{'h', 'y', 'y'}},
+			want:   tools.EditReview{Accepted: true, Content: after},
+			titles: []string{"Review edit to main.go", "Hunk 1 of 2 in main.go", "Hunk 2 of 2 in main.go"}},
+		{name: "quit rejects the rest", preview: edit, ui: fakeUI{choices: []rune{'h', 'q'}},
+			want:   tools.EditReview{},
+			titles: []string{"Review edit to main.go", "Hunk 1 of 2 in main.go"}, asked: 1},
+		{name: "edit then accept", preview: edit, ui: fakeUI{choices: []rune{'e', 'a'}, edited: numbered(30, map[int]string{5: "FIVE"})},
+			want:   tools.EditReview{Accepted: true, Content: numbered(30, map[int]string{5: "FIVE"})},
+			titles: []string{"Review edit to main.go", "Review edit to main.go"}},
+		{name: "edited back to the file", preview: edit, ui: fakeUI{choices: []rune{'e'}, edited: before},
+			want: tools.EditReview{Content: before}, titles: []string{"Review edit to main.go"}},
+		{name: "new file", preview: created, ui: fakeUI{choices: []rune{'a'}},
+			want: tools.EditReview{Accepted: true, Content: "package main\n"}, titles: []string{"Review new file new.go"}},
+		{name: "new file edited to be empty", preview: created, ui: fakeUI{choices: []rune{'e', 'a'}},
+			want: tools.EditReview{Accepted: true, Content: ""}, titles: []string{"Review new file new.go", "Review new file new.go"}},
+	}
+	for _, test := range tests {
+		ui := test.ui
+		r := &Reviewer{UI: &ui, WorkspaceRoot: "/work"}
+		got, err := r.ReviewEdit(context.Background(), test.preview)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if *got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, *got, test.want)
+		}
+		if !reflect.DeepEqual(ui.titles, test.titles) {
+			t.Errorf("%s: shown %q, want %q", test.name, ui.titles, test.titles)
+		}
+		if len(ui.asked) != test.asked {
+			t.Errorf("%s: asked %q, want %d questions", test.name, ui.asked, test.asked)
+		}
+		if len(ui.choices) != 0 {
+			t.Errorf("%s: choices %q were not used", test.name, string(ui.choices))
+		}
+	}
+}
+
+func TestReviewEmptyNewFile(t *testing.T) {
+	ui := &fakeUI{choices: []rune{'a'}}
+	r := &Reviewer{UI: ui}
+	got, err := r.ReviewEdit(context.Background(), &tools.EditPreview{Path: "empty.txt", Created: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Accepted || got.Content != "" {
+		t.Errorf("got %+v, want the empty file accepted", *got)
+	}
+	if len(ui.bodies) != 1 || !strings.Contains(strings.Join(ui.bodies[0], "\n"), "(empty file)") {
+		t.Errorf("shown %q, want the user asked about an empty file", ui.bodies)
+	}
+}
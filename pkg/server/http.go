@@ -0,0 +1,510 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/session"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+// SSE event names besides the agent's own event types
+const (
+	sseApproval         = "permission_request"
+	sseApprovalResolved = "permission_resolved"
+)
+
+const (
+	// subscriberBuffer is how many events a slow SSE client may fall behind
+	// before it is disconnected
+	subscriberBuffer = 256
+	// keepAliveInterval is how often idle SSE streams get a comment line
+	keepAliveInterval = 15 * time.Second
+	// maxBodySize limits request bodies
+	maxBodySize = 1 << 20
+)
+
+// sseEvent is one Server-Sent Event
+type sseEvent struct {
+	name string
+	data interface{}
+}
+
+// approval is a tool call waiting for a client to approve it
+type approval struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	permission.Request
+	decision chan permission.Decision
+}
+
+// sessionStream fans a session's events out to its SSE subscribers and
+// holds its pending approvals
+type sessionStream struct {
+	mu          sync.Mutex
+	subscribers map[chan sseEvent]bool
+	approvals   map[string]*approval
+}
+
+// publish sends an event to every subscriber, dropping any that fell too far behind
+func (st *sessionStream) publish(e sseEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for ch := range st.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(st.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a new subscriber
+func (st *sessionStream) subscribe() chan sseEvent {
+	ch := make(chan sseEvent, subscriberBuffer)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.subscribers[ch] = true
+	return ch
+}
+
+// unsubscribe removes a subscriber if it is still registered
+func (st *sessionStream) unsubscribe(ch chan sseEvent) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.subscribers[ch] {
+		delete(st.subscribers, ch)
+		close(ch)
+	}
+}
+
+// closeAll disconnects every subscriber
+func (st *sessionStream) closeAll() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for ch := range st.subscribers {
+		delete(st.subscribers, ch)
+		close(ch)
+	}
+}
+
+// pending returns the approvals still waiting for an answer
+func (st *sessionStream) pending() []*approval {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	approvals := make([]*approval, 0, len(st.approvals))
+	for _, a := range st.approvals {
+		approvals = append(approvals, a)
+	}
+	return approvals
+}
+
+// resolve answers an approval, reporting whether it was still pending
+func (st *sessionStream) resolve(id string, decision permission.Decision) bool {
+	st.mu.Lock()
+	a, ok := st.approvals[id]
+	delete(st.approvals, id)
+	st.mu.Unlock()
+	if !ok {
+		return false
+	}
+	a.decision <- decision
+	return true
+}
+
+// HTTPServer serves sessions over a REST API, streaming their events as
+// Server-Sent Events. Requests must carry the bearer token.
+type HTTPServer struct {
+	manager *Manager
+	token   string
+	ctx     context.Context
+	turns   sync.WaitGroup
+
+	mu      sync.Mutex
+	streams map[string]*sessionStream
+}
+
+// NewHTTPServer creates a server for the manager's sessions. Turns run until
+// ctx is cancelled, and SSE streams end with it.
+func NewHTTPServer(ctx context.Context, manager *Manager, token string) *HTTPServer {
+	return &HTTPServer{
+		manager: manager,
+		token:   token,
+		ctx:     ctx,
+		streams: map[string]*sessionStream{},
+	}
+}
+
+// Handler returns the server's HTTP handler
+func (s *HTTPServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sessions", s.handleCreate)
+	mux.HandleFunc("GET /sessions", s.handleList)
+	mux.HandleFunc("GET /sessions/{id}", s.handleGet)
+	mux.HandleFunc("DELETE /sessions/{id}", s.handleClose)
+	mux.HandleFunc("POST /sessions/{id}/resume", s.handleResume)
+	mux.HandleFunc("GET /sessions/{id}/messages", s.handleHistory)
+	mux.HandleFunc("POST /sessions/{id}/messages", s.handleSend)
+	mux.HandleFunc("POST /sessions/{id}/cancel", s.handleCancel)
+	mux.HandleFunc("GET /sessions/{id}/events", s.handleEvents)
+	mux.HandleFunc("GET /sessions/{id}/approvals", s.handleApprovals)
+	mux.HandleFunc("POST /sessions/{id}/approvals/{approval}", s.handleApprove)
+	return s.authenticate(mux)
+}
+
+// Wait blocks until every running turn has finished
+func (s *HTTPServer) Wait() {
+	s.turns.Wait()
+}
+
+// authenticate rejects requests without the bearer token
+func (s *HTTPServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionInfo describes a running session
+type sessionInfo struct {
+	SessionID     string       `json:"session_id"`
+	WorkspaceRoot string       `json:"workspace_root"`
+	Busy          bool         `json:"busy"`
+	Usage         usage.Report `json:"usage"`
+}
+
+// info describes sess
+func info(sess *Session) sessionInfo {
+	return sessionInfo{
+		SessionID:     sess.ID,
+		WorkspaceRoot: sess.Agent.WorkspaceRoot(),
+		Busy:          sess.Busy(),
+		Usage:         sess.Agent.Usage(),
+	}
+}
+
+// handleCreate starts a new session
+func (s *HTTPServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var opts SessionOptions
+	if !readJSON(w, r, &opts) {
+		return
+	}
+	sess, err := s.manager.Start(opts, s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, info(sess))
+}
+
+// handleResume continues a saved session
+func (s *HTTPServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	var opts SessionOptions
+	if !readJSON(w, r, &opts) {
+		return
+	}
+	sess, err := s.manager.Resume(r.PathValue("id"), opts, s)
+	if err != nil {
+		writeError(w, statusFor(err, http.StatusBadRequest), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info(sess))
+}
+
+// handleList lists the running sessions
+func (s *HTTPServer) handleList(w http.ResponseWriter, r *http.Request) {
+	sessions := s.manager.List()
+	infos := make([]sessionInfo, len(sessions))
+	for i, sess := range sessions {
+		infos[i] = info(sess)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// handleGet describes one session
+func (s *HTTPServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, info(sess))
+}
+
+// handleClose interrupts a session and forgets it
+func (s *HTTPServer) handleClose(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.manager.Close(id); err != nil {
+		writeError(w, statusFor(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	s.mu.Lock()
+	stream := s.streams[id]
+	delete(s.streams, id)
+	s.mu.Unlock()
+	if stream != nil {
+		stream.closeAll()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleHistory returns the session's conversation
+func (s *HTTPServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, sess.Agent.History())
+}
+
+// handleSend starts a turn with the posted message; its progress and result
+// arrive on the event stream
+func (s *HTTPServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Text string `json:"text"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("text is required"))
+		return
+	}
+
+	s.turns.Add(1)
+	err := sess.SendAsync(s.ctx, body.Text, func(*agent.Result, error) { s.turns.Done() })
+	if err != nil {
+		s.turns.Done()
+		writeError(w, statusFor(err, http.StatusInternalServerError), err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+}
+
+// handleCancel interrupts the session's turn
+func (s *HTTPServer) handleCancel(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"cancelled": sess.Agent.Interrupt()})
+}
+
+// handleEvents streams the session's events. Approvals already pending are
+// sent first so a client connecting late can still answer them.
+func (s *HTTPServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	stream := s.stream(sess.ID)
+	if stream == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", ErrNotFound, sess.ID))
+		return
+	}
+	ch := stream.subscribe()
+	defer stream.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, a := range stream.pending() {
+		writeEvent(w, sseEvent{name: sseApproval, data: a})
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, e)
+		}
+		flusher.Flush()
+	}
+}
+
+// handleApprovals lists the tool calls waiting for approval
+func (s *HTTPServer) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	stream := s.stream(sess.ID)
+	if stream == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", ErrNotFound, sess.ID))
+		return
+	}
+	writeJSON(w, http.StatusOK, stream.pending())
+}
+
+// handleApprove answers a pending approval
+func (s *HTTPServer) handleApprove(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Decision string `json:"decision"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	decision, err := permission.ParseDecision(body.Decision)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id := r.PathValue("approval")
+	stream := s.stream(sess.ID)
+	if stream == nil || !stream.resolve(id, decision) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no pending approval %s", id))
+		return
+	}
+	stream.publish(sseEvent{name: sseApprovalResolved, data: map[string]string{"id": id, "decision": decision.String()}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Event implements Client. Events of sessions that were closed are dropped.
+func (s *HTTPServer) Event(e agent.Event) {
+	if stream := s.stream(e.SessionID); stream != nil {
+		stream.publish(sseEvent{name: string(e.Type), data: e})
+	}
+}
+
+// AskPermission implements Client by publishing the request and waiting for
+// a client to answer it
+func (s *HTTPServer) AskPermission(ctx context.Context, sessionID string, req permission.Request) (permission.Decision, error) {
+	a := &approval{
+		ID:        session.NewID(),
+		SessionID: sessionID,
+		Request:   req,
+		decision:  make(chan permission.Decision, 1),
+	}
+	stream := s.stream(sessionID)
+	if stream == nil {
+		return permission.Deny, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+	stream.mu.Lock()
+	stream.approvals[a.ID] = a
+	stream.mu.Unlock()
+	stream.publish(sseEvent{name: sseApproval, data: a})
+
+	select {
+	case decision := <-a.decision:
+		return decision, nil
+	case <-ctx.Done():
+		stream.mu.Lock()
+		delete(stream.approvals, a.ID)
+		stream.mu.Unlock()
+		return permission.Deny, ctx.Err()
+	}
+}
+
+// stream returns the session's event stream, creating it on first use, or
+// nil once the session is closed. The session is looked up while s.mu is
+// held, so handleClose cannot remove the stream before it is created.
+func (s *HTTPServer) stream(id string) *sessionStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream, ok := s.streams[id]
+	if !ok {
+		if _, err := s.manager.Get(id); err != nil {
+			return nil
+		}
+		stream = &sessionStream{
+			subscribers: map[chan sseEvent]bool{},
+			approvals:   map[string]*approval{},
+		}
+		s.streams[id] = stream
+	}
+	return stream
+}
+
+// session looks up the session named in the path, writing a 404 if there is none
+func (s *HTTPServer) session(w http.ResponseWriter, r *http.Request) (*Session, bool) {
+	sess, err := s.manager.Get(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	return sess, true
+}
+
+// statusFor maps session errors to HTTP statuses, using fallback for others
+func statusFor(err error, fallback int) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrBusy):
+		return http.StatusConflict
+	}
+	return fallback
+}
+
+// readJSON decodes an optional JSON request body, writing a 400 if it is invalid
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error as a JSON response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeEvent writes one Server-Sent Event
+func writeEvent(w http.ResponseWriter, e sseEvent) {
+	data, err := json.Marshal(e.data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, data)
+}
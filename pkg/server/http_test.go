@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+// startHTTP serves a manager of fake sessions over HTTP
+func startHTTP(t *testing.T) (*HTTPServer, *httptest.Server) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := NewManager(fakeFactory(t), nil)
+	httpServer := NewHTTPServer(ctx, manager, testToken)
+	srv := httptest.NewServer(httpServer.Handler())
+	t.Cleanup(func() {
+		cancel()
+		srv.Close()
+		httpServer.Wait()
+		manager.CloseAll()
+	})
+	return httpServer, srv
+}
+
+// call makes an API request with the bearer token, decoding a JSON answer into v if it is not nil
+func call(t *testing.T, srv *httptest.Server, method, path, body string, v interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// eventStream reads a session's Server-Sent Events
+type eventStream struct {
+	events chan sseMessage
+}
+
+// sseMessage is one received event
+type sseMessage struct {
+	name string
+	data string
+}
+
+// subscribe connects to a session's event stream; it is registered once this returns
+func subscribe(t *testing.T, srv *httptest.Server, sessionID string) *eventStream {
+	t.Helper()
+	req, err := http.NewRequest("GET", srv.URL+"/sessions/"+sessionID+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET events: status %d", resp.StatusCode)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	st := &eventStream{events: make(chan sseMessage, 100)}
+	go func() {
+		defer close(st.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var msg sseMessage
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				msg.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && msg.name != "":
+				st.events <- msg
+				msg = sseMessage{}
+			}
+		}
+	}()
+	return st
+}
+
+// next returns the next event with one of names, skipping others
+func (st *eventStream) next(t *testing.T, names ...string) sseMessage {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg, ok := <-st.events:
+			if !ok {
+				t.Fatalf("event stream ended waiting for %v", names)
+			}
+			for _, name := range names {
+				if msg.name == name {
+					return msg
+				}
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %v", names)
+		}
+	}
+}
+
+func TestHTTPBearerToken(t *testing.T) {
+	_, srv := startHTTP(t)
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "missing", header: "", want: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "not bearer", header: "Basic " + testToken, want: http.StatusUnauthorized},
+		{name: "right token", header: "Bearer " + testToken, want: http.StatusOK},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", srv.URL+"/sessions", nil)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("%s: status %d, want %d", test.name, resp.StatusCode, test.want)
+		}
+		if test.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: no WWW-Authenticate challenge", test.name)
+		}
+	}
+}
+
+func TestHTTPApprovalFromAnotherClient(t *testing.T) {
+	_, srv := startHTTP(t)
+	var created sessionInfo
+	if status := call(t, srv, "POST", "/sessions", "", &created); status != http.StatusCreated {
+		t.Fatalf("POST /sessions: status %d", status)
+	}
+	first := subscribe(t, srv, created.SessionID)
+	second := subscribe(t, srv, created.SessionID)
+
+	if status := call(t, srv, "POST", "/sessions/"+created.SessionID+"/messages", `{"text": "write a note"}`, nil); status != http.StatusAccepted {
+		t.Fatalf("POST messages: status %d", status)
+	}
+	if status := call(t, srv, "POST", "/sessions/"+created.SessionID+"/messages", `{"text": "again"}`, nil); status != http.StatusConflict {
+		t.Errorf("sending while busy: status %d, want %d", status, http.StatusConflict)
+	}
+
+	// Both subscribers see the request; a client connecting late is sent it too
+	var asked approval
+	for _, st := range []*eventStream{first, second} {
+		msg := st.next(t, sseApproval)
+		if err := json.Unmarshal([]byte(msg.data), &asked); err != nil || asked.Tool != "write_note" {
+			t.Fatalf("approval %s: %v", msg.data, err)
+		}
+	}
+	late := subscribe(t, srv, created.SessionID)
+	if msg := late.next(t, sseApproval); !strings.Contains(msg.data, asked.ID) {
+		t.Errorf("late subscriber got %s, want approval %s", msg.data, asked.ID)
+	}
+
+	if status := call(t, srv, "POST", "/sessions/"+created.SessionID+"/approvals/"+asked.ID, `{"decision": "allow"}`, nil); status != http.StatusNoContent {
+		t.Fatalf("approving: status %d", status)
+	}
+	if status := call(t, srv, "POST", "/sessions/"+created.SessionID+"/approvals/"+asked.ID, `{"decision": "allow"}`, nil); status != http.StatusNotFound {
+		t.Errorf("approving twice: status %d, want %d", status, http.StatusNotFound)
+	}
+
+	for _, st := range []*eventStream{first, second, late} {
+		st.next(t, sseApprovalResolved)
+		if msg := st.next(t, "tool_finished"); !strings.Contains(msg.data, `"output":"noted"`) {
+			t.Errorf("tool_finished %s, want the note written", msg.data)
+		}
+		st.next(t, "turn_ended")
+	}
+
+	// Closing the session ends its streams
+	if status := call(t, srv, "DELETE", "/sessions/"+created.SessionID, "", nil); status != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d", status)
+	}
+	for range first.events {
+	}
+	if status := call(t, srv, "GET", "/sessions/"+created.SessionID+"/events", "", nil); status != http.StatusNotFound {
+		t.Errorf("events of a closed session: status %d, want %d", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/session"
+)
+
+var (
+	// ErrNotFound is returned for a session the server does not know
+	ErrNotFound = errors.New("session not found")
+	// ErrBusy is returned when a message is sent while the session is still answering another
+	ErrBusy = errors.New("session is busy with another message")
+)
+
+// SessionOptions configure a new session. Empty fields use the server's defaults.
+type SessionOptions struct {
+	WorkspaceRoot  string `json:"workspace_root,omitempty"`
+	Model          string `json:"model,omitempty"`
+	PermissionMode string `json:"permission_mode,omitempty"`
+}
+
+// Factory creates the agent for the session id, asking asker to approve tool calls
+type Factory func(id string, opts SessionOptions, asker permission.Asker) (*agent.Agent, error)
+
+// Client is whoever drives a session: it receives the session's events and
+// answers its permission requests
+type Client interface {
+	Event(e agent.Event)
+	AskPermission(ctx context.Context, sessionID string, req permission.Request) (permission.Decision, error)
+}
+
+// Session is an agent a client talks to
+type Session struct {
+	ID    string
+	Agent *agent.Agent
+
+	mu   sync.Mutex
+	busy bool
+}
+
+// Send runs a user message through the agent, one message at a time
+func (s *Session) Send(ctx context.Context, text string) (*agent.Result, error) {
+	if err := s.begin(); err != nil {
+		return nil, err
+	}
+	defer s.end()
+	return s.Agent.Prompt(ctx, text)
+}
+
+// SendAsync starts running a user message in the background, calling done
+// with the outcome. It fails at once if the session is busy.
+func (s *Session) SendAsync(ctx context.Context, text string, done func(*agent.Result, error)) error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+	go func() {
+		defer s.end()
+		result, err := s.Agent.Prompt(ctx, text)
+		if done != nil {
+			done(result, err)
+		}
+	}()
+	return nil
+}
+
+// Busy reports whether the session is answering a message
+func (s *Session) Busy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.busy
+}
+
+// begin marks the session busy, failing if it already is
+func (s *Session) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy {
+		return ErrBusy
+	}
+	s.busy = true
+	return nil
+}
+
+// end marks the session idle again
+func (s *Session) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy = false
+}
+
+// sessionAsker forwards a session's permission requests to its client
+type sessionAsker struct {
+	id     string
+	client Client
+}
+
+// AskPermission implements permission.Asker
+func (a sessionAsker) AskPermission(ctx context.Context, req permission.Request) (permission.Decision, error) {
+	return a.client.AskPermission(ctx, a.id, req)
+}
+
+// Manager keeps the sessions a server is running
+type Manager struct {
+	factory Factory
+	store   *session.Store
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewManager creates a manager building agents with factory. Sessions are
+// resumed from store, which may be nil if resuming is not supported.
+func NewManager(factory Factory, store *session.Store) *Manager {
+	return &Manager{
+		factory:  factory,
+		store:    store,
+		sessions: map[string]*Session{},
+	}
+}
+
+// Start creates a new session driven by client
+func (m *Manager) Start(opts SessionOptions, client Client) (*Session, error) {
+	id := session.NewID()
+	a, err := m.factory(id, opts, sessionAsker{id: id, client: client})
+	if err != nil {
+		return nil, err
+	}
+	a.Subscribe(client.Event)
+	return m.add(&Session{ID: id, Agent: a}), nil
+}
+
+// Resume continues a saved session, driven by client. A session that is
+// already running is returned as it is.
+func (m *Manager) Resume(id string, opts SessionOptions, client Client) (*Session, error) {
+	if sess, err := m.Get(id); err == nil {
+		return sess, nil
+	}
+	if m.store == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	saved, err := m.store.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, err.Error())
+	}
+	if opts.WorkspaceRoot == "" {
+		opts.WorkspaceRoot = saved.WorkspaceRoot
+	}
+	if opts.Model == "" {
+		opts.Model = saved.Model
+	}
+
+	a, err := m.factory(saved.ID, opts, sessionAsker{id: saved.ID, client: client})
+	if err != nil {
+		return nil, err
+	}
+	a.Resume(saved)
+	a.Subscribe(client.Event)
+	return m.add(&Session{ID: saved.ID, Agent: a}), nil
+}
+
+// add registers a session
+func (m *Manager) add(sess *Session) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sess.ID] = sess
+	return sess
+}
+
+// Get returns a running session
+func (m *Manager) Get(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return sess, nil
+}
+
+// List returns the running sessions, ordered by id
+func (m *Manager) List() []*Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// Close interrupts a session and forgets it; it can be resumed later
+func (m *Manager) Close(id string) error {
+	m.mu.Lock()
+	sess, ok := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	sess.Agent.Interrupt()
+	defer sess.Agent.Close()
+	return sess.Agent.SaveSession()
+}
+
+// CloseAll closes every session, e.g. once the server has stopped
+func (m *Manager) CloseAll() {
+	for _, sess := range m.List() {
+		m.Close(sess.ID)
+	}
+}
+
+// InterruptAll interrupts every running turn, e.g. when the server shuts down
+func (m *Manager) InterruptAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sess := range m.sessions {
+		sess.Agent.Interrupt()
+	}
+}
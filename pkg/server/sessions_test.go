@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// fakeAPI streams canned Messages API responses: a prompt mentioning "note"
+// gets a write_note tool call, and everything else, including the tool's
+// result, gets a text answer
+func fakeAPI(t *testing.T) *anthropic.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		send := func(event, data string) { fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data) }
+
+		send("message_start", `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"usage":{"input_tokens":10,"output_tokens":0}}}`)
+		stopReason := "end_turn"
+		if strings.Contains(string(body), "note") && !strings.Contains(string(body), "tool_result") {
+			stopReason = "tool_use"
+			send("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"write_note","input":{}}}`)
+			send("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"text\": \"hi\"}"}}`)
+		} else {
+			send("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`)
+			send("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"done"}}`)
+		}
+		send("content_block_stop", `{"type":"content_block_stop","index":0}`)
+		send("message_delta", fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":%q},"usage":{"output_tokens":5}}`, stopReason))
+		send("message_stop", `{"type":"message_stop"}`)
+	}))
+	t.Cleanup(srv.Close)
+	client := anthropic.NewClient(option.WithBaseURL(srv.URL), option.WithAPIKey("test"), option.WithMaxRetries(0))
+	return &client
+}
+
+// fakeFactory builds agents talking to the fake API, with a write_note tool
+// that needs approval
+func fakeFactory(t *testing.T) Factory {
+	client := fakeAPI(t)
+	noteTool := tools.ToolDefinition{
+		Name:        "write_note",
+		Description: "Write a note",
+		Function: func(ctx context.Context, env *tools.Env, input json.RawMessage) (string, error) {
+			return "noted", nil
+		},
+	}
+	return func(id string, opts SessionOptions, asker permission.Asker) (*agent.Agent, error) {
+		policy, err := permission.NewPolicy(permission.ModeAsk, nil, nil, asker)
+		if err != nil {
+			return nil, err
+		}
+		env := &tools.Env{WorkspaceRoot: t.TempDir(), SessionID: id, Permissions: policy}
+		return agent.NewAgent(client, nil, []tools.ToolDefinition{noteTool}, env, nil), nil
+	}
+}
+
+// recordingClient collects the events of the sessions it drives and allows
+// every tool call
+type recordingClient struct {
+	mu     sync.Mutex
+	events []agent.Event
+}
+
+// Event implements Client
+func (c *recordingClient) Event(e agent.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+// AskPermission implements Client
+func (c *recordingClient) AskPermission(ctx context.Context, sessionID string, req permission.Request) (permission.Decision, error) {
+	return permission.Allow, nil
+}
+
+func TestManagerConcurrentSessions(t *testing.T) {
+	manager := NewManager(fakeFactory(t), nil)
+	client := &recordingClient{}
+
+	const sessions = 8
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sess, err := manager.Start(SessionOptions{}, client)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			result, err := sess.Send(context.Background(), "write a note")
+			if err != nil || result.Text != "done" {
+				t.Errorf("Send = %+v, %v, want done", result, err)
+			}
+			manager.List()
+			if err := manager.Close(sess.ID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if left := manager.List(); len(left) != 0 {
+		t.Errorf("%d sessions left after closing them all", len(left))
+	}
+	if err := manager.Close("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("closing a missing session: got %v, want ErrNotFound", err)
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	noted, ended := 0, 0
+	for _, e := range client.events {
+		switch {
+		case e.Type == agent.EventToolFinished && e.Output == "noted":
+			noted++
+		case e.Type == agent.EventTurnEnded:
+			ended++
+		}
+	}
+	if noted != sessions || ended != sessions {
+		t.Errorf("%d notes written and %d turns ended, want %d of each", noted, ended, sessions)
+	}
+}
+
+func TestSessionBusy(t *testing.T) {
+	sess := &Session{ID: "s1"}
+	if err := sess.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.SendAsync(context.Background(), "hello", nil); !errors.Is(err, ErrBusy) {
+		t.Errorf("sending while busy: got %v, want ErrBusy", err)
+	}
+	sess.end()
+	if sess.Busy() {
+		t.Error("session still busy after its turn ended")
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/jsonrpc"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+)
+
+// codeSessionError is returned for requests about a missing or busy session
+const codeSessionError = -32000
+
+// Methods a client can call
+const (
+	MethodStart  = "session/start"
+	MethodResume = "session/resume"
+	MethodSend   = "session/send"
+	MethodCancel = "session/cancel"
+	MethodClose  = "session/close"
+)
+
+// Methods the server calls on the client
+const (
+	// MethodEvent notifies the client of an agent event
+	MethodEvent = "session/event"
+	// MethodPermission asks the client to approve a tool call
+	MethodPermission = "permission/request"
+)
+
+// sessionParams name the session a request is about
+type sessionParams struct {
+	SessionID string `json:"session_id"`
+}
+
+// resumeParams are the parameters of session/resume
+type resumeParams struct {
+	SessionID string `json:"session_id"`
+	SessionOptions
+}
+
+// sendParams are the parameters of session/send
+type sendParams struct {
+	SessionID string `json:"session_id"`
+	Text      string `json:"text"`
+}
+
+// sessionResult is returned when a session is started or resumed
+type sessionResult struct {
+	SessionID string `json:"session_id"`
+}
+
+// SendResult is the outcome of a message sent to a session
+type SendResult struct {
+	*agent.Result
+	IsError bool   `json:"is_error"`
+	Error   string `json:"error,omitempty"`
+}
+
+// permissionParams are sent with a permission request
+type permissionParams struct {
+	SessionID string `json:"session_id"`
+	permission.Request
+}
+
+// permissionResult is the client's answer to a permission request
+type permissionResult struct {
+	Decision string `json:"decision"`
+}
+
+// ServeStdio speaks JSON-RPC 2.0 on r and w, one message per line, until r
+// ends. Agent events are sent as session/event notifications and tool calls
+// needing approval as permission/request calls to the client.
+func ServeStdio(ctx context.Context, manager *Manager, r io.Reader, w io.Writer) error {
+	s := &stdioServer{manager: manager, conn: jsonrpc.NewConn(r, w)}
+	defer manager.CloseAll()
+	return s.conn.Serve(ctx, s.handle)
+}
+
+// stdioServer is the client a JSON-RPC connection drives sessions as
+type stdioServer struct {
+	manager *Manager
+	conn    *jsonrpc.Conn
+}
+
+// handle answers one request
+func (s *stdioServer) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case MethodStart:
+		var p SessionOptions
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		sess, err := s.manager.Start(p, s)
+		if err != nil {
+			return nil, err
+		}
+		return sessionResult{SessionID: sess.ID}, nil
+
+	case MethodResume:
+		var p resumeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		sess, err := s.manager.Resume(p.SessionID, p.SessionOptions, s)
+		if err != nil {
+			return nil, sessionError(err)
+		}
+		return sessionResult{SessionID: sess.ID}, nil
+
+	case MethodSend:
+		var p sendParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		sess, err := s.manager.Get(p.SessionID)
+		if err != nil {
+			return nil, sessionError(err)
+		}
+		result, err := sess.Send(ctx, p.Text)
+		if errors.Is(err, ErrBusy) {
+			return nil, sessionError(err)
+		}
+		return newSendResult(result, err), nil
+
+	case MethodCancel:
+		var p sessionParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		sess, err := s.manager.Get(p.SessionID)
+		if err != nil {
+			return nil, sessionError(err)
+		}
+		return map[string]bool{"cancelled": sess.Agent.Interrupt()}, nil
+
+	case MethodClose:
+		var p sessionParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := s.manager.Close(p.SessionID); err != nil {
+			return nil, sessionError(err)
+		}
+		return nil, nil
+	}
+	return nil, &jsonrpc.Error{Code: jsonrpc.CodeMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+}
+
+// Event implements Client
+func (s *stdioServer) Event(e agent.Event) {
+	s.conn.Notify(MethodEvent, e)
+}
+
+// AskPermission implements Client
+func (s *stdioServer) AskPermission(ctx context.Context, sessionID string, req permission.Request) (permission.Decision, error) {
+	var answer permissionResult
+	if err := s.conn.Call(ctx, MethodPermission, permissionParams{SessionID: sessionID, Request: req}, &answer); err != nil {
+		return permission.Deny, fmt.Errorf("permission request failed: %w", err)
+	}
+	return permission.ParseDecision(answer.Decision)
+}
+
+// newSendResult reports the outcome of a turn, including turns that failed
+func newSendResult(result *agent.Result, err error) SendResult {
+	out := SendResult{Result: result}
+	if err != nil {
+		out.IsError = true
+		out.Error = err.Error()
+	}
+	return out
+}
+
+// decodeParams unmarshals request parameters
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// sessionError turns a session lookup failure into a JSON-RPC error
+func sessionError(err error) error {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrBusy) {
+		return &jsonrpc.Error{Code: codeSessionError, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/jsonrpc"
+)
+
+func TestStdioRoundTrip(t *testing.T) {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	manager := NewManager(fakeFactory(t), nil)
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeStdio(context.Background(), manager, serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	// The client approves tool calls and records the events it is notified of
+	var mu sync.Mutex
+	var events []agent.Event
+	var asked []permissionParams
+	handleClient := func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch method {
+		case MethodEvent:
+			var e agent.Event
+			json.Unmarshal(params, &e)
+			events = append(events, e)
+			return nil, nil
+		case MethodPermission:
+			var p permissionParams
+			json.Unmarshal(params, &p)
+			asked = append(asked, p)
+			return permissionResult{Decision: "allow"}, nil
+		}
+		return nil, errors.New("unexpected method " + method)
+	}
+	client := jsonrpc.NewConn(clientIn, clientOut)
+	clientDone := make(chan error, 1)
+	go func() { clientDone <- client.Serve(context.Background(), handleClient) }()
+
+	ctx := context.Background()
+	var started sessionResult
+	if err := client.Call(ctx, MethodStart, SessionOptions{}, &started); err != nil || started.SessionID == "" {
+		t.Fatalf("%s = %+v, %v", MethodStart, started, err)
+	}
+	var sent SendResult
+	if err := client.Call(ctx, MethodSend, sendParams{SessionID: started.SessionID, Text: "write a note"}, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.IsError || sent.Result == nil || sent.Text != "done" || sent.StopReason != agent.StopEndTurn {
+		t.Errorf("%s = %+v, want done", MethodSend, sent)
+	}
+
+	var rpcErr *jsonrpc.Error
+	err := client.Call(ctx, MethodSend, sendParams{SessionID: "missing", Text: "hi"}, &sent)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != codeSessionError {
+		t.Errorf("sending to a missing session: got %v, want a session error", err)
+	}
+	err = client.Call(ctx, "session/unknown", nil, &sent)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc.CodeMethodNotFound {
+		t.Errorf("unknown method: got %v, want method not found", err)
+	}
+
+	// A notification gets no response; the close after it is answered in turn
+	if err := client.Notify(MethodCancel, sessionParams{SessionID: started.SessionID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(ctx, MethodClose, sessionParams{SessionID: started.SessionID}, &struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	clientOut.Close()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-clientDone; err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(asked) != 1 || asked[0].SessionID != started.SessionID || asked[0].Tool != "write_note" {
+		t.Errorf("permission requests %+v, want one for write_note", asked)
+	}
+	var types []agent.EventType
+	for _, e := range events {
+		if e.SessionID != started.SessionID {
+			t.Errorf("event %+v of another session", e)
+		}
+		types = append(types, e.Type)
+	}
+	if len(types) == 0 || types[0] != agent.EventTurnStarted || types[len(types)-1] != agent.EventTurnEnded {
+		t.Errorf("events %v, want a whole turn", types)
+	}
+}
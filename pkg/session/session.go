@@ -0,0 +1,227 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/ttli3/terminal-coding-agent/pkg/plan"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+)
+
+// Session is a conversation persisted between runs of the agent
+type Session struct {
+	ID            string      `json:"id"`
+	WorkspaceRoot string      `json:"workspace_root"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	Model         string      `json:"model,omitempty"`
+	Usage         usage.Usage `json:"usage"`
+	Cost          float64     `json:"cost"`
+	Messages      []Message   `json:"messages"`
+	// Plan is the plan the user approved, with its progress
+	Plan *plan.Plan `json:"plan,omitempty"`
+	// Todos is the todo list Claude kept
+	Todos []tools.TodoItem `json:"todos,omitempty"`
+}
+
+// Message is the stored form of a conversation message
+type Message struct {
+	Role    string  `json:"role"`
+	Content []Block `json:"content"`
+}
+
+// Block is the stored form of a single content block
+type Block struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// Store reads and writes sessions as JSON files in a directory
+type Store struct {
+	Dir string
+}
+
+// DefaultDir returns the directory sessions are stored in by default
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".coding-agent", "sessions"), nil
+}
+
+// NewStore creates a store rooted at dir
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// path returns the file a session is stored in
+func (s *Store) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+// Save writes the session to disk, replacing any previous copy
+func (s *Store) Save(sess *Session) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted save never truncates the
+	// session. Transcripts hold file contents and command output, so only the
+	// user may read them.
+	tmp := s.path(sess.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return os.Rename(tmp, s.path(sess.ID))
+}
+
+// Load reads a session from disk
+func (s *Store) Load(id string) (*Session, error) {
+	if !ValidID(id) {
+		return nil, fmt.Errorf("invalid session id %q", id)
+	}
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", id, err)
+	}
+	return &sess, nil
+}
+
+// List loads every session in the store, most recently updated first
+func (s *Store) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		sess, err := s.Load(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+// FromParams converts API message params into their stored form
+func FromParams(params []anthropic.MessageParam) []Message {
+	messages := make([]Message, 0, len(params))
+	for _, param := range params {
+		msg := Message{Role: string(param.Role)}
+		for _, block := range param.Content {
+			switch {
+			case block.OfRequestTextBlock != nil:
+				msg.Content = append(msg.Content, Block{Type: "text", Text: block.OfRequestTextBlock.Text})
+			case block.OfRequestToolUseBlock != nil:
+				input, err := json.Marshal(block.OfRequestToolUseBlock.Input)
+				if err != nil {
+					input = json.RawMessage("{}")
+				}
+				msg.Content = append(msg.Content, Block{
+					Type:  "tool_use",
+					ID:    block.OfRequestToolUseBlock.ID,
+					Name:  block.OfRequestToolUseBlock.Name,
+					Input: input,
+				})
+			case block.OfRequestToolResultBlock != nil:
+				result := block.OfRequestToolResultBlock
+				var text string
+				for _, c := range result.Content {
+					if c.OfRequestTextBlock != nil {
+						text += c.OfRequestTextBlock.Text
+					}
+				}
+				msg.Content = append(msg.Content, Block{
+					Type:      "tool_result",
+					ToolUseID: result.ToolUseID,
+					Text:      text,
+					IsError:   result.IsError.Value,
+				})
+			}
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// ToParams converts stored messages back into API message params
+func ToParams(messages []Message) []anthropic.MessageParam {
+	params := make([]anthropic.MessageParam, 0, len(messages))
+	for _, msg := range messages {
+		var blocks []anthropic.ContentBlockParamUnion
+		for _, block := range msg.Content {
+			switch block.Type {
+			case "text":
+				blocks = append(blocks, anthropic.NewTextBlock(block.Text))
+			case "tool_use":
+				blocks = append(blocks, anthropic.ContentBlockParamUnion{
+					OfRequestToolUseBlock: &anthropic.ToolUseBlockParam{
+						ID:    block.ID,
+						Name:  block.Name,
+						Input: block.Input,
+					},
+				})
+			case "tool_result":
+				blocks = append(blocks, anthropic.NewToolResultBlock(block.ToolUseID, block.Text, block.IsError))
+			}
+		}
+		params = append(params, anthropic.MessageParam{
+			Role:    anthropic.MessageParamRole(msg.Role),
+			Content: blocks,
+		})
+	}
+	return params
+}
+
+// ValidID reports whether id can name a session file, so ids from clients
+// cannot reach outside the store
+func ValidID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+// NewID returns a random session identifier
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
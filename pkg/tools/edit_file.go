@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -28,109 +29,156 @@ type EditFileInput struct {
 
 var EditFileInputSchema = GenerateSchema[EditFileInput]()
 
-func EditFile(input json.RawMessage) (string, error) {
+// EditPreview is the change an edit_file call would make
+type EditPreview struct {
+	Input EditFileInput
+	// Path is the resolved path of the file
+	Path   string
+	Before string
+	After  string
+	// Created is true when the file does not exist yet
+	Created bool
+}
+
+// PreviewEdit works out the change an edit_file call would make, without making it
+func PreviewEdit(env *Env, input json.RawMessage) (*EditPreview, error) {
 	editFileInput := EditFileInput{}
 	err := json.Unmarshal(input, &editFileInput)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if editFileInput.Path == "" || editFileInput.OldStr == editFileInput.NewStr {
-		return "", fmt.Errorf("invalid input parameters")
+		return nil, fmt.Errorf("invalid input parameters")
 	}
 
-	content, err := os.ReadFile(editFileInput.Path)
+	path, err := env.ResolvePath(editFileInput.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) && editFileInput.OldStr == "" {
 			// This is a new file creation case
-			dir := filepath.Dir(editFileInput.Path)
-			if dir != "." {
-				err := os.MkdirAll(dir, 0755)
-				if err != nil {
-					return "", fmt.Errorf("failed to create directory: %w", err)
-				}
-			}
-
-			// Generate a diff for the new file (empty -> content)
-			var diffResult strings.Builder
-			diffResult.WriteString("Creating new file with content:\n")
-			
-			// Split the content into lines and format as additions
-			lines := strings.Split(editFileInput.NewStr, "\n")
-			for _, line := range lines {
-				if line == "" {
-					diffResult.WriteString("\u001b[32m+\u001b[0m\n")
-					continue
-				}
-				diffResult.WriteString(fmt.Sprintf("\u001b[32m+ %s\u001b[0m\n", line))
-			}
-
-			err := os.WriteFile(editFileInput.Path, []byte(editFileInput.NewStr), 0644)
-			if err != nil {
-				return "", fmt.Errorf("failed to create file: %w", err)
-			}
-
-			return fmt.Sprintf("Successfully created file %s\n\n%s", editFileInput.Path, diffResult.String()), nil
+			return &EditPreview{Input: editFileInput, Path: path, After: editFileInput.NewStr, Created: true}, nil
 		}
-		return "", err
+		return nil, err
 	}
 
 	oldContent := string(content)
 	newContent := strings.Replace(oldContent, editFileInput.OldStr, editFileInput.NewStr, -1)
 
 	if oldContent == newContent && editFileInput.OldStr != "" {
-		return "", fmt.Errorf("old_str not found in file")
-	}
-
-	// Generate a diff to show the changes using line-by-line comparison
-	// Split the code into lines for line-by-line comparison
-	originalLines := strings.Split(oldContent, "\n")
-	modifiedLines := strings.Split(newContent, "\n")
-	
-	// Format the diff for better readability
-	var diffResult strings.Builder
-	diffResult.WriteString("Changes to be applied:\n")
-	
-	// Use a simple line-by-line diff algorithm
-	lcs := longestCommonSubsequence(originalLines, modifiedLines)
-	
-	i, j := 0, 0
-	for k := 0; k < len(lcs); k++ {
-		// Print deletions (lines in original but not in LCS)
-		for i < lcs[k].originalIndex {
-			diffResult.WriteString(fmt.Sprintf("\u001b[31m- %s\u001b[0m\n", originalLines[i]))
-			i++
-		}
-		
-		// Print additions (lines in modified but not in LCS)
-		for j < lcs[k].modifiedIndex {
-			diffResult.WriteString(fmt.Sprintf("\u001b[32m+ %s\u001b[0m\n", modifiedLines[j]))
-			j++
-		}
-		
-		// Print unchanged lines (lines in both)
-		diffResult.WriteString(fmt.Sprintf("\u001b[90m  %s\u001b[0m\n", originalLines[i]))
-		i++
-		j++
+		return nil, fmt.Errorf("old_str not found in file")
+	}
+	return &EditPreview{Input: editFileInput, Path: path, Before: oldContent, After: newContent}, nil
+}
+
+// Diff compares the file as it is with content, line by line. A new file
+// that is empty has no lines to show.
+func (p *EditPreview) Diff(content string) []DiffLine {
+	if !p.Created {
+		return DiffLines(p.Before, content)
+	}
+	if content == "" {
+		return nil
+	}
+	var lines []DiffLine
+	for _, line := range strings.Split(content, "\n") {
+		lines = append(lines, DiffLine{Op: '+', Text: line})
 	}
-	
-	// Print any remaining deletions
-	for i < len(originalLines) {
-		diffResult.WriteString(fmt.Sprintf("\u001b[31m- %s\u001b[0m\n", originalLines[i]))
-		i++
+	return lines
+}
+
+func EditFile(ctx context.Context, env *Env, input json.RawMessage) (string, error) {
+	preview, err := PreviewEdit(env, input)
+	if err != nil {
+		return "", err
 	}
-	
-	// Print any remaining additions
-	for j < len(modifiedLines) {
-		diffResult.WriteString(fmt.Sprintf("\u001b[32m+ %s\u001b[0m\n", modifiedLines[j]))
-		j++
+	if env != nil && env.Reviewer != nil {
+		return reviewEdit(ctx, env, preview)
 	}
 
+	if preview.Created {
+		// Generate a diff for the new file (empty -> content)
+		var diffResult strings.Builder
+		diffResult.WriteString("Creating new file with content:\n")
+
+		// Split the content into lines and format as additions
+		lines := strings.Split(preview.After, "\n")
+		for _, line := range lines {
+			if line == "" {
+				diffResult.WriteString("\u001b[32m+\u001b[0m\n")
+				continue
+			}
+			diffResult.WriteString(fmt.Sprintf("\u001b[32m+ %s\u001b[0m\n", line))
+		}
+
+		if err := writeEdit(env, preview, preview.After); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Successfully created file %s\n\n%s", preview.Input.Path, diffResult.String()), nil
+	}
+
+	// Generate a diff to show the changes
+	diff := Diff(preview.Before, preview.After)
+
 	// Write the changes to the file
-	err = os.WriteFile(editFileInput.Path, []byte(newContent), 0644)
+	if err := writeEdit(env, preview, preview.After); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("File updated successfully.\n\nChanges to be applied:\n%s", diff), nil
+}
+
+// reviewEdit shows the change to the user before writing it, and reports the
+// change that was made, which the user may have cut down or edited
+func reviewEdit(ctx context.Context, env *Env, preview *EditPreview) (string, error) {
+	review, err := env.ReviewEdit(ctx, preview)
 	if err != nil {
 		return "", err
 	}
+	feedback := ""
+	if review.Feedback != "" {
+		feedback = "\n\nFeedback from the user: " + review.Feedback
+	}
+	if !review.Accepted || (!preview.Created && review.Content == preview.Before) {
+		return "", fmt.Errorf("the user rejected the change to %s, so the file was not changed%s", preview.Input.Path, feedback)
+	}
+
+	if err := writeEdit(env, preview, review.Content); err != nil {
+		return "", err
+	}
+	result := "File updated after review."
+	if preview.Created {
+		result = fmt.Sprintf("Created file %s after review.", preview.Input.Path)
+	}
+	if review.Content != preview.After {
+		result += " The user changed the proposed edit; the diff below is what was written."
+	}
+	hunks := Hunks(preview.Diff(review.Content), DiffContext)
+	return fmt.Sprintf("%s%s\n\nApplied changes:\n%s", result, feedback, UnifiedDiff(preview.Input.Path, hunks)), nil
+}
 
-	return fmt.Sprintf("File updated successfully.\n\n%s", diffResult.String()), nil
+// writeEdit writes content to the previewed file, recording it in the journal
+// first and creating its directory if needed
+func writeEdit(env *Env, preview *EditPreview, content string) error {
+	if preview.Created {
+		dir := filepath.Dir(preview.Path)
+		if dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+		}
+	}
+	if err := env.RecordChange(preview.Path); err != nil {
+		return fmt.Errorf("failed to record the file before editing: %w", err)
+	}
+	if err := os.WriteFile(preview.Path, []byte(content), 0644); err != nil {
+		if preview.Created {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		return err
+	}
+	return nil
 }
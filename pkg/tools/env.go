@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideWorkspace is returned for paths a confined environment may not touch
+var ErrOutsideWorkspace = errors.New("path is outside the workspace")
+
+// PermissionChecker decides whether a tool call may run
+type PermissionChecker interface {
+	CheckPermission(ctx context.Context, tool *ToolDefinition, input json.RawMessage) error
+}
+
+// EditReviewer shows the user a change before an edit tool writes it
+type EditReviewer interface {
+	ReviewEdit(ctx context.Context, preview *EditPreview) (*EditReview, error)
+}
+
+// EditReview is the user's verdict on a proposed change
+type EditReview struct {
+	// Accepted is false when the user rejected the change
+	Accepted bool
+	// Content is what to write, which the user may have changed from the proposal
+	Content string
+	// Feedback is what the user had to say about the change, if anything
+	Feedback string
+}
+
+// Env is the execution environment handed to every tool call
+type Env struct {
+	// WorkspaceRoot is the directory relative paths are resolved against
+	WorkspaceRoot string
+	// SessionID identifies the agent session the call belongs to
+	SessionID string
+	// Permissions is consulted before a tool runs; nil allows everything
+	Permissions PermissionChecker
+	// Logger receives diagnostic output; nil discards it
+	Logger *log.Logger
+	// Output receives progress from long-running tools while they run
+	Output io.Writer
+	// Confined rejects paths that resolve outside the workspace root,
+	// following symlinks
+	Confined bool
+	// Journal records files before tools change them; nil records nothing
+	Journal *Journal
+	// Reviewer is shown file edits before they are written; nil writes them as proposed
+	Reviewer EditReviewer
+	// Todos is the checklist the todo tool keeps; nil keeps none
+	Todos *TodoList
+}
+
+// ResolvePath returns path resolved against the workspace root
+func (e *Env) ResolvePath(path string) (string, error) {
+	if e == nil || e.WorkspaceRoot == "" {
+		return path, nil
+	}
+	resolved := path
+	if !filepath.IsAbs(path) {
+		resolved = filepath.Join(e.WorkspaceRoot, path)
+	}
+	if e.Confined && !e.inWorkspace(resolved) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideWorkspace, path)
+	}
+	return resolved, nil
+}
+
+// inWorkspace reports whether path, with symlinks followed, is inside the workspace root
+func (e *Env) inWorkspace(path string) bool {
+	root, err := filepath.EvalSymlinks(e.WorkspaceRoot)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, evalExisting(filepath.Clean(path)))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// evalExisting follows the symlinks in the longest existing prefix of path,
+// so files that are about to be created are checked by their parent
+func evalExisting(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(evalExisting(parent), filepath.Base(path))
+}
+
+// RecordChange saves the state of the file at path in the journal, if any,
+// before a tool changes it
+func (e *Env) RecordChange(path string) error {
+	if e == nil || e.Journal == nil {
+		return nil
+	}
+	return e.Journal.Record(path)
+}
+
+// ReviewEdit asks the reviewer, if any, whether and how to make a change
+func (e *Env) ReviewEdit(ctx context.Context, preview *EditPreview) (*EditReview, error) {
+	if e == nil || e.Reviewer == nil {
+		return &EditReview{Accepted: true, Content: preview.After}, nil
+	}
+	return e.Reviewer.ReviewEdit(ctx, preview)
+}
+
+// CheckPermission asks the permission checker whether the tool call may run
+func (e *Env) CheckPermission(ctx context.Context, tool *ToolDefinition, input json.RawMessage) error {
+	if e == nil || e.Permissions == nil {
+		return nil
+	}
+	return e.Permissions.CheckPermission(ctx, tool, input)
+}
+
+// Logf writes a diagnostic message to the logger, if any
+func (e *Env) Logf(format string, args ...interface{}) {
+	if e == nil || e.Logger == nil {
+		return
+	}
+	e.Logger.Printf(format, args...)
+}
+
+// Progress writes a progress message to the output sink, if any
+func (e *Env) Progress(format string, args ...interface{}) {
+	if e == nil || e.Output == nil {
+		return
+	}
+	fmt.Fprintf(e.Output, format, args...)
+}
+
+// ProgressWriter returns a writer for streaming progress, never nil
+func (e *Env) ProgressWriter() io.Writer {
+	if e == nil || e.Output == nil {
+		return io.Discard
+	}
+	return e.Output
+}
+
+// WithOutput returns a copy of the environment writing progress to w
+func (e *Env) WithOutput(w io.Writer) *Env {
+	c := Env{}
+	if e != nil {
+		c = *e
+	}
+	c.Output = w
+	return &c
+}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -15,6 +16,7 @@ It will highlight additions, deletions, and unchanged lines.
 `,
 	InputSchema: GenerateDiffInputSchema,
 	Function:    GenerateDiff,
+	ReadOnly:    true,
 }
 
 type GenerateDiffInput struct {
@@ -24,7 +26,7 @@ type GenerateDiffInput struct {
 
 var GenerateDiffInputSchema = GenerateSchema[GenerateDiffInput]()
 
-func GenerateDiff(input json.RawMessage) (string, error) {
+func GenerateDiff(ctx context.Context, env *Env, input json.RawMessage) (string, error) {
 	generateDiffInput := GenerateDiffInput{}
 	err := json.Unmarshal(input, &generateDiffInput)
 	if err != nil {
@@ -35,48 +37,57 @@ func GenerateDiff(input json.RawMessage) (string, error) {
 		return "No differences found. The original and modified code are identical.", nil
 	}
 
-	// Split the code into lines for line-by-line comparison
-	originalLines := strings.Split(generateDiffInput.OriginalCode, "\n")
-	modifiedLines := strings.Split(generateDiffInput.ModifiedCode, "\n")
-	
-	// Format the diff for better readability
-	var diffResult strings.Builder
-	diffResult.WriteString("Diff:\n")
-	
-	// Use a simple line-by-line diff algorithm
+	return "Diff:\n" + Diff(generateDiffInput.OriginalCode, generateDiffInput.ModifiedCode), nil
+}
+
+// DiffLine is one line of a line-by-line diff
+type DiffLine struct {
+	// Op is '=' for an unchanged line, '-' for a removed one and '+' for an added one
+	Op   byte
+	Text string
+}
+
+// DiffLines compares two versions of a text line by line, listing removed
+// lines before the lines added in their place
+func DiffLines(original, modified string) []DiffLine {
+	originalLines := strings.Split(original, "\n")
+	modifiedLines := strings.Split(modified, "\n")
 	lcs := longestCommonSubsequence(originalLines, modifiedLines)
-	
+
+	var lines []DiffLine
 	i, j := 0, 0
 	for k := 0; k < len(lcs); k++ {
-		// Print deletions (lines in original but not in LCS)
-		for i < lcs[k].originalIndex {
-			diffResult.WriteString(fmt.Sprintf("\u001b[31m- %s\u001b[0m\n", originalLines[i]))
-			i++
+		for ; i < lcs[k].originalIndex; i++ {
+			lines = append(lines, DiffLine{Op: '-', Text: originalLines[i]})
 		}
-		
-		// Print additions (lines in modified but not in LCS)
-		for j < lcs[k].modifiedIndex {
-			diffResult.WriteString(fmt.Sprintf("\u001b[32m+ %s\u001b[0m\n", modifiedLines[j]))
-			j++
+		for ; j < lcs[k].modifiedIndex; j++ {
+			lines = append(lines, DiffLine{Op: '+', Text: modifiedLines[j]})
 		}
-		
-		// Print unchanged lines (lines in both)
-		diffResult.WriteString(fmt.Sprintf("\u001b[90m  %s\u001b[0m\n", originalLines[i]))
+		lines = append(lines, DiffLine{Op: '=', Text: originalLines[i]})
 		i++
 		j++
 	}
-	
-	// Print any remaining deletions
-	for i < len(originalLines) {
-		diffResult.WriteString(fmt.Sprintf("\u001b[31m- %s\u001b[0m\n", originalLines[i]))
-		i++
+	for ; i < len(originalLines); i++ {
+		lines = append(lines, DiffLine{Op: '-', Text: originalLines[i]})
 	}
-	
-	// Print any remaining additions
-	for j < len(modifiedLines) {
-		diffResult.WriteString(fmt.Sprintf("\u001b[32m+ %s\u001b[0m\n", modifiedLines[j]))
-		j++
+	for ; j < len(modifiedLines); j++ {
+		lines = append(lines, DiffLine{Op: '+', Text: modifiedLines[j]})
 	}
-	
-	return diffResult.String(), nil
+	return lines
+}
+
+// Diff renders a colored line-by-line diff of two versions of a text
+func Diff(original, modified string) string {
+	var diffResult strings.Builder
+	for _, line := range DiffLines(original, modified) {
+		switch line.Op {
+		case '-':
+			diffResult.WriteString(fmt.Sprintf("\u001b[31m- %s\u001b[0m\n", line.Text))
+		case '+':
+			diffResult.WriteString(fmt.Sprintf("\u001b[32m+ %s\u001b[0m\n", line.Text))
+		default:
+			diffResult.WriteString(fmt.Sprintf("\u001b[90m  %s\u001b[0m\n", line.Text))
+		}
+	}
+	return diffResult.String()
 }
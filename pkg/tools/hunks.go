@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffContext is how many unchanged lines a unified diff shows around each change
+const DiffContext = 3
+
+// Hunk is a group of nearby changes in a line-by-line diff, with the
+// unchanged lines around them
+type Hunk struct {
+	// OldStart and NewStart are the 1-based lines the hunk starts on in each
+	// version; a start of 0 means the version has no lines there
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []DiffLine
+
+	// first and last are the indices of the hunk's lines in the whole diff
+	first, last int
+}
+
+// Header returns the hunk's unified diff header, such as "@@ -1,4 +1,5 @@"
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// String renders the hunk in unified diff format
+func (h Hunk) String() string {
+	var b strings.Builder
+	b.WriteString(h.Header() + "\n")
+	for _, line := range h.Lines {
+		op := line.Op
+		if op == '=' {
+			op = ' '
+		}
+		b.WriteString(string(op) + line.Text + "\n")
+	}
+	return b.String()
+}
+
+// Hunks groups the changes of a diff into hunks with context unchanged lines
+// around them, keeping changes whose context would overlap in one hunk
+func Hunks(lines []DiffLine, context int) []Hunk {
+	var hunks []Hunk
+	for i := 0; i < len(lines); i++ {
+		if lines[i].Op == '=' {
+			continue
+		}
+		first := max(0, i-context)
+		last := i
+		// Extend over changes separated by at most twice the context
+		for j := i; j < len(lines) && j <= last+2*context; j++ {
+			if lines[j].Op != '=' {
+				last = j
+			}
+		}
+		last = min(len(lines)-1, last+context)
+		hunks = append(hunks, newHunk(lines, first, last))
+		i = last
+	}
+	return hunks
+}
+
+// newHunk makes the hunk of lines[first:last+1], numbering its lines
+func newHunk(lines []DiffLine, first, last int) Hunk {
+	oldLine, newLine := 1, 1
+	for _, line := range lines[:first] {
+		if line.Op != '+' {
+			oldLine++
+		}
+		if line.Op != '-' {
+			newLine++
+		}
+	}
+	h := Hunk{OldStart: oldLine, NewStart: newLine, Lines: lines[first : last+1], first: first, last: last}
+	for _, line := range h.Lines {
+		if line.Op != '+' {
+			h.OldLines++
+		}
+		if line.Op != '-' {
+			h.NewLines++
+		}
+	}
+	// Like diff, number an empty side by the line before it
+	if h.OldLines == 0 {
+		h.OldStart--
+	}
+	if h.NewLines == 0 {
+		h.NewStart--
+	}
+	return h
+}
+
+// ApplyHunks returns the modified text of a diff with only the accepted
+// hunks applied; the changes of the other hunks are left out
+func ApplyHunks(lines []DiffLine, hunks []Hunk, accepted []bool) string {
+	var out []string
+	h := 0
+	for i, line := range lines {
+		for h < len(hunks) && i > hunks[h].last {
+			h++
+		}
+		apply := h < len(hunks) && i >= hunks[h].first && accepted[h]
+		switch {
+		case line.Op == '=':
+			out = append(out, line.Text)
+		case line.Op == '-' && !apply, line.Op == '+' && apply:
+			out = append(out, line.Text)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// UnifiedDiff renders the hunks of a diff of the file name in unified diff format
+func UnifiedDiff(name string, hunks []Hunk) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", name, name)
+	for _, h := range hunks {
+		b.WriteString(h.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines "1" to "n" joined by newlines, with the given
+// lines replaced
+func numbered(n int, replace map[int]string) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprint(i + 1)
+		if text, ok := replace[i+1]; ok {
+			lines[i] = text
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestHunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		modified string
+		headers  []string
+	}{
+		{name: "no changes", original: numbered(5, nil), modified: numbered(5, nil)},
+		{name: "one change in the middle", original: numbered(20, nil), modified: numbered(20, map[int]string{10: "ten"}),
+			headers: []string{"@@ -7,7 +7,7 @@"}},
+		{name: "change at the start", original: numbered(20, nil), modified: numbered(20, map[int]string{1: "one"}),
+			headers: []string{"@@ -1,4 +1,4 @@"}},
+		{name: "change at the end", original: numbered(20, nil), modified: numbered(20, map[int]string{20: "twenty"}),
+			headers: []string{"@@ -17,4 +17,4 @@"}},
+		{name: "distant changes are separate hunks", original: numbered(30, nil), modified: numbered(30, map[int]string{5: "five", 25: "twenty-five"}),
+			headers: []string{"@@ -2,7 +2,7 @@", "@@ -22,7 +22,7 @@"}},
+		{name: "changes with overlapping context share a hunk", original: numbered(30, nil), modified: numbered(30, map[int]string{10: "ten", 16: "sixteen"}),
+			headers: []string{"@@ -7,13 +7,13 @@"}},
+		{name: "added lines", original: "a\nb", modified: "a\nb\nc\nd",
+			headers: []string{"@@ -1,2 +1,4 @@"}},
+		{name: "into an empty file", original: "", modified: "a",
+			headers: []string{"@@ -1,1 +1,1 @@"}},
+		{name: "pure insertion numbers the empty side by the line before", original: numbered(3, nil), modified: "1\n2\n3\nnew",
+			headers: []string{"@@ -1,3 +1,4 @@"}},
+	}
+	for _, test := range tests {
+		var headers []string
+		for _, h := range Hunks(DiffLines(test.original, test.modified), DiffContext) {
+			headers = append(headers, h.Header())
+		}
+		if !reflect.DeepEqual(headers, test.headers) {
+			t.Errorf("%s: hunks %q, want %q", test.name, headers, test.headers)
+		}
+	}
+}
+
+func TestHunkWithoutOldLines(t *testing.T) {
+	lines := DiffLines("a\nb\nc\nd\ne", "a\nb\nnew\nc\nd\ne")
+	hunks := Hunks(lines, 0)
+	if len(hunks) != 1 || hunks[0].Header() != "@@ -2,0 +3,1 @@" {
+		t.Fatalf("got %v, want one hunk @@ -2,0 +3,1 @@", hunks)
+	}
+	if got := hunks[0].String(); got != "@@ -2,0 +3,1 @@\n+new\n" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	original := numbered(30, nil)
+	modified := numbered(30, map[int]string{5: "five", 25: "twenty-five"})
+	lines := DiffLines(original, modified)
+	hunks := Hunks(lines, DiffContext)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(hunks))
+	}
+
+	tests := []struct {
+		name     string
+		accepted []bool
+		want     string
+	}{
+		{name: "all", accepted: []bool{true, true}, want: modified},
+		{name: "none", accepted: []bool{false, false}, want: original},
+		{name: "first only", accepted: []bool{true, false}, want: numbered(30, map[int]string{5: "five"})},
+		{name: "second only", accepted: []bool{false, true}, want: numbered(30, map[int]string{25: "twenty-five"})},
+	}
+	for _, test := range tests {
+		if got := ApplyHunks(lines, hunks, test.accepted); got != test.want {
+			t.Errorf("%s: ApplyHunks =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyHunksWithInsertionsAndDeletions(t *testing.T) {
+	original := "package main\n\nimport \"fmt\"\n\nfunc a() {}\n\n\n\n\n\n\nfunc b() {\n\tfmt.Println(1)\n}"
+	modified := "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc a() {}\n\n\n\n\n\n\nfunc b() {\n}"
+	lines := DiffLines(original, modified)
+	hunks := Hunks(lines, 1)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2:\n%s", len(hunks), UnifiedDiff("main.go", hunks))
+	}
+	want := "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc a() {}\n\n\n\n\n\n\nfunc b() {\n\tfmt.Println(1)\n}"
+	if got := ApplyHunks(lines, hunks, []bool{true, false}); got != want {
+		t.Errorf("ApplyHunks =\n%s\nwant\n%s", got, want)
+	}
+}
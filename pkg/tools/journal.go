@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNothingToUndo is returned by Undo when no change is recorded
+var ErrNothingToUndo = errors.New("no file changes to undo")
+
+// Change is the state of a file before a tool changed it
+type Change struct {
+	Path    string
+	Content []byte
+	// Existed is false for files the tool created
+	Existed bool
+	Time    time.Time
+}
+
+// Journal records files before tools change them, so the changes can be
+// reviewed and undone
+type Journal struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+// Record saves the current state of the file at path, which must be absolute
+func (j *Journal) Record(path string) error {
+	content, err := os.ReadFile(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.changes = append(j.changes, Change{Path: path, Content: content, Existed: existed, Time: time.Now()})
+	return nil
+}
+
+// Undo restores the file of the most recent change and forgets it
+func (j *Journal) Undo() (*Change, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.changes) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	last := j.changes[len(j.changes)-1]
+
+	var err error
+	if last.Existed {
+		err = os.WriteFile(last.Path, last.Content, 0644)
+	} else {
+		err = os.Remove(last.Path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.changes = j.changes[:len(j.changes)-1]
+	return &last, nil
+}
+
+// Changes returns the recorded changes, oldest first
+func (j *Journal) Changes() []Change {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Change(nil), j.changes...)
+}
+
+// Originals returns the earliest recorded state of each changed file, in the
+// order the files were first changed
+func (j *Journal) Originals() []Change {
+	seen := map[string]bool{}
+	var originals []Change
+	for _, c := range j.Changes() {
+		if !seen[c.Path] {
+			seen[c.Path] = true
+			originals = append(originals, c)
+		}
+	}
+	return originals
+}
+
+// Clear forgets every recorded change
+func (j *Journal) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.changes = nil
+}
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -13,6 +14,7 @@ var ListFilesDefinition = ToolDefinition{
 	Description: "List files and directories at a given path. If no path is provided, lists files in the current directory.",
 	InputSchema: ListFilesInputSchema,
 	Function:    ListFiles,
+	ReadOnly:    true,
 }
 
 type ListFilesInput struct {
@@ -21,7 +23,7 @@ type ListFilesInput struct {
 
 var ListFilesInputSchema = GenerateSchema[ListFilesInput]()
 
-func ListFiles(input json.RawMessage) (string, error) {
+func ListFiles(ctx context.Context, env *Env, input json.RawMessage) (string, error) {
 	listFilesInput := ListFilesInput{}
 	err := json.Unmarshal(input, &listFilesInput)
 	if err != nil {
@@ -32,15 +34,19 @@ func ListFiles(input json.RawMessage) (string, error) {
 	if listFilesInput.Path != "" {
 		path = listFilesInput.Path
 	}
+	dir, err := env.ResolvePath(path)
+	if err != nil {
+		return "", err
+	}
 
 	// Check if the path exists
-	_, err = os.Stat(path)
+	_, err = os.Stat(dir)
 	if err != nil {
 		return "", fmt.Errorf("path does not exist: %s", path)
 	}
 
 	// List files and directories
-	entries, err := os.ReadDir(path)
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return "", err
 	}
@@ -76,7 +82,7 @@ func ListFiles(input json.RawMessage) (string, error) {
 		result.WriteString("Files:\n")
 		for _, file := range files {
 			// Get file info for size
-			info, err := os.Stat(filepath.Join(path, file))
+			info, err := os.Stat(filepath.Join(dir, file))
 			if err == nil {
 				result.WriteString(fmt.Sprintf("  %s (%d bytes)\n", file, info.Size()))
 			} else {
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 )
@@ -10,6 +11,7 @@ var ReadFileDefinition = ToolDefinition{
 	Description: "Read the contents of a given relative file path. Use this when you want to see what's inside a file. Do not use this with directory names.",
 	InputSchema: ReadFileInputSchema,
 	Function:    ReadFile,
+	ReadOnly:    true,
 }
 
 type ReadFileInput struct {
@@ -18,14 +20,18 @@ type ReadFileInput struct {
 
 var ReadFileInputSchema = GenerateSchema[ReadFileInput]()
 
-func ReadFile(input json.RawMessage) (string, error) {
+func ReadFile(ctx context.Context, env *Env, input json.RawMessage) (string, error) {
 	readFileInput := ReadFileInput{}
 	err := json.Unmarshal(input, &readFileInput)
 	if err != nil {
 		return "", err
 	}
 
-	content, err := os.ReadFile(readFileInput.Path)
+	path, err := env.ResolvePath(readFileInput.Path)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
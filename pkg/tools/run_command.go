@@ -1,12 +1,19 @@
 package tools
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"strings"
+	"time"
 )
 
+// commandWaitDelay bounds how long a cancelled command may keep its output pipes open
+const commandWaitDelay = 2 * time.Second
+
 var RunCommandDefinition = ToolDefinition{
 	Name: "run_command",
 	Description: `Execute a terminal command.
@@ -24,7 +31,7 @@ type RunCommandInput struct {
 
 var RunCommandInputSchema = GenerateSchema[RunCommandInput]()
 
-func RunCommand(input json.RawMessage) (string, error) {
+func RunCommand(ctx context.Context, env *Env, input json.RawMessage) (string, error) {
 	runCommandInput := RunCommandInput{}
 	err := json.Unmarshal(input, &runCommandInput)
 	if err != nil {
@@ -35,16 +42,30 @@ func RunCommand(input json.RawMessage) (string, error) {
 		return "", fmt.Errorf("command cannot be empty")
 	}
 
-	// Execute the command
-	cmd := exec.Command("sh", "-c", runCommandInput.Command)
-	output, err := cmd.CombinedOutput()
+	// Execute the command, streaming its output as progress while capturing it
+	var output bytes.Buffer
+	sink := io.MultiWriter(&output, env.ProgressWriter())
+	dir, err := env.ResolvePath(".")
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", runCommandInput.Command)
+	cmd.Dir = dir
+	cmd.Stdout = sink
+	cmd.Stderr = sink
+	cmd.WaitDelay = commandWaitDelay
+	env.Logf("run_command: %s", runCommandInput.Command)
+	err = cmd.Run()
 	
 	// Format the output
 	var result strings.Builder
 	result.WriteString(fmt.Sprintf("Command: %s\n\n", runCommandInput.Command))
 	result.WriteString("Output:\n")
-	result.WriteString(string(output))
+	result.WriteString(output.String())
 	
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("command cancelled: %w", ctx.Err())
+	}
 	if err != nil {
 		result.WriteString(fmt.Sprintf("\nError: %s\n", err.Error()))
 		return result.String(), nil // Return the error in the output, not as an error
@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SafeCommandDefinition is run_command limited to commands that only read,
+// offered where the agent may look but not change anything
+var SafeCommandDefinition = ToolDefinition{
+	Name: RunCommandDefinition.Name,
+	Description: `Execute a read-only terminal command.
+
+Only commands that inspect the workspace are allowed, such as ls, cat, head, tail, wc, grep, rg, find,
+tree, and git status, log, show, diff, grep, blame and branch (listing only). Commands may be joined with
+pipes, but output redirection, command substitution, ; and && are rejected.
+`,
+	InputSchema: RunCommandInputSchema,
+	Function:    SafeCommand,
+	ReadOnly:    true,
+}
+
+// safeCommands are the programs a safe command may run; a nil list allows
+// any arguments, and otherwise the first argument must be one of them
+var safeCommands = map[string][]string{
+	"ls": nil, "cat": nil, "head": nil, "tail": nil, "wc": nil, "grep": nil, "rg": nil,
+	"tree": nil, "pwd": nil, "file": nil, "stat": nil, "du": nil, "sort": nil, "uniq": nil,
+	"cut": nil, "tr": nil, "nl": nil, "diff": nil, "basename": nil, "dirname": nil, "echo": nil,
+	"find": nil,
+	"git":  {"status", "log", "show", "diff", "grep", "blame", "branch", "ls-files", "rev-parse"},
+	"go":   {"list", "doc", "version", "env"},
+}
+
+// unsafeFlags are the flags with which a safe program runs commands or writes files
+var unsafeFlags = map[string][]string{
+	"find": {"-exec", "-execdir", "-ok", "-okdir", "-delete", "-fprint", "-fprint0", "-fprintf", "-fls"},
+	"sort": {"-o", "--output", "--compress-program"},
+	"tree": {"-o", "-R"},
+	"rg":   {"--pre", "--pre-glob", "--hostname-bin"},
+	"file": {"-C", "--compile"},
+	"git":  {"--output", "--ext-diff", "-O", "--open-files-in-pager"},
+	"go":   {"-w", "-u", "-mod", "-toolexec", "-exec"},
+}
+
+// branchListFlags are the flags of git branch that only change how branches
+// are listed
+var branchListFlags = []string{
+	"-a", "--all", "-r", "--remotes", "-v", "-vv", "--verbose", "-l", "--list", "--show-current",
+	"--contains", "--no-contains", "--merged", "--no-merged", "--points-at", "--sort", "--format",
+	"--color", "--no-color", "--column", "--no-column", "-i", "--ignore-case", "--abbrev", "--no-abbrev",
+	"--omit-empty",
+}
+
+// branchPatternFlags make git branch take its other arguments as patterns or
+// commits to list by; without one of them a name creates a branch
+var branchPatternFlags = []string{"-l", "--list", "--contains", "--no-contains", "--merged", "--no-merged", "--points-at"}
+
+// unquote drops the quotes and escapes the shell would remove, so quoting a
+// flag does not hide it
+var unquote = strings.NewReplacer(`'`, "", `"`, "", `\`, "")
+
+// IsSafeCommand reports whether a shell command only runs programs that
+// read, without redirecting output, substituting commands or chaining them
+// other than with pipes
+func IsSafeCommand(command string) bool {
+	if strings.ContainsAny(command, ">;&`$\n") {
+		return false
+	}
+	for _, part := range strings.Split(command, "|") {
+		words := strings.Fields(unquote.Replace(part))
+		if len(words) == 0 {
+			return false
+		}
+		subcommands, ok := safeCommands[words[0]]
+		if !ok {
+			return false
+		}
+		if subcommands != nil && (len(words) < 2 || !contains(subcommands, words[1])) {
+			return false
+		}
+		for _, word := range words[1:] {
+			if isUnsafeFlag(words[0], word) {
+				return false
+			}
+		}
+		if words[0] == "git" && words[1] == "branch" && !listsBranches(words[2:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUnsafeFlag reports whether word is one of program's unsafe flags. Short
+// flags also match with their value attached or grouped with other short
+// flags, as in -o/tmp/x or -ro, and long flags match when abbreviated.
+func isUnsafeFlag(program, word string) bool {
+	flag, _, _ := strings.Cut(word, "=")
+	if program == "go" {
+		// Go's flags take one or two dashes and are never grouped
+		return contains(unsafeFlags[program], "-"+strings.TrimLeft(flag, "-"))
+	}
+	for _, unsafe := range unsafeFlags[program] {
+		switch {
+		case flag == unsafe:
+			return true
+		case len(unsafe) == 2 && unsafe[0] == '-':
+			if strings.HasPrefix(word, "-") && !strings.HasPrefix(word, "--") && strings.Contains(word[1:], unsafe[1:]) {
+				return true
+			}
+		case strings.HasPrefix(unsafe, "--") && len(flag) > 2 && strings.HasPrefix(unsafe, flag):
+			return true
+		}
+	}
+	return false
+}
+
+// listsBranches reports whether the arguments of git branch only list
+// branches, rather than create, rename or delete them
+func listsBranches(args []string) bool {
+	names, listing := 0, false
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			names++
+			continue
+		}
+		flag, _, _ := strings.Cut(arg, "=")
+		if !contains(branchListFlags, flag) {
+			return false
+		}
+		listing = listing || contains(branchPatternFlags, flag)
+	}
+	return names == 0 || listing
+}
+
+// SafeCommand runs a command if IsSafeCommand allows it
+func SafeCommand(ctx context.Context, env *Env, input json.RawMessage) (string, error) {
+	runCommandInput := RunCommandInput{}
+	if err := json.Unmarshal(input, &runCommandInput); err != nil {
+		return "", err
+	}
+	if !IsSafeCommand(runCommandInput.Command) {
+		return "", fmt.Errorf("only read-only commands may run here, and %q is not known to be one", runCommandInput.Command)
+	}
+	return RunCommand(ctx, env, input)
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package tools
+
+import "testing"
+
+func TestIsSafeCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		safe    bool
+	}{
+		{"ls -la", true},
+		{"cat main.go | grep func | wc -l", true},
+		{"rg -n TODO pkg", true},
+		{"find . -name '*.go'", true},
+		{"git status", true},
+		{"git log --oneline -5", true},
+		{"git diff HEAD~1 -- pkg", true},
+		{"sort -u names.txt", true},
+		{"tree -L 2", true},
+		{"go list ./...", true},
+
+		// Chaining, redirection and substitution
+		{"ls; rm -rf /", false},
+		{"ls && rm -rf /", false},
+		{"ls > out.txt", false},
+		{"cat $(which rm)", false},
+		{"cat `which rm`", false},
+		{"ls\nrm -rf /", false},
+		{"ls |", false},
+		{"", false},
+
+		// Programs and subcommands that are not allowlisted
+		{"rm -rf /", false},
+		{"sh -c ls", false},
+		{"git", false},
+		{"git push", false},
+		{"git -c core.pager=sh log", false},
+		{"go build ./...", false},
+
+		// git branch only lists
+		{"git branch", true},
+		{"git branch -a -v", true},
+		{"git branch --show-current", true},
+		{"git branch --list 'feature/*'", true},
+		{"git branch --contains HEAD", true},
+		{"git branch --merged main", true},
+		{"git branch --sort=-committerdate", true},
+		{"git branch foo", false},
+		{"git branch -v foo", false},
+		{"git branch --sort=refname foo", false},
+		{"git branch -D main", false},
+		{"git branch -d foo", false},
+		{"git branch -m old new", false},
+		{"git branch --set-upstream-to=origin/main", false},
+
+		// Flags that run commands or write files
+		{"find . -delete", false},
+		{"find . -exec rm {} +", false},
+		{"sort -o /tmp/x names.txt", false},
+		{"sort -o/tmp/x names.txt", false},
+		{"sort -ro/tmp/x names.txt", false},
+		{"sort --output=/tmp/x names.txt", false},
+		{"sort --out=/tmp/x names.txt", false},
+		{"sort --compress-program=sh names.txt", false},
+		{"tree -o/tmp/x", false},
+		{"tree -R -H . .", false},
+		{"rg --pre=./run.sh TODO", false},
+		{"rg --pre ./run.sh TODO", false},
+		{"rg --pre-glob '*.pdf' --pre ./run.sh TODO", false},
+		{"git grep -Ovim TODO", false},
+		{"git grep -nO vim TODO", false},
+		{"git grep --open-files-in-pager=vim TODO", false},
+		{"git grep --open-files=vim TODO", false},
+		{"git log --output=/tmp/x", false},
+		{"git diff --ext-diff", false},
+		{"go env -w GOFLAGS=-x", false},
+		{"go env --w GOFLAGS=-x", false},
+		{"go list -mod=mod ./...", false},
+		{"go list -toolexec=./run.sh ./...", false},
+		{"file -C -m magic", false},
+
+		// Quoting does not hide flags
+		{"sort '-o' /tmp/x names.txt", false},
+		{`rg "--pre=./run.sh" TODO`, false},
+		{`find . -del\ete`, false},
+		{"git 'branch' foo", false},
+	}
+	for _, test := range tests {
+		if got := IsSafeCommand(test.command); got != test.safe {
+			t.Errorf("IsSafeCommand(%q) = %t, want %t", test.command, got, test.safe)
+		}
+	}
+}
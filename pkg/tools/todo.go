@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var TodoDefinition = ToolDefinition{
+	Name: "todo",
+	Description: `Keep a checklist of the work in a multi-step task.
+
+Pass the whole list each time: add items when you plan the work, mark one in_progress before you start on it and done
+as soon as it is finished. Only one item may be in progress at a time. Use it for tasks of three or more steps or that
+touch several files, and skip it for simple requests. The current list is always shown to you.
+`,
+	InputSchema: TodoInputSchema,
+	Function:    Todo,
+}
+
+// TodoStatus is how far a todo item has got
+type TodoStatus string
+
+const (
+	TodoPending    TodoStatus = "pending"
+	TodoInProgress TodoStatus = "in_progress"
+	TodoDone       TodoStatus = "done"
+)
+
+// TodoItem is one entry of the todo list
+type TodoItem struct {
+	Content string     `json:"content" jsonschema_description:"What to do, in one line."`
+	Status  TodoStatus `json:"status" jsonschema:"enum=pending,enum=in_progress,enum=done" jsonschema_description:"pending, in_progress or done."`
+}
+
+type TodoInput struct {
+	Todos []TodoItem `json:"todos" jsonschema_description:"The complete list, replacing the previous one."`
+}
+
+var TodoInputSchema = GenerateSchema[TodoInput]()
+
+// TodoList is the checklist Claude keeps with the todo tool. It is safe for
+// concurrent use.
+type TodoList struct {
+	mu       sync.Mutex
+	items    []TodoItem
+	onChange func([]TodoItem)
+}
+
+// NewTodoList creates an empty list
+func NewTodoList() *TodoList {
+	return &TodoList{}
+}
+
+// OnChange sets a function called with the items whenever the list is set
+func (l *TodoList) OnChange(fn func([]TodoItem)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onChange = fn
+}
+
+// Items returns a copy of the list
+func (l *TodoList) Items() []TodoItem {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]TodoItem(nil), l.items...)
+}
+
+// Set replaces the list after checking every item has content and a known
+// status and at most one is in progress
+func (l *TodoList) Set(items []TodoItem) error {
+	inProgress := 0
+	for i, item := range items {
+		if strings.TrimSpace(item.Content) == "" {
+			return fmt.Errorf("item %d has no content", i+1)
+		}
+		switch item.Status {
+		case TodoPending, TodoDone:
+		case TodoInProgress:
+			inProgress++
+		default:
+			return fmt.Errorf("item %d has unknown status %q; use pending, in_progress or done", i+1, item.Status)
+		}
+	}
+	if inProgress > 1 {
+		return fmt.Errorf("%d items are in progress; only one may be, so finish it before starting the next", inProgress)
+	}
+	l.Restore(items)
+	return nil
+}
+
+// Restore replaces the list without checking it, as when resuming a session
+func (l *TodoList) Restore(items []TodoItem) {
+	l.mu.Lock()
+	l.items = append([]TodoItem(nil), items...)
+	onChange := l.onChange
+	l.mu.Unlock()
+	if onChange != nil {
+		onChange(l.Items())
+	}
+}
+
+// FormatTodos shows items as a checklist with a count of those done
+func FormatTodos(items []TodoItem) string {
+	done := 0
+	for _, item := range items {
+		if item.Status == TodoDone {
+			done++
+		}
+	}
+	lines := []string{fmt.Sprintf("Todo: %d of %d done", done, len(items))}
+	for _, item := range items {
+		icon := "○"
+		switch item.Status {
+		case TodoInProgress:
+			icon = "▸"
+		case TodoDone:
+			icon = "✓"
+		}
+		lines = append(lines, fmt.Sprintf("  %s %s", icon, item.Content))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func Todo(ctx context.Context, env *Env, input json.RawMessage) (string, error) {
+	todoInput := TodoInput{}
+	if err := json.Unmarshal(input, &todoInput); err != nil {
+		return "", err
+	}
+	if env == nil || env.Todos == nil {
+		return "", errors.New("no todo list is kept in this session")
+	}
+	if err := env.Todos.Set(todoInput.Todos); err != nil {
+		return "", err
+	}
+	if len(todoInput.Todos) == 0 {
+		return "Cleared the todo list.", nil
+	}
+	return "Updated the todo list.\n" + FormatTodos(todoInput.Todos), nil
+}
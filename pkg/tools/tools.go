@@ -1,7 +1,9 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/invopop/jsonschema"
@@ -12,7 +14,9 @@ type ToolDefinition struct {
 	Name        string                         `json:"name"`
 	Description string                         `json:"description"`
 	InputSchema anthropic.ToolInputSchemaParam `json:"input_schema"`
-	Function    func(input json.RawMessage) (string, error)
+	Function    func(ctx context.Context, env *Env, input json.RawMessage) (string, error)
+	// ReadOnly marks tools that have no side effects and may run concurrently
+	ReadOnly bool `json:"-"`
 }
 
 // commonLine represents a line that appears in both the original and modified code
@@ -85,6 +89,33 @@ func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
 	}
 }
 
+// ParseSchema converts a JSON schema object into the SDK's schema param,
+// keeping keywords other than properties, such as required, as extra fields.
+// The returned param is usable, with no properties, even when err is set.
+func ParseSchema(raw json.RawMessage) (anthropic.ToolInputSchemaParam, error) {
+	param := anthropic.ToolInputSchemaParam{Properties: map[string]interface{}{}}
+	if len(raw) == 0 {
+		return param, nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return param, fmt.Errorf("invalid input schema: %w", err)
+	}
+	if t, ok := schema["type"]; ok && t != "object" {
+		return param, fmt.Errorf("invalid input schema: type must be \"object\", not %v", t)
+	}
+
+	if properties, ok := schema["properties"]; ok && properties != nil {
+		param.Properties = properties
+	}
+	delete(schema, "properties")
+	delete(schema, "type")
+	if len(schema) > 0 {
+		param.WithExtraFields(schema)
+	}
+	return param, nil
+}
+
 // GetAllTools returns all the tool definitions
 func GetAllTools() []ToolDefinition {
 	return []ToolDefinition{
@@ -93,5 +124,6 @@ func GetAllTools() []ToolDefinition {
 		EditFileDefinition, 
 		RunCommandDefinition, 
 		GenerateDiffDefinition,
+		TodoDefinition,
 	}
 }
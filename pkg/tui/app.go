@@ -0,0 +1,972 @@
+// Package tui is a full-screen terminal interface for the agent: a scrollable
+// transcript with collapsible tool panels, an input box, a status bar and
+// dialogs for approving tool calls. It is driven by the same events as the
+// line-based interface.
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/agent"
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/review"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+	"github.com/ttli3/terminal-coding-agent/pkg/usage"
+	"golang.org/x/term"
+)
+
+const (
+	altScreenOn  = "\033[?1049h"
+	altScreenOff = "\033[?1049l"
+	hideCursor   = "\033[?25l"
+	showCursor   = "\033[?25h"
+)
+
+// maxInputRows is how tall the input box grows before it scrolls
+const maxInputRows = 8
+
+// exitWindow is how soon a second ctrl-c must follow the first to exit
+const exitWindow = 2 * time.Second
+
+// spinner is shown in the status bar while the agent is busy
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Status is what the status bar shows besides the agent's activity
+type Status struct {
+	Usage          usage.Report
+	PermissionMode string
+	WorkspaceRoot  string
+}
+
+// History keeps the messages the user has sent across sessions
+type History interface {
+	Entries() []string
+	Add(entry string) error
+}
+
+// Options connect the interface to the agent it shows
+type Options struct {
+	// Status returns the current state for the status bar
+	Status func() Status
+	// Interrupt stops the running turn, reporting whether there was one
+	Interrupt func() bool
+	// Complete returns the completions of a partly typed line
+	Complete func(line string) []string
+	// History, when set, is stepped through with up and down
+	History History
+	// Env resolves paths when previewing edits
+	Env *tools.Env
+}
+
+// App is the full-screen interface. It is an agent.InputSource, an
+// agent.EventHandler through Handle, and a permission.Asker.
+type App struct {
+	in, out *os.File
+	opts    Options
+
+	mu       sync.Mutex
+	width    int
+	height   int
+	entries  []*entry
+	tools    map[string]*entry
+	input    inputBox
+	hint     string
+	scroll   int
+	selected int
+
+	busy      bool
+	activity  string
+	started   time.Time
+	streaming *entry
+	// The checklists of the plan and the todo list shown in this turn are updated in place
+	plan  *entry
+	todos *entry
+
+	// Lines sent while the agent is busy wait for its next ReadLine
+	queue   []string
+	waiting chan string
+	modals  []*modal
+
+	// The terminal's settings before Run, restored while an editor runs
+	fd        int
+	state     *term.State
+	reader    *ttyReader
+	suspended bool
+
+	lastInterrupt time.Time
+	closing       bool
+	closedAt      int
+	clear         bool
+	wake          chan struct{}
+	exited        chan struct{}
+}
+
+// New creates the interface on a terminal
+func New(in, out *os.File, opts Options) *App {
+	a := &App{
+		in:       in,
+		out:      out,
+		opts:     opts,
+		tools:    make(map[string]*entry),
+		selected: -1,
+		wake:     make(chan struct{}, 1),
+		exited:   make(chan struct{}),
+	}
+	if opts.History != nil {
+		a.input.history = append([]string(nil), opts.History.Entries()...)
+	}
+	a.input.clear()
+	return a
+}
+
+// Run takes over the terminal and calls run, usually the agent's Run, until
+// it returns. Messages the agent shows after the user quits are printed once
+// the terminal is restored.
+func (a *App) Run(ctx context.Context, run func(context.Context) error) error {
+	a.fd = int(a.in.Fd())
+	state, err := term.MakeRaw(a.fd)
+	if err != nil {
+		return fmt.Errorf("failed to start full-screen mode: %w", err)
+	}
+	a.state = state
+	fmt.Fprint(a.out, altScreenOn+pasteOn)
+	a.resize()
+
+	// Without a reader that can be paused, keys are read directly and the
+	// editor cannot be opened
+	var in io.Reader = a.in
+	if reader, err := newTTYReader(a.in); err == nil {
+		a.reader, in = reader, reader
+		defer reader.restore()
+	}
+	keys := make(chan []key, 16)
+	go readKeys(in, keys)
+	done := make(chan error, 1)
+	go func() { done <- run(ctx) }()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case batch, ok := <-keys:
+			a.mu.Lock()
+			if !ok {
+				a.close()
+				keys = nil
+			}
+			for _, k := range batch {
+				a.handleKey(k)
+			}
+			a.mu.Unlock()
+		case <-a.wake:
+		case <-ticker.C:
+			// Redraw for the spinner while busy, and when the terminal is resized
+			resized := a.resize()
+			a.mu.Lock()
+			busy := a.busy
+			a.mu.Unlock()
+			if !resized && !busy {
+				continue
+			}
+		case err = <-done:
+			fmt.Fprint(a.out, pasteOff+altScreenOff+showCursor)
+			term.Restore(a.fd, state)
+			close(a.exited)
+			a.printAfterExit()
+			return err
+		}
+		a.draw()
+	}
+}
+
+// Handle implements agent.EventHandler, updating the transcript
+func (a *App) Handle(e agent.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	defer a.poke()
+
+	switch e.Type {
+	case agent.EventTurnStarted:
+		a.busy, a.started, a.activity = true, time.Now(), "Thinking"
+	case agent.EventRequestStarted:
+		a.dropStreaming()
+		a.activity = "Thinking"
+	case agent.EventTextReset:
+		a.dropStreaming()
+	case agent.EventRetry:
+		a.dropStreaming()
+		a.activity = e.Text
+	case agent.EventTextDelta:
+		if a.streaming == nil {
+			a.streaming = a.add(&entry{kind: entryAssistant})
+		}
+		a.streaming.text += e.Text
+		a.streaming.changed()
+	case agent.EventText:
+		if a.streaming != nil {
+			a.streaming.text = e.Text
+			a.streaming.changed()
+			a.streaming = nil
+		} else {
+			a.add(&entry{kind: entryAssistant, text: e.Text})
+		}
+	case agent.EventToolRequested:
+		a.tools[e.ToolID] = a.add(&entry{kind: entryTool, toolID: e.ToolID, tool: e.ToolName, input: e.Input})
+	case agent.EventToolStarted:
+		if t := a.tools[e.ToolID]; t != nil {
+			t.state = toolRunning
+			t.changed()
+		}
+		a.activity = "Running " + e.ToolName
+	case agent.EventToolProgress:
+		if t := a.tools[e.ToolID]; t != nil {
+			t.progress = append(t.progress, e.Text)
+			t.changed()
+		}
+	case agent.EventToolDenied:
+		if t := a.tools[e.ToolID]; t != nil {
+			t.state, t.output = toolDenied, e.Text
+			t.changed()
+		}
+	case agent.EventToolFinished:
+		if t := a.tools[e.ToolID]; t != nil {
+			if t.state != toolDenied {
+				t.output, t.state = e.Output, toolDone
+				if e.IsError {
+					t.state = toolFailed
+				}
+			}
+			t.changed()
+			delete(a.tools, e.ToolID)
+		}
+		a.activity = "Thinking"
+	case agent.EventPlanUpdated:
+		a.plan = a.updateChecklist(a.plan, e.Text)
+	case agent.EventTodosUpdated:
+		a.todos = a.updateChecklist(a.todos, e.Text)
+	case agent.EventNotice:
+		a.add(&entry{kind: entryNotice, text: strings.Trim(e.Text, "\n")})
+	case agent.EventError:
+		a.add(&entry{kind: entryError, text: e.Text})
+	case agent.EventTurnEnded:
+		a.dropStreaming()
+		a.busy = false
+		a.tools = make(map[string]*entry)
+		a.plan, a.todos = nil, nil
+	}
+}
+
+// ReadLine implements agent.InputSource, waiting for the user to send a
+// message. It returns false once the user quits.
+func (a *App) ReadLine(prompt string) (string, bool) {
+	a.mu.Lock()
+	if a.closing {
+		a.mu.Unlock()
+		return "", false
+	}
+	if len(a.queue) > 0 {
+		line := a.queue[0]
+		a.queue = a.queue[1:]
+		a.deliver(line)
+		a.mu.Unlock()
+		a.poke()
+		return line, true
+	}
+	reply := make(chan string, 1)
+	a.waiting = reply
+	a.mu.Unlock()
+	a.poke()
+
+	select {
+	case line, ok := <-reply:
+		return line, ok
+	case <-a.exited:
+		return "", false
+	}
+}
+
+// ReadAnswer implements agent.AnswerReader, asking a yes or no question in a dialog
+func (a *App) ReadAnswer(prompt string) (string, bool) {
+	m := questionModal(prompt)
+	if !a.show(m) {
+		return "", false
+	}
+	select {
+	case answer := <-m.reply:
+		return answer, true
+	case <-a.exited:
+		return "", false
+	}
+}
+
+// AskPermission implements permission.Asker, showing the call in a dialog.
+// Edits are shown as the change they would make to the file.
+func (a *App) AskPermission(ctx context.Context, req permission.Request) (permission.Decision, error) {
+	m := permissionModal(ctx, req, a.opts.Env)
+	if !a.show(m) {
+		return permission.Deny, nil
+	}
+	select {
+	case answer := <-m.reply:
+		switch answer {
+		case "y":
+			return permission.Allow, nil
+		case "a":
+			return permission.AllowAlways, nil
+		}
+		return permission.Deny, nil
+	case <-ctx.Done():
+		a.dismiss(m)
+		return permission.Deny, ctx.Err()
+	case <-a.exited:
+		return permission.Deny, nil
+	}
+}
+
+// Choose implements review.UI, showing the choices in a dialog
+func (a *App) Choose(ctx context.Context, title string, body []string, choices []review.Choice) (rune, error) {
+	answer, err := a.ask(ctx, choiceModal(ctx, title, body, choices))
+	if err != nil {
+		return 0, err
+	}
+	return []rune(answer)[0], nil
+}
+
+// Ask implements review.UI, reading the answer in a dialog
+func (a *App) Ask(ctx context.Context, prompt string) (string, error) {
+	return a.ask(ctx, textModal(ctx, prompt))
+}
+
+// ask shows a dialog and waits for its answer
+func (a *App) ask(ctx context.Context, m *modal) (string, error) {
+	if !a.show(m) {
+		return "", errors.New("the interface has closed")
+	}
+	select {
+	case answer := <-m.reply:
+		if answer == "" && m.field == nil {
+			return "", errors.New("the interface has closed")
+		}
+		return answer, nil
+	case <-ctx.Done():
+		a.dismiss(m)
+		return "", ctx.Err()
+	case <-a.exited:
+		return "", errors.New("the interface has closed")
+	}
+}
+
+// RunEditor implements review.UI, leaving full-screen mode while cmd runs
+func (a *App) RunEditor(cmd *exec.Cmd) error {
+	if a.reader == nil {
+		return errors.New("the editor cannot be opened from this terminal")
+	}
+	a.mu.Lock()
+	a.suspended = true
+	a.mu.Unlock()
+	a.reader.pause()
+	fmt.Fprint(a.out, pasteOff+altScreenOff+showCursor)
+	term.Restore(a.fd, a.state)
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = a.in, a.out, os.Stderr
+	err := cmd.Run()
+
+	term.MakeRaw(a.fd)
+	fmt.Fprint(a.out, altScreenOn+pasteOn)
+	a.reader.unpause()
+	a.mu.Lock()
+	a.suspended, a.clear = false, true
+	a.mu.Unlock()
+	a.poke()
+	return err
+}
+
+// show opens a dialog, or returns false once the user has quit
+func (a *App) show(m *modal) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closing {
+		return false
+	}
+	a.modals = append(a.modals, m)
+	a.poke()
+	return true
+}
+
+// dismiss closes a dialog without an answer
+func (a *App) dismiss(m *modal) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, open := range a.modals {
+		if open == m {
+			a.modals = append(a.modals[:i:i], a.modals[i+1:]...)
+			break
+		}
+	}
+	a.poke()
+}
+
+// poke asks the screen to be drawn again
+func (a *App) poke() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// add appends an entry to the transcript
+func (a *App) add(e *entry) *entry {
+	a.entries = append(a.entries, e)
+	return e
+}
+
+// updateChecklist shows text in the checklist entry, adding the entry if the
+// turn has none yet; an empty text leaves the transcript as it is
+func (a *App) updateChecklist(e *entry, text string) *entry {
+	if text == "" {
+		return e
+	}
+	if e == nil {
+		e = a.add(&entry{kind: entryChecklist})
+	}
+	e.text = text
+	e.changed()
+	return e
+}
+
+// dropStreaming removes a reply that stopped streaming before it was complete
+func (a *App) dropStreaming() {
+	if a.streaming == nil {
+		return
+	}
+	for i, e := range a.entries {
+		if e == a.streaming {
+			a.entries = append(a.entries[:i], a.entries[i+1:]...)
+			if a.selected >= i {
+				a.selected--
+			}
+			break
+		}
+	}
+	a.streaming = nil
+}
+
+// deliver shows a line the agent has taken
+func (a *App) deliver(line string) {
+	a.add(&entry{kind: entryUser, text: line})
+	a.scroll = 0
+}
+
+// submit sends a line to the agent, or queues it while the agent is busy
+func (a *App) submit(line string) {
+	a.input.history = append(a.input.history, line)
+	if a.opts.History != nil {
+		// The history is a convenience; failing to save it should not interrupt input
+		a.opts.History.Add(line)
+	}
+	a.input.clear()
+	if a.waiting == nil {
+		a.queue = append(a.queue, line)
+		return
+	}
+	a.deliver(line)
+	a.waiting <- line
+	a.waiting = nil
+}
+
+// close quits once the agent is waiting for input
+func (a *App) close() {
+	if a.closing {
+		return
+	}
+	a.closing, a.closedAt = true, len(a.entries)
+	a.queue = nil
+	if a.waiting != nil {
+		close(a.waiting)
+		a.waiting = nil
+	}
+	if a.busy && a.opts.Interrupt != nil {
+		a.opts.Interrupt()
+	}
+	for _, m := range a.modals {
+		m.reply <- m.cancel
+	}
+	a.modals = nil
+}
+
+// interrupt stops the running turn and drops queued lines
+func (a *App) interrupt() {
+	if a.opts.Interrupt != nil && a.opts.Interrupt() {
+		a.hint = "interrupted"
+	}
+	a.queue = nil
+}
+
+// handleKey acts on a key press
+func (a *App) handleKey(k key) {
+	if len(a.modals) > 0 {
+		a.handleModalKey(a.modals[0], k)
+		return
+	}
+
+	if k.name != "ctrl-c" && k.name != "ctrl-d" {
+		a.hint = ""
+	}
+	page := max(1, a.transcriptHeight()-1)
+	switch k.name {
+	case "enter":
+		text := a.input.text()
+		if strings.HasSuffix(text, "\\") && a.input.pos == len(a.input.buf) {
+			// A trailing backslash continues the message on a new line
+			a.input.set(strings.TrimSuffix(text, "\\") + "\n")
+			return
+		}
+		if strings.TrimSpace(text) != "" {
+			a.submit(text)
+		}
+	case "ctrl-c":
+		switch {
+		case a.busy:
+			a.interrupt()
+		case len(a.input.buf) > 0:
+			a.input.clear()
+		case time.Since(a.lastInterrupt) < exitWindow:
+			a.close()
+		default:
+			a.hint = "press ctrl-c again to exit"
+			a.lastInterrupt = time.Now()
+		}
+	case "ctrl-d":
+		if len(a.input.buf) > 0 {
+			a.input.edit(k)
+			return
+		}
+		a.close()
+	case "esc":
+		if a.busy {
+			a.interrupt()
+			return
+		}
+		a.selected = -1
+	case "pgup":
+		a.scroll += page
+	case "pgdn":
+		a.scroll -= page
+	case "shift-up":
+		a.scroll++
+	case "shift-down":
+		a.scroll--
+	case "alt-up", "ctrl-up":
+		a.selectTool(-1)
+	case "alt-down", "ctrl-down":
+		a.selectTool(1)
+	case "ctrl-o":
+		a.toggleTool()
+	case "ctrl-t":
+		a.toggleAllTools()
+	case "tab":
+		a.complete()
+	case "ctrl-l":
+		a.clear = true
+	default:
+		a.input.edit(k)
+	}
+}
+
+// handleModalKey answers or scrolls the open dialog
+func (a *App) handleModalKey(m *modal, k key) {
+	switch k.name {
+	case "up", "ctrl-p", "shift-up":
+		m.scroll--
+		return
+	case "down", "ctrl-n", "shift-down":
+		m.scroll++
+		return
+	case "pgup":
+		m.scroll -= max(1, a.height/2)
+		return
+	case "pgdn":
+		m.scroll += max(1, a.height/2)
+		return
+	}
+	answer, ok := m.answer(k)
+	if !ok {
+		// Dialogs without a way to cancel them are left by interrupting the turn
+		if k.name == "ctrl-c" && m.field == nil {
+			a.interrupt()
+		}
+		return
+	}
+	a.modals = a.modals[1:]
+	m.reply <- answer
+}
+
+// selectTool moves the selection to the next tool panel in direction,
+// starting from the newest
+func (a *App) selectTool(direction int) {
+	i := a.selected
+	if i < 0 {
+		i = len(a.entries)
+		if direction > 0 {
+			return
+		}
+	}
+	for i += direction; i >= 0 && i < len(a.entries); i += direction {
+		if a.entries[i].kind == entryTool {
+			a.selected = i
+			a.revealSelected()
+			return
+		}
+	}
+	if direction > 0 {
+		a.selected = -1
+	}
+}
+
+// toggleTool expands or collapses the selected tool panel, or the newest
+func (a *App) toggleTool() {
+	i := a.selected
+	if i < 0 {
+		for i = len(a.entries) - 1; i >= 0 && a.entries[i].kind != entryTool; i-- {
+		}
+	}
+	if i < 0 {
+		return
+	}
+	a.entries[i].expanded = !a.entries[i].expanded
+	a.entries[i].changed()
+	if a.selected >= 0 {
+		a.revealSelected()
+	}
+}
+
+// toggleAllTools expands every tool panel, or collapses them all when none is collapsed
+func (a *App) toggleAllTools() {
+	expand := false
+	for _, e := range a.entries {
+		if e.kind == entryTool && !e.expanded {
+			expand = true
+		}
+	}
+	for _, e := range a.entries {
+		if e.kind == entryTool {
+			e.expanded = expand
+			e.changed()
+		}
+	}
+}
+
+// complete completes the text before the cursor, listing the choices as a
+// hint when there is more than one
+func (a *App) complete() {
+	if a.opts.Complete == nil {
+		return
+	}
+	typed := string(a.input.buf[:a.input.pos])
+	choices := a.opts.Complete(typed)
+	if len(choices) == 0 {
+		return
+	}
+
+	completed := commonPrefix(choices)
+	if len(completed) > len(typed) {
+		tail := string(a.input.buf[a.input.pos:])
+		a.input.set(completed)
+		a.input.insert(tail)
+		a.input.pos = len([]rune(completed))
+		return
+	}
+	if len(choices) == 1 {
+		return
+	}
+	start := strings.LastIndexByte(typed, ' ') + 1
+	words := make([]string, len(choices))
+	for i, c := range choices {
+		words[i] = strings.TrimSpace(c[start:])
+	}
+	a.hint = strings.Join(words, "  ")
+}
+
+// commonPrefix returns the longest prefix shared by every string
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// resize reads the terminal's size, reporting whether it has changed
+func (a *App) resize() bool {
+	width, height, err := term.GetSize(int(a.out.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if width == a.width && height == a.height {
+		return false
+	}
+	a.width, a.height, a.clear = width, height, true
+	return true
+}
+
+// transcriptHeight returns how many rows the transcript has on screen
+func (a *App) transcriptHeight() int {
+	rows, _, _ := a.input.render(a.width, "› ")
+	return max(1, a.height-2-min(len(rows), maxInputRows))
+}
+
+// transcriptRows renders the transcript, returning its rows and the row
+// each entry starts on
+func (a *App) transcriptRows() ([]string, []int) {
+	var rows []string
+	starts := make([]int, len(a.entries))
+	for i, e := range a.entries {
+		if i > 0 {
+			rows = append(rows, "")
+		}
+		starts[i] = len(rows)
+		rows = append(rows, e.render(a.width, i == a.selected)...)
+	}
+	return rows, starts
+}
+
+// revealSelected scrolls the selected entry onto the screen
+func (a *App) revealSelected() {
+	rows, starts := a.transcriptRows()
+	if a.selected < 0 || a.selected >= len(starts) {
+		return
+	}
+	height := a.transcriptHeight()
+	top := len(rows) - a.scroll - height
+	start := starts[a.selected]
+	switch {
+	case start < top:
+		a.scroll = len(rows) - height - start
+	case start >= top+height:
+		a.scroll = len(rows) - start - 1
+	}
+}
+
+// draw renders the whole screen
+func (a *App) draw() {
+	var status Status
+	if a.opts.Status != nil {
+		status = a.opts.Status()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.width == 0 || a.height == 0 || a.suspended {
+		return
+	}
+	width, height := a.width, a.height
+
+	// Input box, keeping the cursor's row in view
+	inputRows, cursorRow, cursorCol := a.input.render(width, styleUser+"›"+reset+" ")
+	first := max(0, min(cursorRow-maxInputRows+1, len(inputRows)-maxInputRows))
+	inputRows = inputRows[first:min(len(inputRows), first+maxInputRows)]
+	cursorRow -= first
+
+	// Transcript, following its end unless scrolled back
+	viewHeight := max(1, height-2-len(inputRows))
+	rows, _ := a.transcriptRows()
+	a.scroll = max(0, min(a.scroll, len(rows)-viewHeight))
+	end := len(rows) - a.scroll
+	view := rows[max(0, end-viewHeight):end]
+
+	screen := make([]string, 0, height)
+	for i := len(view); i < viewHeight; i++ {
+		screen = append(screen, "")
+	}
+	screen = append(screen, view...)
+	screen = append(screen, a.border(width))
+	screen = append(screen, inputRows...)
+	screen = append(screen, a.statusBar(width, status))
+
+	cursor := fmt.Sprintf("\033[%d;%dH%s", viewHeight+2+cursorRow, cursorCol+1, showCursor)
+	if len(a.modals) > 0 {
+		cursor = ""
+		if row, col, ok := a.overlay(screen, a.modals[0]); ok {
+			cursor = fmt.Sprintf("\033[%d;%dH%s", row+1, col+1, showCursor)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(hideCursor)
+	if a.clear {
+		b.WriteString("\033[2J")
+		a.clear = false
+	}
+	b.WriteString("\033[H")
+	for i, row := range screen[:min(len(screen), height)] {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(truncate(row, width) + reset + "\033[K")
+	}
+	b.WriteString(cursor)
+	fmt.Fprint(a.out, b.String())
+}
+
+// border separates the transcript from the input box, showing the hint in it
+func (a *App) border(width int) string {
+	hint := a.hint
+	switch {
+	case hint != "":
+	case a.scroll == 1:
+		hint = "scrolled back 1 line · pgdn to return"
+	case a.scroll > 1:
+		hint = fmt.Sprintf("scrolled back %d lines · pgdn to return", a.scroll)
+	case len(a.queue) == 1:
+		hint = "1 message queued"
+	case len(a.queue) > 1:
+		hint = fmt.Sprintf("%d messages queued", len(a.queue))
+	}
+	if hint == "" {
+		return styleDim + strings.Repeat("─", width) + reset
+	}
+	hint = truncate(" "+hint+" ", max(0, width-4))
+	return styleDim + "──" + hint + styleDim + strings.Repeat("─", max(0, width-2-displayWidth(hint))) + reset
+}
+
+// statusBar shows the model, usage, permission mode and workspace, and what
+// the agent is doing
+func (a *App) statusBar(width int, status Status) string {
+	report := status.Usage
+	var parts []string
+	if report.Model != "" {
+		parts = append(parts, report.Model)
+	}
+	parts = append(parts,
+		fmt.Sprintf("↑%s ↓%s", usage.FormatTokens(report.Session.InputTokens+report.Session.CacheReadTokens+report.Session.CacheWriteTokens), usage.FormatTokens(report.Session.OutputTokens)),
+		usage.FormatCost(report.SessionCost))
+	if status.PermissionMode != "" {
+		parts = append(parts, status.PermissionMode)
+	}
+	if status.WorkspaceRoot != "" {
+		parts = append(parts, shortPath(status.WorkspaceRoot))
+	}
+	left := " " + strings.Join(parts, " │ ")
+
+	right := "pgup/pgdn scroll · alt-↑↓ select · ctrl-o expand "
+	if a.busy {
+		frame := int(time.Since(a.started)/(100*time.Millisecond)) % len(spinner)
+		right = fmt.Sprintf("%s %s %.0fs · esc to interrupt ", spinner[frame], a.activity, time.Since(a.started).Seconds())
+	}
+	if displayWidth(left)+displayWidth(right)+1 > width {
+		right = ""
+		if a.busy {
+			right = spinner[int(time.Since(a.started)/(100*time.Millisecond))%len(spinner)] + " "
+		}
+	}
+	gap := max(1, width-displayWidth(left)-displayWidth(right))
+	return styleBar + truncate(left+strings.Repeat(" ", gap)+right, width) + reset
+}
+
+// overlay draws a dialog over the middle of the screen, returning where the
+// cursor goes when the dialog has a text box
+func (a *App) overlay(screen []string, m *modal) (cursorRow, cursorCol int, ok bool) {
+	boxWidth := min(a.width, max(20, a.width-4))
+	inner := boxWidth - 4
+	body := m.body(inner)
+
+	var fieldRows []string
+	var fieldRow, fieldCol int
+	if m.field != nil {
+		fieldRows, fieldRow, fieldCol = m.field.render(inner, styleUser+"›"+reset+" ")
+		fieldRows = append([]string{""}, fieldRows...)
+		fieldRow++
+	}
+
+	maxBody := max(1, len(screen)-6-len(fieldRows))
+	bodyHeight := min(len(body), maxBody)
+	m.scroll = max(0, min(m.scroll, len(body)-bodyHeight))
+
+	var labels []string
+	for _, c := range m.choices {
+		labels = append(labels, styleBold+"["+string(c.key)+"]"+reset+c.label[1:])
+	}
+	footer := strings.Join(labels, "  ")
+	if m.field != nil {
+		footer = styleDim + "enter to send · esc to skip" + reset
+	}
+	if len(body) > bodyHeight {
+		footer += styleDim + fmt.Sprintf("   ↑↓ scroll %d/%d", m.scroll+bodyHeight, len(body)) + reset
+	}
+
+	title := truncate(" "+m.title+" ", inner)
+	box := []string{"╭─" + styleBold + title + reset + strings.Repeat("─", max(0, boxWidth-3-displayWidth(title))) + "╮"}
+	for _, row := range body[m.scroll : m.scroll+bodyHeight] {
+		box = append(box, "│ "+pad(row, inner)+reset+" │")
+	}
+	fieldStart := len(box)
+	for _, row := range fieldRows {
+		box = append(box, "│ "+pad(row, inner)+reset+" │")
+	}
+	box = append(box, "│ "+strings.Repeat(" ", inner)+" │")
+	box = append(box, "│ "+pad(footer, inner)+reset+" │")
+	box = append(box, "╰"+strings.Repeat("─", boxWidth-2)+"╯")
+
+	top := max(0, (len(screen)-len(box))/2)
+	margin := strings.Repeat(" ", (a.width-boxWidth)/2)
+	for i, row := range box {
+		if top+i < len(screen) {
+			screen[top+i] = margin + row
+		}
+	}
+	if m.field == nil {
+		return 0, 0, false
+	}
+	return top + fieldStart + fieldRow, len(margin) + 2 + fieldCol, true
+}
+
+// shortPath shows a path under the home directory with ~
+func shortPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		if rel == "." {
+			return "~"
+		}
+		return filepath.Join("~", rel)
+	}
+	return path
+}
+
+// printAfterExit prints what the agent showed after the user quit, such as
+// the session summary
+func (a *App) printAfterExit() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	from := a.closedAt
+	if !a.closing {
+		// The agent stopped by itself, as after /exit
+		from = len(a.entries)
+		for from > 0 && a.entries[from-1].kind != entryUser {
+			from--
+		}
+	}
+	for _, e := range a.entries[from:] {
+		switch e.kind {
+		case entryNotice:
+			fmt.Fprintf(a.out, "%s%s%s\n", styleDim, e.text, reset)
+		case entryError:
+			fmt.Fprintf(a.out, "%sError%s: %s\n", styleError, reset, e.text)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package tui
+
+import (
+	"strings"
+	"unicode"
+)
+
+// inputBox is the text the user is writing, which may span several lines
+type inputBox struct {
+	buf []rune
+	pos int
+
+	// Up and down step through the history once the cursor is on the first or last line
+	history   []string
+	histIndex int
+	draft     []rune
+}
+
+// text returns what has been written
+func (in *inputBox) text() string {
+	return string(in.buf)
+}
+
+// set replaces the text, putting the cursor at its end
+func (in *inputBox) set(text string) {
+	in.buf = []rune(text)
+	in.pos = len(in.buf)
+}
+
+// clear empties the box and returns to the end of the history
+func (in *inputBox) clear() {
+	in.buf, in.pos = nil, 0
+	in.histIndex, in.draft = len(in.history), nil
+}
+
+// insert adds text at the cursor
+func (in *inputBox) insert(text string) {
+	runes := []rune(text)
+	in.buf = append(in.buf[:in.pos], append(runes, in.buf[in.pos:]...)...)
+	in.pos += len(runes)
+}
+
+// edit applies an editing key, reporting whether it was one
+func (in *inputBox) edit(k key) bool {
+	switch k.name {
+	case "":
+		if !unicode.IsPrint(k.r) {
+			return false
+		}
+		in.insert(string(k.r))
+	case "paste":
+		text := strings.ReplaceAll(k.text, "\r\n", "\n")
+		in.insert(strings.ReplaceAll(text, "\r", "\n"))
+	case "ctrl-j", "alt-enter", "shift-enter":
+		in.insert("\n")
+	case "backspace":
+		if in.pos > 0 {
+			in.pos--
+			in.buf = append(in.buf[:in.pos], in.buf[in.pos+1:]...)
+		}
+	case "delete", "ctrl-d":
+		if in.pos < len(in.buf) {
+			in.buf = append(in.buf[:in.pos], in.buf[in.pos+1:]...)
+		}
+	case "left", "ctrl-b":
+		in.pos = max(0, in.pos-1)
+	case "right", "ctrl-f":
+		in.pos = min(len(in.buf), in.pos+1)
+	case "home", "ctrl-a":
+		in.pos = in.lineStart(in.pos)
+	case "end", "ctrl-e":
+		in.pos = in.lineEnd(in.pos)
+	case "ctrl-left", "alt-left", "alt-b":
+		in.pos = in.wordStart()
+	case "ctrl-right", "alt-right", "alt-f":
+		in.pos = in.wordEnd()
+	case "ctrl-k":
+		end := in.lineEnd(in.pos)
+		if end == in.pos && end < len(in.buf) {
+			end++
+		}
+		in.buf = append(in.buf[:in.pos], in.buf[end:]...)
+	case "ctrl-u":
+		start := in.lineStart(in.pos)
+		in.buf = append(in.buf[:start], in.buf[in.pos:]...)
+		in.pos = start
+	case "ctrl-w", "alt-backspace":
+		start := in.wordStart()
+		in.buf = append(in.buf[:start], in.buf[in.pos:]...)
+		in.pos = start
+	case "up", "ctrl-p":
+		in.up()
+	case "down", "ctrl-n":
+		in.down()
+	default:
+		return false
+	}
+	return true
+}
+
+// up moves to the line above, or to the previous history entry from the first line
+func (in *inputBox) up() {
+	start := in.lineStart(in.pos)
+	if start > 0 {
+		prev := in.lineStart(start - 1)
+		in.pos = min(prev+in.pos-start, start-1)
+		return
+	}
+	if in.histIndex == 0 {
+		return
+	}
+	if in.histIndex == len(in.history) {
+		in.draft = append([]rune(nil), in.buf...)
+	}
+	in.histIndex--
+	in.set(in.history[in.histIndex])
+}
+
+// down moves to the line below, or to the next history entry from the last line
+func (in *inputBox) down() {
+	end := in.lineEnd(in.pos)
+	if end < len(in.buf) {
+		column := in.pos - in.lineStart(in.pos)
+		in.pos = min(end+1+column, in.lineEnd(end+1))
+		return
+	}
+	if in.histIndex >= len(in.history) {
+		return
+	}
+	in.histIndex++
+	if in.histIndex == len(in.history) {
+		in.buf, in.pos = in.draft, len(in.draft)
+		return
+	}
+	in.set(in.history[in.histIndex])
+}
+
+// lineStart returns where the line holding position i starts
+func (in *inputBox) lineStart(i int) int {
+	for i > 0 && in.buf[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+// lineEnd returns where the line holding position i ends
+func (in *inputBox) lineEnd(i int) int {
+	for i < len(in.buf) && in.buf[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// wordStart returns the start of the word before the cursor
+func (in *inputBox) wordStart() int {
+	i := in.pos
+	for i > 0 && unicode.IsSpace(in.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(in.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor
+func (in *inputBox) wordEnd() int {
+	i := in.pos
+	for i < len(in.buf) && unicode.IsSpace(in.buf[i]) {
+		i++
+	}
+	for i < len(in.buf) && !unicode.IsSpace(in.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// render returns the rows of the box at width after prompt, and the row and
+// column of the cursor among them
+func (in *inputBox) render(width int, prompt string) (rows []string, cursorRow, cursorCol int) {
+	textWidth := width - displayWidth(prompt)
+	start := 0
+	for i, line := range strings.Split(string(in.buf), "\n") {
+		runes := []rune(line)
+		prefix := strings.Repeat(" ", displayWidth(prompt))
+		if i == 0 {
+			prefix = prompt
+		}
+		// Wrap by characters, so that the cursor's place is easy to follow
+		for offset := 0; ; offset += textWidth {
+			end := min(offset+textWidth, len(runes))
+			if in.pos >= start+offset && (in.pos < start+end || (in.pos == start+end && end == len(runes))) {
+				cursorRow, cursorCol = len(rows), displayWidth(prompt)+displayWidth(expandTabs(string(runes[offset:in.pos-start])))
+			}
+			rows = append(rows, prefix+expandTabs(string(runes[offset:end])))
+			prefix = strings.Repeat(" ", displayWidth(prompt))
+			if end >= len(runes) {
+				break
+			}
+		}
+		start += len(runes) + 1
+	}
+	return rows, cursorRow, cursorCol
+}
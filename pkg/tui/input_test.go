@@ -0,0 +1,84 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+)
+
+// typed returns the keys for typing text
+func typed(text string) []key {
+	var keys []key
+	for _, r := range text {
+		keys = append(keys, key{r: r})
+	}
+	return keys
+}
+
+// named returns keys by name
+func named(names ...string) []key {
+	keys := make([]key, len(names))
+	for i, name := range names {
+		keys[i] = key{name: name}
+	}
+	return keys
+}
+
+func TestInputEdit(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		keys    []key
+		want    string
+		pos     int
+	}{
+		{name: "typing", keys: typed("hello"), want: "hello", pos: 5},
+		{name: "backspace and delete", initial: "hello", keys: named("backspace", "home", "delete"), want: "ell", pos: 0},
+		{name: "insert in the middle", initial: "hllo", keys: append(named("home", "right"), typed("e")...), want: "hello", pos: 2},
+		{name: "newline", initial: "a", keys: append(named("shift-enter"), typed("b")...), want: "a\nb", pos: 3},
+		{name: "paste normalizes line breaks", keys: []key{{name: "paste", text: "a\r\nb\rc"}}, want: "a\nb\nc", pos: 5},
+		{name: "home goes to the line start", initial: "one\ntwo", keys: named("home"), want: "one\ntwo", pos: 4},
+		{name: "words", initial: "go test ./...", keys: named("alt-b", "alt-b", "ctrl-w"), want: "test ./...", pos: 0},
+		{name: "kill to line end", initial: "one\ntwo", keys: named("up", "home", "right", "ctrl-k"), want: "o\ntwo", pos: 1},
+		{name: "kill at line end joins lines", initial: "one\ntwo", keys: named("up", "ctrl-e", "ctrl-k"), want: "onetwo", pos: 3},
+		{name: "kill to line start", initial: "one two", keys: named("left", "left", "ctrl-u"), want: "wo", pos: 0},
+		{name: "up and down keep the column", initial: "abcd\nxy", keys: named("up", "down"), want: "abcd\nxy", pos: 7},
+		{name: "unprintable characters are ignored", initial: "a", keys: []key{{r: '\x00'}}, want: "a", pos: 1},
+	}
+	for _, test := range tests {
+		var in inputBox
+		in.set(test.initial)
+		for _, k := range test.keys {
+			in.edit(k)
+		}
+		if in.text() != test.want || in.pos != test.pos {
+			t.Errorf("%s: got %q with the cursor at %d, want %q at %d", test.name, in.text(), in.pos, test.want, test.pos)
+		}
+	}
+}
+
+func TestInputHistory(t *testing.T) {
+	in := inputBox{history: []string{"first", "second"}}
+	in.clear()
+	in.insert("draft")
+
+	var seen []string
+	for _, name := range []string{"up", "up", "up", "down", "down", "down"} {
+		in.edit(key{name: name})
+		seen = append(seen, in.text())
+	}
+	want := []string{"second", "first", "first", "second", "draft", "draft"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("stepping through the history showed %q, want %q", seen, want)
+	}
+}
+
+func TestInputRender(t *testing.T) {
+	in := inputBox{}
+	in.set("abcdefg\nxy")
+	in.pos = 6
+	rows, row, col := in.render(6, "> ")
+	want := []string{"> abcd", "  efg", "  xy"}
+	if !reflect.DeepEqual(rows, want) || row != 1 || col != 4 {
+		t.Errorf("render = %q with the cursor at %d,%d, want %q at 1,4", rows, row, col, want)
+	}
+}
@@ -0,0 +1,266 @@
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Bracketed paste wraps pasted text in escape sequences, so that newlines
+// in it are not taken as enter
+const (
+	pasteOn  = "\033[?2004h"
+	pasteOff = "\033[?2004l"
+	pasteEnd = "\033[201~"
+)
+
+// key is a key press or pasted text read from the terminal
+type key struct {
+	// r is a typed character, for keys without a name
+	r rune
+	// name names other keys, such as "enter", "up", "ctrl-c" or "paste"
+	name string
+	// text is the pasted text
+	text string
+}
+
+// readKeys reads keys from in and sends them on keys until in fails
+func readKeys(in io.Reader, keys chan<- []key) {
+	defer close(keys)
+	var d keyDecoder
+	buf := make([]byte, 4096)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if decoded := d.decode(buf[:n]); len(decoded) > 0 {
+				keys <- decoded
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ttyReader reads a terminal in a way that can be paused, so another
+// program such as an editor can have the terminal without a read in progress
+// taking its input. It puts the terminal in non-blocking mode so reads can be
+// cut short.
+type ttyReader struct {
+	fd   int
+	file *os.File
+
+	mu sync.Mutex
+	// resume is closed when a pause ends, and nil when not paused
+	resume chan struct{}
+}
+
+// newTTYReader reads the terminal f, or fails when its reads cannot be cut short
+func newTTYReader(f *os.File) (*ttyReader, error) {
+	fd := int(f.Fd())
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		return nil, err
+	}
+	// A non-blocking file gets deadlines, which interrupt reads
+	file := os.NewFile(uintptr(fd), f.Name())
+	if err := file.SetReadDeadline(time.Time{}); err != nil {
+		syscall.SetNonblock(fd, false)
+		return nil, err
+	}
+	return &ttyReader{fd: fd, file: file}, nil
+}
+
+// Read implements io.Reader, waiting while paused
+func (t *ttyReader) Read(p []byte) (int, error) {
+	for {
+		t.mu.Lock()
+		resume := t.resume
+		t.mu.Unlock()
+		if resume != nil {
+			<-resume
+			continue
+		}
+		n, err := t.file.Read(p)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		return n, err
+	}
+}
+
+// pause stops reading and hands the terminal back in blocking mode
+func (t *ttyReader) pause() {
+	t.mu.Lock()
+	t.resume = make(chan struct{})
+	t.mu.Unlock()
+	t.file.SetReadDeadline(time.Now())
+	syscall.SetNonblock(t.fd, false)
+}
+
+// unpause carries on reading after pause
+func (t *ttyReader) unpause() {
+	syscall.SetNonblock(t.fd, true)
+	t.file.SetReadDeadline(time.Time{})
+	t.mu.Lock()
+	close(t.resume)
+	t.resume = nil
+	t.mu.Unlock()
+}
+
+// restore puts the terminal back in blocking mode for the programs that use it next
+func (t *ttyReader) restore() {
+	syscall.SetNonblock(t.fd, false)
+}
+
+// keyDecoder turns the bytes a terminal sends into keys. Escape sequences
+// normally arrive whole in one read, so a lone escape ending a read is the
+// escape key.
+type keyDecoder struct {
+	pending []byte
+	pasting bool
+	paste   []byte
+}
+
+// decode returns the keys in data, keeping incomplete sequences for the next call
+func (d *keyDecoder) decode(data []byte) []key {
+	var keys []key
+	buf := append(d.pending, data...)
+	d.pending = nil
+	for len(buf) > 0 {
+		if d.pasting {
+			i := bytes.Index(buf, []byte(pasteEnd))
+			if i < 0 {
+				// Keep what may be the start of the end marker
+				keep := min(len(buf), len(pasteEnd)-1)
+				d.paste = append(d.paste, buf[:len(buf)-keep]...)
+				d.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+				return keys
+			}
+			d.paste = append(d.paste, buf[:i]...)
+			keys = append(keys, key{name: "paste", text: string(d.paste)})
+			d.paste, d.pasting = nil, false
+			buf = buf[i+len(pasteEnd):]
+			continue
+		}
+
+		k, n := decodeKey(buf)
+		if n == 0 {
+			d.pending = append([]byte(nil), buf...)
+			break
+		}
+		buf = buf[n:]
+		if k.name == "paste-start" {
+			d.pasting = true
+			continue
+		}
+		if k.r != 0 || k.name != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// decodeKey decodes the key at the start of buf and its length in bytes, or
+// a length of 0 when buf holds only part of it
+func decodeKey(buf []byte) (key, int) {
+	b := buf[0]
+	switch {
+	case b == 0x1b:
+		if len(buf) == 1 {
+			return key{name: "esc"}, 1
+		}
+		switch buf[1] {
+		case '[', 'O':
+			for i := 2; i < len(buf); i++ {
+				if buf[i] >= 0x40 && buf[i] <= 0x7e {
+					return csiKey(string(buf[2:i]), buf[i]), i + 1
+				}
+			}
+			return key{}, 0
+		case '\r', '\n':
+			return key{name: "alt-enter"}, 2
+		case 0x7f:
+			return key{name: "alt-backspace"}, 2
+		case 0x1b:
+			return key{name: "esc"}, 1
+		}
+		r, size := utf8.DecodeRune(buf[1:])
+		return key{name: "alt-" + string(r)}, 1 + size
+	case b == '\r':
+		return key{name: "enter"}, 1
+	case b == '\n':
+		return key{name: "ctrl-j"}, 1
+	case b == '\t':
+		return key{name: "tab"}, 1
+	case b == 0x7f || b == 0x08:
+		return key{name: "backspace"}, 1
+	case b < 0x20:
+		return key{name: "ctrl-" + string(rune('a'+b-1))}, 1
+	}
+	if !utf8.FullRune(buf) {
+		return key{}, 0
+	}
+	r, size := utf8.DecodeRune(buf)
+	return key{r: r}, size
+}
+
+// csiKey names the key of a control sequence with its parameters and final byte
+func csiKey(params string, final byte) key {
+	modifier := ""
+	if _, m, ok := strings.Cut(params, ";"); ok {
+		switch m {
+		case "2":
+			modifier = "shift-"
+		case "3":
+			modifier = "alt-"
+		case "5":
+			modifier = "ctrl-"
+		}
+	}
+	switch final {
+	case 'A':
+		return key{name: modifier + "up"}
+	case 'B':
+		return key{name: modifier + "down"}
+	case 'C':
+		return key{name: modifier + "right"}
+	case 'D':
+		return key{name: modifier + "left"}
+	case 'H':
+		return key{name: "home"}
+	case 'F':
+		return key{name: "end"}
+	case 'Z':
+		return key{name: "shift-tab"}
+	case 'u':
+		if params == "13;2" {
+			return key{name: "shift-enter"}
+		}
+	case '~':
+		if params == "27;2;13" {
+			return key{name: "shift-enter"}
+		}
+		number, _, _ := strings.Cut(params, ";")
+		switch number {
+		case "1", "7":
+			return key{name: "home"}
+		case "4", "8":
+			return key{name: "end"}
+		case "3":
+			return key{name: "delete"}
+		case "5":
+			return key{name: "pgup"}
+		case "6":
+			return key{name: "pgdn"}
+		case "200":
+			return key{name: "paste-start"}
+		}
+	}
+	return key{}
+}
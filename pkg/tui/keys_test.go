@@ -0,0 +1,41 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads []string
+		want  []key
+	}{
+		{name: "characters", reads: []string{"hé"}, want: []key{{r: 'h'}, {r: 'é'}}},
+		{name: "control keys", reads: []string{"\r\n\t\x7f\x03"},
+			want: []key{{name: "enter"}, {name: "ctrl-j"}, {name: "tab"}, {name: "backspace"}, {name: "ctrl-c"}}},
+		{name: "arrows", reads: []string{"\x1b[A\x1bOB\x1b[1;5C\x1b[1;3D"},
+			want: []key{{name: "up"}, {name: "down"}, {name: "ctrl-right"}, {name: "alt-left"}}},
+		{name: "editing keys", reads: []string{"\x1b[3~\x1b[5~\x1b[6~\x1b[H\x1b[4~\x1b[Z"},
+			want: []key{{name: "delete"}, {name: "pgup"}, {name: "pgdn"}, {name: "home"}, {name: "end"}, {name: "shift-tab"}}},
+		{name: "shift-enter", reads: []string{"\x1b[13;2u\x1b[27;2;13~"}, want: []key{{name: "shift-enter"}, {name: "shift-enter"}}},
+		{name: "alt keys", reads: []string{"\x1bb\x1b\r\x1b\x7f"}, want: []key{{name: "alt-b"}, {name: "alt-enter"}, {name: "alt-backspace"}}},
+		{name: "escape alone", reads: []string{"\x1b"}, want: []key{{name: "esc"}}},
+		{name: "sequence split across reads", reads: []string{"\x1b[1;", "5A"}, want: []key{{name: "ctrl-up"}}},
+		{name: "character split across reads", reads: []string{"\xc3", "\xa9"}, want: []key{{r: 'é'}}},
+		{name: "paste keeps newlines", reads: []string{"\x1b[200~line 1\rline 2\x1b[201~x"},
+			want: []key{{name: "paste", text: "line 1\rline 2"}, {r: 'x'}}},
+		{name: "paste split across reads", reads: []string{"\x1b[200~ab", "c\x1b[2", "01~"}, want: []key{{name: "paste", text: "abc"}}},
+		{name: "unknown sequences are dropped", reads: []string{"\x1b[99qa"}, want: []key{{r: 'a'}}},
+	}
+	for _, test := range tests {
+		var d keyDecoder
+		var got []key
+		for _, read := range test.reads {
+			got = append(got, d.decode([]byte(read))...)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: decoded %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/permission"
+	"github.com/ttli3/terminal-coding-agent/pkg/review"
+	"github.com/ttli3/terminal-coding-agent/pkg/tools"
+)
+
+// choice is an answer to a modal, picked with its key
+type choice struct {
+	key   rune
+	label string
+}
+
+// modal is a dialog over the screen that waits for the user's answer
+type modal struct {
+	ctx   context.Context
+	title string
+	// content returns the body of the dialog at width
+	content func(width int) []string
+	choices []choice
+	// cancel is the answer given by escape, and enter the one given by
+	// enter; empty ones leave the keys unused
+	cancel string
+	enter  string
+	// field, when set, is a text box whose text is the answer
+	field *inputBox
+	reply chan string
+
+	rows      []string
+	rowsWidth int
+	scroll    int
+}
+
+// body returns the modal's content at width
+func (m *modal) body(width int) []string {
+	if m.rows == nil || m.rowsWidth != width {
+		m.rows, m.rowsWidth = m.content(width), width
+	}
+	return m.rows
+}
+
+// answer picks the answer for k, or returns false if k does not answer
+func (m *modal) answer(k key) (string, bool) {
+	if m.field != nil {
+		switch k.name {
+		case "enter":
+			return m.field.text(), true
+		case "esc":
+			return "", true
+		}
+		m.field.edit(k)
+		return "", false
+	}
+
+	switch k.name {
+	case "esc", "ctrl-c":
+		return m.cancel, m.cancel != ""
+	case "enter":
+		return m.enter, m.enter != ""
+	case "":
+		for _, c := range m.choices {
+			if k.r == c.key || k.r == c.key-'a'+'A' {
+				return string(c.key), true
+			}
+		}
+	}
+	return "", false
+}
+
+// permissionModal asks whether a tool call may run, showing the change an
+// edit would make side by side
+func permissionModal(ctx context.Context, req permission.Request, env *tools.Env) *modal {
+	var preview *tools.EditPreview
+	if req.Tool == tools.EditFileDefinition.Name && env != nil {
+		preview, _ = tools.PreviewEdit(env, req.Input)
+	}
+
+	content := func(width int) []string {
+		if preview == nil {
+			var rows []string
+			if req.Subject != "" {
+				rows = append(rows, wordWrap(req.Subject, width)...)
+				rows = append(rows, "")
+			}
+			for _, line := range strings.Split(indentJSON(req.Input), "\n") {
+				rows = append(rows, hardWrap(styleDim+expandTabs(line)+reset, width)...)
+			}
+			return rows
+		}
+
+		path := preview.Path
+		if env != nil {
+			if rel, err := filepath.Rel(env.WorkspaceRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+		action := "Edit"
+		if preview.Created {
+			action = "Create"
+		}
+		rows := []string{styleBold + action + " " + path + reset, ""}
+		return append(rows, sideBySide(preview.Diff(preview.After), width)...)
+	}
+
+	return &modal{
+		ctx:     ctx,
+		title:   fmt.Sprintf("Allow %s?", req.Tool),
+		content: content,
+		choices: []choice{{'y', "yes"}, {'n', "no"}, {'a', req.AlwaysLabel()}},
+		cancel:  "n",
+		reply:   make(chan string, 1),
+	}
+}
+
+// questionModal asks a yes or no question, answered no by default
+func questionModal(question string) *modal {
+	return &modal{
+		ctx:     context.Background(),
+		title:   "Confirm",
+		content: func(width int) []string { return wordWrap(ansiEscape.ReplaceAllString(question, ""), width) },
+		choices: []choice{{'y', "yes"}, {'n', "no"}},
+		cancel:  "n",
+		enter:   "n",
+		reply:   make(chan string, 1),
+	}
+}
+
+// choiceModal asks the user to pick one of choices, without a default
+func choiceModal(ctx context.Context, title string, body []string, choices []review.Choice) *modal {
+	m := &modal{
+		ctx:   ctx,
+		title: title,
+		content: func(width int) []string {
+			var rows []string
+			for _, row := range body {
+				rows = append(rows, hardWrap(expandTabs(row), width)...)
+			}
+			return rows
+		},
+		reply: make(chan string, 1),
+	}
+	for _, c := range choices {
+		m.choices = append(m.choices, choice{key: c.Key, label: c.Label})
+	}
+	return m
+}
+
+// textModal asks the user to type an answer to prompt
+func textModal(ctx context.Context, prompt string) *modal {
+	return &modal{
+		ctx:     ctx,
+		title:   "Feedback",
+		content: func(width int) []string { return wordWrap(prompt, width) },
+		field:   &inputBox{},
+		reply:   make(chan string, 1),
+	}
+}
+
+// sideBySide shows the lines of a diff before the change on the left and
+// after it on the right, with a few unchanged lines around each change
+func sideBySide(lines []tools.DiffLine, width int) []string {
+	// Pair each run of removed lines with the added lines that replace it
+	type row struct {
+		left, right     string
+		leftNo, rightNo int
+		removed, added  bool
+	}
+	var rows []row
+	leftNo, rightNo := 0, 0
+	for i := 0; i < len(lines); {
+		if lines[i].Op == '=' {
+			leftNo++
+			rightNo++
+			rows = append(rows, row{left: lines[i].Text, right: lines[i].Text, leftNo: leftNo, rightNo: rightNo})
+			i++
+			continue
+		}
+		var removed, added []string
+		for ; i < len(lines) && lines[i].Op == '-'; i++ {
+			removed = append(removed, lines[i].Text)
+		}
+		for ; i < len(lines) && lines[i].Op == '+'; i++ {
+			added = append(added, lines[i].Text)
+		}
+		for j := 0; j < max(len(removed), len(added)); j++ {
+			var r row
+			if j < len(removed) {
+				leftNo++
+				r.left, r.leftNo, r.removed = removed[j], leftNo, true
+			}
+			if j < len(added) {
+				rightNo++
+				r.right, r.rightNo, r.added = added[j], rightNo, true
+			}
+			rows = append(rows, r)
+		}
+	}
+
+	// Show changed rows and their context, marking the gaps between them
+	changed := make([]bool, len(rows))
+	for i, r := range rows {
+		if r.removed || r.added {
+			for j := max(0, i-tools.DiffContext); j <= min(len(rows)-1, i+tools.DiffContext); j++ {
+				changed[j] = true
+			}
+		}
+	}
+	column := (width - 3) / 2
+	side := func(text string, no int, style string) string {
+		if no == 0 {
+			return strings.Repeat(" ", column)
+		}
+		return pad(fmt.Sprintf("%s%4d %s%s", style, no, expandTabs(text), reset), column)
+	}
+	var out []string
+	gap := false
+	for i, r := range rows {
+		if !changed[i] {
+			gap = true
+			continue
+		}
+		if gap && len(out) > 0 {
+			out = append(out, styleDim+pad("   ⋯", column)+" │ "+"   ⋯"+reset)
+		}
+		gap = false
+		leftStyle, rightStyle := styleDim, styleDim
+		if r.removed {
+			leftStyle = styleGone
+		}
+		if r.added {
+			rightStyle = styleAdded
+		}
+		out = append(out, side(r.left, r.leftNo, leftStyle)+styleDim+" │ "+reset+side(r.right, r.rightNo, rightStyle))
+	}
+	if len(out) == 0 {
+		out = append(out, styleDim+"No changes"+reset)
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package tui
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Styles used across the screen, as ANSI escape codes
+const (
+	reset      = "\u001b[0m"
+	styleDim   = "\u001b[90m"
+	styleBold  = "\u001b[1m"
+	styleUser  = "\u001b[1;96m"
+	styleError = "\u001b[91m"
+	styleOK    = "\u001b[32m"
+	styleWarn  = "\u001b[93m"
+	styleBar   = "\u001b[7m"
+	styleAdded = "\u001b[32m"
+	styleGone  = "\u001b[31m"
+)
+
+// ansiEscape matches a terminal escape sequence
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// displayWidth returns how many columns styled text takes
+func displayWidth(s string) int {
+	return utf8.RuneCountInString(ansiEscape.ReplaceAllString(s, ""))
+}
+
+// expandTabs replaces tabs with spaces, which the screen measures reliably
+func expandTabs(s string) string {
+	return strings.ReplaceAll(s, "\t", "    ")
+}
+
+// truncate cuts styled text to at most width columns, keeping its escape codes
+func truncate(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	columns := 0
+	for i := 0; i < len(s); {
+		if loc := ansiEscape.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+			b.WriteString(s[i : i+loc[1]])
+			i += loc[1]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if columns+1 > width {
+			break
+		}
+		b.WriteRune(r)
+		columns++
+		i += size
+	}
+	return b.String() + reset
+}
+
+// pad fills styled text with spaces to width columns, cutting it if it is wider
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	return s + strings.Repeat(" ", max(0, width-displayWidth(s)))
+}
+
+// hardWrap breaks a styled line into rows of at most width columns,
+// restarting its style on each row
+func hardWrap(s string, width int) []string {
+	if width < 1 || displayWidth(s) <= width {
+		return []string{s}
+	}
+	var rows []string
+	var row strings.Builder
+	var style string
+	columns := 0
+	for i := 0; i < len(s); {
+		if loc := ansiEscape.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+			code := s[i : i+loc[1]]
+			if code == reset || code == "\u001b[m" {
+				style = ""
+			} else {
+				style += code
+			}
+			row.WriteString(code)
+			i += loc[1]
+			continue
+		}
+		if columns == width {
+			rows = append(rows, row.String()+reset)
+			row.Reset()
+			row.WriteString(style)
+			columns = 0
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		row.WriteRune(r)
+		columns++
+		i += size
+	}
+	return append(rows, row.String())
+}
+
+// wordWrap breaks plain text into rows of at most width columns at spaces,
+// keeping its line breaks and the indentation of its lines
+func wordWrap(text string, width int) []string {
+	var rows []string
+	for _, line := range strings.Split(expandTabs(text), "\n") {
+		row, started := "", false
+		for _, word := range strings.Split(line, " ") {
+			switch {
+			case !started:
+				row, started = word, true
+			case utf8.RuneCountInString(row)+1+utf8.RuneCountInString(word) <= width:
+				row += " " + word
+			default:
+				rows = append(rows, hardWrap(row, width)...)
+				row = word
+			}
+		}
+		rows = append(rows, hardWrap(row, width)...)
+	}
+	return rows
+}
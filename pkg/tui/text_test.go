@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  string
+	}{
+		{text: "short", width: 10, want: "short"},
+		{text: "abcdef", width: 3, want: "abc" + reset},
+		{text: styleBold + "héllo" + reset, width: 2, want: styleBold + "hé" + reset},
+		{text: styleBold + "héllo" + reset, width: 5, want: styleBold + "héllo" + reset},
+	}
+	for _, test := range tests {
+		if got := truncate(test.text, test.width); got != test.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+	if got := pad(styleBold+"ab"+reset, 4); got != styleBold+"ab"+reset+"  " {
+		t.Errorf("pad = %q", got)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name  string
+		wrap  func(string, int) []string
+		text  string
+		width int
+		want  []string
+	}{
+		{name: "hard wrap", wrap: hardWrap, text: "abcdefg", width: 3, want: []string{"abc" + reset, "def" + reset, "g"}},
+		{name: "hard wrap restarts the style", wrap: hardWrap, text: styleError + "abcd" + reset + "e", width: 2,
+			want: []string{styleError + "ab" + reset, styleError + "cd" + reset + reset, "e"}},
+		{name: "word wrap", wrap: wordWrap, text: "the quick brown fox", width: 10, want: []string{"the quick", "brown fox"}},
+		{name: "word wrap keeps line breaks", wrap: wordWrap, text: "a\n\nb", width: 10, want: []string{"a", "", "b"}},
+		{name: "word wrap cuts long words", wrap: wordWrap, text: "ab abcdefgh", width: 4, want: []string{"ab", "abcd" + reset, "efgh"}},
+		{name: "word wrap keeps indentation", wrap: wordWrap, text: "\tx\n  yy zz", width: 6, want: []string{"    x", "  yy", "zz"}},
+	}
+	for _, test := range tests {
+		if got := test.wrap(test.text, test.width); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestModalAnswer(t *testing.T) {
+	m := &modal{choices: []choice{{'y', "yes"}, {'n', "no"}}, cancel: "n", enter: "y"}
+	tests := []struct {
+		key    key
+		answer string
+		ok     bool
+	}{
+		{key: key{r: 'y'}, answer: "y", ok: true},
+		{key: key{r: 'N'}, answer: "n", ok: true},
+		{key: key{r: 'x'}},
+		{key: key{name: "enter"}, answer: "y", ok: true},
+		{key: key{name: "esc"}, answer: "n", ok: true},
+		{key: key{name: "ctrl-c"}, answer: "n", ok: true},
+	}
+	for _, test := range tests {
+		if answer, ok := m.answer(test.key); answer != test.answer || ok != test.ok {
+			t.Errorf("answer(%+v) = %q, %t, want %q, %t", test.key, answer, ok, test.answer, test.ok)
+		}
+	}
+
+	field := textModal(context.Background(), "Why?")
+	for _, k := range typed("no") {
+		field.answer(k)
+	}
+	if answer, ok := field.answer(key{name: "enter"}); answer != "no" || !ok {
+		t.Errorf("text answer = %q, %t, want no", answer, ok)
+	}
+}
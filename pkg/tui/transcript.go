@@ -0,0 +1,209 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ttli3/terminal-coding-agent/pkg/markdown"
+)
+
+// maxToolLines is how many lines of a tool's output an expanded panel shows
+const maxToolLines = 500
+
+// entryKind is what an entry of the transcript shows
+type entryKind int
+
+const (
+	entryUser entryKind = iota
+	entryAssistant
+	entryTool
+	entryNotice
+	entryError
+	entryChecklist
+)
+
+// toolState is how far a tool call has got
+type toolState int
+
+const (
+	toolPending toolState = iota
+	toolRunning
+	toolDone
+	toolFailed
+	toolDenied
+)
+
+// entry is one item of the transcript: a message, a notice or a tool call
+type entry struct {
+	kind entryKind
+	text string
+
+	// Tool calls show their input and output in a panel that can be expanded
+	toolID   string
+	tool     string
+	input    json.RawMessage
+	output   string
+	progress []string
+	state    toolState
+	expanded bool
+
+	// The rendered rows are kept until the entry or the width changes
+	rows        []string
+	rowsWidth   int
+	rowSelected bool
+}
+
+// changed drops the entry's rendered rows
+func (e *entry) changed() {
+	e.rows = nil
+}
+
+// render returns the entry's rows at width, highlighting a selected tool panel
+func (e *entry) render(width int, selected bool) []string {
+	if e.rows != nil && e.rowsWidth == width && e.rowSelected == selected {
+		return e.rows
+	}
+	e.rowsWidth, e.rowSelected = width, selected
+
+	var rows []string
+	switch e.kind {
+	case entryUser:
+		for i, row := range wordWrap(e.text, width-2) {
+			prefix := "  "
+			if i == 0 {
+				prefix = styleUser + "›" + reset + " "
+			}
+			rows = append(rows, prefix+styleBold+row+reset)
+		}
+	case entryAssistant:
+		for i, row := range strings.Split(markdown.Render(e.text, width-2), "\n") {
+			prefix := "  "
+			if i == 0 {
+				prefix = "● "
+			}
+			rows = append(rows, prefix+row)
+		}
+	case entryNotice:
+		for _, row := range wordWrap(e.text, width) {
+			rows = append(rows, styleDim+row+reset)
+		}
+	case entryError:
+		for _, row := range wordWrap("Error: "+e.text, width) {
+			rows = append(rows, styleError+row+reset)
+		}
+	case entryTool:
+		rows = e.renderTool(width, selected)
+	case entryChecklist:
+		for i, line := range strings.Split(e.text, "\n") {
+			style := ""
+			switch {
+			case i == 0:
+				style = styleBold
+			case strings.Contains(line, "✓"), strings.Contains(line, "–"):
+				style = styleDim
+			case strings.Contains(line, "▸"):
+				style = styleWarn
+			}
+			rows = append(rows, style+truncate(line, width)+reset)
+		}
+	}
+	e.rows = rows
+	return rows
+}
+
+// renderTool renders a tool call as a header line, followed by its input,
+// progress and output when expanded
+func (e *entry) renderTool(width int, selected bool) []string {
+	arrow := "▸"
+	if e.expanded {
+		arrow = "▾"
+	}
+	icon := map[toolState]string{
+		toolPending: styleDim + "…" + reset,
+		toolRunning: styleWarn + "⋯" + reset,
+		toolDone:    styleOK + "✓" + reset,
+		toolFailed:  styleError + "✗" + reset,
+		toolDenied:  styleWarn + "⊘" + reset,
+	}[e.state]
+
+	header := fmt.Sprintf("%s %s %s%s%s(%s)", arrow, icon, styleBold, e.tool, reset, compactJSON(e.input))
+	if summary := e.summary(); summary != "" && !e.expanded {
+		header += styleDim + " · " + summary + reset
+	}
+	header = truncate(header, width)
+	if selected {
+		header = styleBar + pad(ansiEscape.ReplaceAllString(header, ""), width) + reset
+	}
+	rows := []string{header}
+	if !e.expanded {
+		return rows
+	}
+
+	bar := styleDim + "  │ " + reset
+	add := func(style, text string) {
+		for _, line := range strings.Split(text, "\n") {
+			for _, row := range hardWrap(expandTabs(line), width-4) {
+				rows = append(rows, bar+style+row+reset)
+			}
+		}
+	}
+	add(styleDim, "input: "+indentJSON(e.input))
+	for _, line := range e.progress {
+		add(styleDim, line)
+	}
+	output := strings.TrimRight(e.output, "\n")
+	if lines := strings.Split(output, "\n"); len(lines) > maxToolLines {
+		output = strings.Join(lines[:maxToolLines], "\n") + fmt.Sprintf("\n… %d more lines", len(lines)-maxToolLines)
+	}
+	switch {
+	case e.state == toolFailed || e.state == toolDenied:
+		add(styleError, output)
+	case output != "":
+		add("", output)
+	}
+	return rows
+}
+
+// summary describes the outcome of a tool call in a few words
+func (e *entry) summary() string {
+	output := strings.TrimRight(e.output, "\n")
+	switch e.state {
+	case toolPending:
+		return "waiting"
+	case toolRunning:
+		if len(e.progress) > 0 {
+			return e.progress[len(e.progress)-1]
+		}
+		return "running"
+	case toolDenied, toolFailed:
+		line, _, _ := strings.Cut(output, "\n")
+		return line
+	}
+	if output == "" {
+		return "no output"
+	}
+	if n := strings.Count(output, "\n") + 1; n > 1 {
+		return fmt.Sprintf("%d lines", n)
+	}
+	return output
+}
+
+// compactJSON shows JSON on one line
+func compactJSON(raw json.RawMessage) string {
+	var b bytes.Buffer
+	if json.Compact(&b, raw) != nil {
+		return string(raw)
+	}
+	return b.String()
+}
+
+// indentJSON shows JSON indented over several lines
+func indentJSON(raw json.RawMessage) string {
+	var b bytes.Buffer
+	if json.Indent(&b, raw, "", "  ") != nil {
+		return string(raw)
+	}
+	return b.String()
+}
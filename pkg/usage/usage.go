@@ -0,0 +1,239 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Usage counts the tokens consumed by one or more API requests
+type Usage struct {
+	InputTokens      int64 `json:"input_tokens"`
+	OutputTokens     int64 `json:"output_tokens"`
+	CacheReadTokens  int64 `json:"cache_read_tokens"`
+	CacheWriteTokens int64 `json:"cache_write_tokens"`
+	Requests         int   `json:"requests"`
+}
+
+// FromAPI converts the usage reported on an API response
+func FromAPI(u anthropic.Usage) Usage {
+	return Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+		Requests:         1,
+	}
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		InputTokens:      u.InputTokens + o.InputTokens,
+		OutputTokens:     u.OutputTokens + o.OutputTokens,
+		CacheReadTokens:  u.CacheReadTokens + o.CacheReadTokens,
+		CacheWriteTokens: u.CacheWriteTokens + o.CacheWriteTokens,
+		Requests:         u.Requests + o.Requests,
+	}
+}
+
+// TotalTokens returns every token counted, cached or not
+func (u Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheReadTokens + u.CacheWriteTokens
+}
+
+// CacheHitRate returns the fraction of input tokens that were read from the prompt cache
+func (u Usage) CacheHitRate() float64 {
+	input := u.InputTokens + u.CacheReadTokens + u.CacheWriteTokens
+	if input == 0 {
+		return 0
+	}
+	return float64(u.CacheReadTokens) / float64(input)
+}
+
+// String formats the token counts for display
+func (u Usage) String() string {
+	return fmt.Sprintf("%s in / %s out (cache: %s read, %s written)",
+		FormatTokens(u.InputTokens), FormatTokens(u.OutputTokens),
+		FormatTokens(u.CacheReadTokens), FormatTokens(u.CacheWriteTokens))
+}
+
+// Pricing is the price of a model in US dollars per million tokens
+type Pricing struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+}
+
+// PriceTable maps model names, or prefixes of them, to their pricing
+type PriceTable map[string]Pricing
+
+// DefaultPrices are the published list prices; config can override or extend them
+var DefaultPrices = PriceTable{
+	"claude-3-opus":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-sonnet":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25, CacheWrite: 0.30, CacheRead: 0.03},
+}
+
+// Merge returns a table with the entries of o added to or replacing those of t
+func (t PriceTable) Merge(o PriceTable) PriceTable {
+	merged := PriceTable{}
+	for model, p := range t {
+		merged[model] = p
+	}
+	for model, p := range o {
+		merged[model] = p
+	}
+	return merged
+}
+
+// Lookup finds the pricing for a model, preferring the longest matching prefix
+func (t PriceTable) Lookup(model string) (Pricing, bool) {
+	if p, ok := t[model]; ok {
+		return p, true
+	}
+
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, key := range keys {
+		if strings.HasPrefix(model, key) {
+			return t[key], true
+		}
+	}
+	return Pricing{}, false
+}
+
+// Cost estimates the price in US dollars of usage on a model
+func (t PriceTable) Cost(model string, u Usage) float64 {
+	p, ok := t.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheWriteTokens)*p.CacheWrite +
+		float64(u.CacheReadTokens)*p.CacheRead) / 1e6
+}
+
+// Tracker accumulates usage for the last request, the current turn and the
+// session. Each request is priced when it is added, at the model that served
+// it, so switching models does not reprice earlier requests.
+type Tracker struct {
+	mu          sync.Mutex
+	model       string
+	prices      PriceTable
+	request     Usage
+	turn        Usage
+	session     Usage
+	requestCost float64
+	turnCost    float64
+	sessionCost float64
+}
+
+// NewTracker creates a tracker pricing usage of model with prices
+func NewTracker(model string, prices PriceTable) *Tracker {
+	return &Tracker{model: model, prices: prices}
+}
+
+// SetModel prices further usage as usage of model
+func (t *Tracker) SetModel(model string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.model = model
+}
+
+// StartTurn resets the per-turn totals
+func (t *Tracker) StartTurn() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.turn, t.turnCost = Usage{}, 0
+}
+
+// Add records the usage of one API request served by model, or by the
+// tracker's model if model is ""
+func (t *Tracker) Add(model string, u Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if model == "" {
+		model = t.model
+	}
+	cost := t.prices.Cost(model, u)
+	t.request, t.requestCost = u, cost
+	t.turn, t.turnCost = t.turn.Add(u), t.turnCost+cost
+	t.session, t.sessionCost = t.session.Add(u), t.sessionCost+cost
+}
+
+// Restore seeds the session totals, e.g. when resuming a saved session
+func (t *Tracker) Restore(u Usage, cost float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session, t.sessionCost = u, cost
+}
+
+// Reset clears every total for a new session
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.request, t.turn, t.session = Usage{}, Usage{}, Usage{}
+	t.requestCost, t.turnCost, t.sessionCost = 0, 0, 0
+}
+
+// Report is a snapshot of the tracked usage and its estimated cost
+type Report struct {
+	Model       string  `json:"model"`
+	Request     Usage   `json:"request"`
+	Turn        Usage   `json:"turn"`
+	Session     Usage   `json:"session"`
+	RequestCost float64 `json:"request_cost"`
+	TurnCost    float64 `json:"turn_cost"`
+	SessionCost float64 `json:"session_cost"`
+}
+
+// Report returns a snapshot of the tracked usage
+func (t *Tracker) Report() Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Report{
+		Model:       t.model,
+		Request:     t.request,
+		Turn:        t.turn,
+		Session:     t.session,
+		RequestCost: t.requestCost,
+		TurnCost:    t.turnCost,
+		SessionCost: t.sessionCost,
+	}
+}
+
+// FormatTokens renders a token count with thousands separators
+func FormatTokens(n int64) string {
+	s := fmt.Sprintf("%d", n)
+	if n < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// FormatCost renders an estimated cost in US dollars
+func FormatCost(cost float64) string {
+	if cost < 0.01 && cost > 0 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
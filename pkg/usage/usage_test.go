@@ -0,0 +1,72 @@
+package usage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrackerPricesEachRequestAtItsModel(t *testing.T) {
+	prices := PriceTable{
+		"cheap":  {Input: 1, Output: 2},
+		"pricey": {Input: 10, Output: 20},
+	}
+	tracker := NewTracker("cheap", prices)
+	million := Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000, Requests: 1}
+
+	tracker.StartTurn()
+	tracker.Add("cheap", million)
+	tracker.SetModel("pricey")
+	tracker.StartTurn()
+	tracker.Add("", million)
+
+	report := tracker.Report()
+	if report.Model != "pricey" {
+		t.Errorf("Model = %q, want pricey", report.Model)
+	}
+	for name, got := range map[string]float64{"request": report.RequestCost, "turn": report.TurnCost} {
+		if math.Abs(got-30) > 1e-9 {
+			t.Errorf("%s cost = %v, want 30", name, got)
+		}
+	}
+	if math.Abs(report.SessionCost-33) > 1e-9 {
+		t.Errorf("session cost = %v, want 33 (3 on cheap, then 30 on pricey)", report.SessionCost)
+	}
+	if report.Session.Requests != 2 {
+		t.Errorf("session requests = %d, want 2", report.Session.Requests)
+	}
+}
+
+func TestTrackerRestoreAndReset(t *testing.T) {
+	tracker := NewTracker("cheap", PriceTable{"cheap": {Input: 1}})
+	tracker.Restore(Usage{InputTokens: 500, Requests: 3}, 1.5)
+	tracker.Add("cheap", Usage{InputTokens: 1_000_000, Requests: 1})
+
+	report := tracker.Report()
+	if report.Session.Requests != 4 || math.Abs(report.SessionCost-2.5) > 1e-9 {
+		t.Errorf("after restore: %d requests costing %v, want 4 costing 2.5", report.Session.Requests, report.SessionCost)
+	}
+
+	tracker.Reset()
+	if report := tracker.Report(); report.Session != (Usage{}) || report.SessionCost != 0 || report.TurnCost != 0 {
+		t.Errorf("after reset: %+v, want empty", report)
+	}
+}
+
+func TestPriceTableLookup(t *testing.T) {
+	tests := []struct {
+		model string
+		input float64
+		found bool
+	}{
+		{"claude-3-5-sonnet-20241022", 3, true},
+		{"claude-3-5-haiku-latest", 0.80, true},
+		{"claude-3-haiku-20240307", 0.25, true},
+		{"gpt-4", 0, false},
+	}
+	for _, test := range tests {
+		p, ok := DefaultPrices.Lookup(test.model)
+		if ok != test.found || p.Input != test.input {
+			t.Errorf("Lookup(%q) = %v, %t, want input %v, %t", test.model, p.Input, ok, test.input, test.found)
+		}
+	}
+}